@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"go.adoublef/eyeoh/internal/fs"
+	"go.adoublef/eyeoh/internal/macaroon"
+	"go.adoublef/eyeoh/internal/net/http"
+)
+
+var cmdAttenuate = &attenuate{}
+
+type attenuate struct {
+	caveats http.Caveats
+	ops     string
+	ttl     time.Duration
+	token   string
+	stdout  io.Writer
+}
+
+func (c *attenuate) parse(args []string, _ func(string) string) error {
+	fs := flag.NewFlagSet("attenuate", flag.ContinueOnError)
+	fs.StringVar(&c.caveats.Path, "path", "", "path of the entry the token is restricted to")
+	fs.StringVar(&c.ops, "ops", "", "comma separated operations the token is restricted to: read, upload, write, delete, admin")
+	fs.Int64Var(&c.caveats.MaxSize, "max-size", 0, "max bytes a request can upload, 0 does not restrict")
+	fs.DurationVar(&c.ttl, "ttl", 0, "how long the token can be used, 0 does not restrict")
+	fs.StringVar(&c.caveats.IP, "ip", "", "client address or cidr range the token is restricted to")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `
+The attenuate command restricts a capability token further and prints the new
+token. It does not connect to the server.
+
+Usage:
+	%s attenuate [arguments] TOKEN
+
+Arguments:
+`[1:], os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() != 1 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	c.token = fs.Arg(0)
+	if c.ops != "" {
+		c.caveats.Ops = strings.Split(c.ops, ",")
+	}
+	if c.ttl < 0 {
+		return fmt.Errorf("ttl must not be negative")
+	} else if c.ttl > 0 {
+		c.caveats.Expires = ptr(time.Now().Add(c.ttl))
+	}
+	return nil
+}
+
+func (c *attenuate) run(_ context.Context) error {
+	s, ok := strings.CutPrefix(c.token, fs.CapabilityPrefix)
+	if !ok {
+		return errors.New("not a capability token")
+	}
+	m, err := macaroon.Parse(s)
+	if err != nil {
+		return err
+	}
+	caveats, err := c.caveats.Strings()
+	if err != nil {
+		return err
+	}
+	if len(caveats) == 0 {
+		return errors.New("no caveats to add")
+	}
+	for _, cv := range caveats {
+		m.Add(cv)
+	}
+	w := c.stdout
+	if w == nil {
+		w = os.Stdout
+	}
+	fmt.Fprintln(w, fs.CapabilityPrefix+m.String())
+	return nil
+}
+
+func ptr[V any](v V) *V { return &v }
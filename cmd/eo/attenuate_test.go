@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"strings"
+	"testing"
+
+	"go.adoublef/eyeoh/internal/fs"
+	"go.adoublef/eyeoh/internal/macaroon"
+	"go.adoublef/eyeoh/internal/testing/is"
+)
+
+func Test_attenuate_parse(t *testing.T) {
+	type testcase struct {
+		in   []string
+		want error
+	}
+
+	var tt = map[string]testcase{
+		"OK": {
+			in: []string{"--path", "/ingest", "--ops", "upload", "--ttl", "1h", "eoc_token"},
+		},
+		"ErrNoToken": {
+			in:   []string{"--ops", "read"},
+			want: flag.ErrHelp,
+		},
+	}
+	for name, tc := range tt {
+		t.Run(name, func(t *testing.T) {
+			var c attenuate
+			err := c.parse(tc.in, nil)
+			is.NotOK(t, err, tc.want) // got;want
+		})
+	}
+}
+
+func Test_attenuate_run(t *testing.T) {
+	var (
+		key   = []byte("0123456789abcdef0123456789abcdef")
+		token = fs.CapabilityPrefix + macaroon.New(key, []byte("id")).String()
+	)
+
+	t.Run("OK", func(t *testing.T) {
+		var c attenuate
+		is.OK(t, c.parse([]string{"--path", "/ingest", "--ops", "upload", token}, nil))
+		var buf bytes.Buffer
+		c.stdout = &buf
+		is.OK(t, c.run(context.Background()))
+
+		m, err := macaroon.Parse(strings.TrimPrefix(strings.TrimSpace(buf.String()), fs.CapabilityPrefix))
+		is.OK(t, err) // parse attenuated token
+		is.Equal(t, strings.Join(m.Caveats(), ";"), "path = /ingest;ops = upload")
+		is.OK(t, m.Verify(key, func(string) error { return nil })) // still signed by the root key
+	})
+
+	t.Run("ErrInvalidOp", func(t *testing.T) {
+		var c attenuate
+		is.OK(t, c.parse([]string{"--ops", "everything", token}, nil))
+		is.True(t, c.run(context.Background()) != nil)
+	})
+}
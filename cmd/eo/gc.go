@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/google/uuid"
+	"go.adoublef/eyeoh/internal/fs"
+)
+
+var cmdGC = &gc{}
+
+type gc struct {
+	grace  time.Duration
+	dryRun bool
+	store  store
+	stdout io.Writer
+}
+
+func (c *gc) parse(args []string, getenv func(string) string) error {
+	fs := flag.NewFlagSet("gc", flag.ContinueOnError)
+	fs.DurationVar(&c.grace, "grace", 24*time.Hour, "min age of a blob before it can be collected")
+	fs.BoolVar(&c.dryRun, "dry-run", false, "report unreferenced blobs without deleting them")
+	if err := c.store.flags(fs, getenv); err != nil {
+		return err
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `
+The gc command deletes blobs that are no longer referenced by any file.
+
+Usage:
+	%s gc [arguments]
+
+Arguments:
+`[1:], os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() != 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	if c.grace < 0 {
+		return fmt.Errorf("grace must not be negative")
+	}
+	return nil
+}
+
+func (c *gc) run(ctx context.Context) error {
+	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, os.Kill)
+	defer cancel()
+
+	fsys, closeStore, err := c.store.open(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	w := c.stdout
+	if w == nil {
+		w = os.Stdout
+	}
+	opts := fs.GCOptions{
+		Before: time.Now().Add(-c.grace),
+		DryRun: c.dryRun,
+		Orphan: func(id uuid.UUID, sz int64) { fmt.Fprintf(w, "%s\t%d\n", id, sz) },
+	}
+	stats, err := fsys.GC(ctx, opts)
+	verb := "deleted"
+	if c.dryRun {
+		verb = "would delete"
+	}
+	fmt.Fprintf(w, "scanned %d blobs, %s %d blobs (%d bytes)\n", stats.Scanned, verb, stats.Orphaned, stats.Size)
+	return err
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"strings"
+	"testing"
+
+	"go.adoublef/eyeoh/internal/testing/is"
+)
+
+func Test_gc_parse(t *testing.T) {
+	type testcase struct {
+		in   []string
+		want error
+	}
+
+	var tt = map[string]testcase{
+		"OK": {
+			in: []string{"--grace", "1h", "--dry-run"},
+		},
+		"ErrTooManyArgs": {
+			in:   []string{"never"},
+			want: flag.ErrHelp,
+		},
+	}
+	for name, tc := range tt {
+		t.Run(name, func(t *testing.T) {
+			var c gc
+			err := c.parse(tc.in, nil)
+			is.NotOK(t, err, tc.want) // got;want
+		})
+	}
+}
+
+func Test_gc_run(t *testing.T) {
+	t.Run("DryRun", func(t *testing.T) {
+		var c gc
+		err := c.parse(append([]string{"--dry-run"}, newTestStore(t)...), nil)
+		is.OK(t, err)
+
+		var buf bytes.Buffer
+		c.stdout = &buf
+		is.OK(t, c.run(context.Background()))
+		is.True(t, strings.HasPrefix(buf.String(), "scanned 0 blobs, would delete 0 blobs"))
+	})
+}
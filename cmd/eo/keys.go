@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/google/uuid"
+	"go.adoublef/eyeoh/internal/fs"
+)
+
+var cmdKeys = &keys{}
+
+type keys struct {
+	ttl    time.Duration
+	name   string
+	revoke bool
+	arg    string
+	store  store
+	stdout io.Writer
+}
+
+func (c *keys) parse(args []string, getenv func(string) string) error {
+	fs := flag.NewFlagSet("keys", flag.ContinueOnError)
+	fs.DurationVar(&c.ttl, "ttl", 0, "how long the key can be used, 0 never expires")
+	fs.StringVar(&c.name, "name", "", "name of the key")
+	fs.BoolVar(&c.revoke, "revoke", false, "revoke the key ID instead of creating one")
+	if err := c.store.flags(fs, getenv); err != nil {
+		return err
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `
+The keys command creates an api key for a user and prints its token, or revokes
+an api key.
+
+Usage:
+	%s keys [arguments] USER_OR_NAME
+	%s keys --revoke [arguments] ID
+
+Arguments:
+`[1:], os.Args[0], os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() != 1 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	c.arg = fs.Arg(0)
+	if c.revoke {
+		if _, err := uuid.Parse(c.arg); err != nil {
+			return err
+		}
+	}
+	if c.ttl < 0 {
+		return fmt.Errorf("ttl must not be negative")
+	}
+	return nil
+}
+
+func (c *keys) run(ctx context.Context) error {
+	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, os.Kill)
+	defer cancel()
+
+	fsys, closeStore, err := c.store.open(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	if c.revoke {
+		return fsys.RevokeKey(ctx, uuid.MustParse(c.arg))
+	}
+	user, err := uuid.Parse(c.arg)
+	if err != nil {
+		// not an id, so the name of the user
+		p, err := fsys.PrincipalByName(ctx, fs.Name(c.arg))
+		if err != nil {
+			return err
+		}
+		user = p.ID
+	}
+	token, k, err := fsys.CreateKey(ctx, user, c.name, c.ttl)
+	if err != nil {
+		return err
+	}
+	w := c.stdout
+	if w == nil {
+		w = os.Stdout
+	}
+	fmt.Fprintf(w, "%s\t%s\n", k.ID, token)
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"strings"
+	"testing"
+
+	"go.adoublef/eyeoh/internal/fs"
+	"go.adoublef/eyeoh/internal/testing/is"
+)
+
+func Test_keys_parse(t *testing.T) {
+	type testcase struct {
+		in   []string
+		want error
+	}
+
+	var tt = map[string]testcase{
+		"OK": {
+			in: []string{"--ttl", "24h", "--name", "ci", "alice"},
+		},
+		"OKRevoke": {
+			in: []string{"--revoke", "0192f0c2-4d2a-7d3e-8f3a-0b1c2d3e4f50"},
+		},
+		"ErrNoUser": {
+			in:   []string{"--ttl", "24h"},
+			want: flag.ErrHelp,
+		},
+	}
+	for name, tc := range tt {
+		t.Run(name, func(t *testing.T) {
+			var c keys
+			err := c.parse(tc.in, nil)
+			is.NotOK(t, err, tc.want) // got;want
+		})
+	}
+}
+
+func Test_keys_run(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		store := newTestStore(t)
+
+		var u users
+		is.OK(t, u.parse(append(store, "alice"), nil))
+		var buf bytes.Buffer
+		u.stdout = &buf
+		is.OK(t, u.run(context.Background())) // create user
+
+		var c keys
+		is.OK(t, c.parse(append(store, "--name", "ci", "alice"), nil))
+		buf.Reset()
+		c.stdout = &buf
+		is.OK(t, c.run(context.Background())) // create key
+
+		id, token, ok := strings.Cut(strings.TrimSpace(buf.String()), "\t")
+		is.True(t, ok)
+		is.True(t, strings.HasPrefix(token, fs.KeyPrefix))
+
+		var r keys
+		is.OK(t, r.parse(append(store, "--revoke", id), nil))
+		is.OK(t, r.run(context.Background())) // revoke key
+	})
+}
@@ -14,8 +14,12 @@ type cmd interface {
 }
 
 var cmds = map[string]cmd{
-	"serve":  cmdServe,
-	"health": cmdHealth,
+	"serve":     cmdServe,
+	"health":    cmdHealth,
+	"gc":        cmdGC,
+	"users":     cmdUsers,
+	"keys":      cmdKeys,
+	"attenuate": cmdAttenuate,
 }
 
 func main() {
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+
+	"go.adoublef/eyeoh/internal/testing/storetest"
+)
+
+// newTestStore returns the arguments needed to connect [store] to the test containers.
+// A new bucket is created for each call.
+func newTestStore(tb testing.TB) []string {
+	tb.Helper()
+
+	s := storetest.New(tb)
+	return []string{
+		"--database-url", s.DatabaseURL,
+		"--migrate",
+		"--s3-endpoint", s.S3Endpoint,
+		"--s3-bucket", s.Bucket,
+		"--s3-access-key", s.S3AccessKey,
+		"--s3-secret-key", s.S3SecretKey,
+		"--s3-path-style",
+	}
+}
+
+func TestMain(m *testing.M) { storetest.Main(m) }
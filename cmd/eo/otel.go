@@ -5,6 +5,7 @@ import (
 	"errors"
 	"time"
 
+	olog "go.opentelemetry.io/contrib/bridges/otelslog"
 	"go.opentelemetry.io/contrib/instrumentation/runtime"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
@@ -18,6 +19,10 @@ import (
 	"go.opentelemetry.io/otel/sdk/trace"
 )
 
+const scopeName = "go.adoublef/eyeoh/cmd/eo"
+
+var logger = olog.NewLogger(scopeName)
+
 func setupOTel(ctx context.Context) (shutdown func(ctx context.Context) error, err error) {
 	var shutdownFuncs []func(context.Context) error
 	shutdown = func(ctx context.Context) error {
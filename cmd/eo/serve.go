@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"errors"
 	"flag"
 	"fmt"
@@ -11,7 +12,9 @@ import (
 	"time"
 
 	"go.adoublef/eyeoh/internal/fs"
+	"go.adoublef/eyeoh/internal/jwt"
 	"go.adoublef/eyeoh/internal/net/http"
+	"go.adoublef/eyeoh/internal/runtime/debug"
 	"go.adoublef/eyeoh/internal/time/rate"
 	"golang.org/x/sync/errgroup"
 )
@@ -23,6 +26,14 @@ type serve struct {
 	rateLimit                              rate.Rate
 	readTimeout, writeTimeout, idleTimeout time.Duration
 	maxHeaderBytes                         int
+	store                                  store
+	trashRetention, purgeInterval          time.Duration
+	maxVersions                            int
+	uploadTimeout, reconcileInterval       time.Duration
+	gcGrace, gcInterval                    time.Duration
+	noAuth                                 bool
+	jwksFile, oidcIssuer, jwtAudience      string
+	shareKey                               string
 }
 
 func (c *serve) parse(args []string, getenv func(string) string) error {
@@ -37,6 +48,25 @@ func (c *serve) parse(args []string, getenv func(string) string) error {
 	fs.DurationVar(&c.readTimeout, "read-timeout", http.DefaultReadTimeout, "max duration for reading request body")
 	fs.DurationVar(&c.writeTimeout, "write-timeout", http.DefaultWriteTimeout, "max duration for writing response")
 	fs.DurationVar(&c.idleTimeout, "idle-timeout", http.DefaultIdleTimeout, "max idle time between requests")
+	fs.IntVar(&c.maxVersions, "max-versions", 0, "number of versions kept for each file, 0 keeps every version")
+	fs.DurationVar(&c.trashRetention, "trash-retention", 30*24*time.Hour, "how long removed files are kept before they are purged")
+	fs.DurationVar(&c.purgeInterval, "purge-interval", time.Hour, "how often the trash is purged, 0 disables purging")
+	fs.DurationVar(&c.uploadTimeout, "upload-timeout", time.Hour, "how long an upload can be inflight before it is reconciled")
+	fs.DurationVar(&c.reconcileInterval, "reconcile-interval", 10*time.Minute, "how often inflight uploads are reconciled, 0 disables reconciling")
+	fs.DurationVar(&c.gcGrace, "gc-grace", 24*time.Hour, "min age of a blob before it can be collected")
+	fs.DurationVar(&c.gcInterval, "gc-interval", 24*time.Hour, "how often unreferenced blobs are collected, 0 disables collecting")
+	fs.BoolVar(&c.noAuth, "no-auth", false, "serve requests without authentication, with full access")
+	fs.StringVar(&c.jwksFile, "jwks-file", "", "json web key set file used to verify jwts")
+	fs.StringVar(&c.oidcIssuer, "oidc-issuer", "", "openid connect issuer whose jwts are accepted, its keys are discovered unless --jwks-file is set")
+	fs.StringVar(&c.jwtAudience, "jwt-audience", "", "audience a jwt must be issued for, empty accepts any")
+	var shareKey string
+	if getenv != nil {
+		shareKey = getenv("SHARE_KEY")
+	}
+	fs.StringVar(&c.shareKey, "share-key", shareKey, "secret used to sign share and upload links, a random key is used if empty")
+	if err := c.store.flags(fs, getenv); err != nil {
+		return err
+	}
 	fs.Usage = func() {
 		fmt.Fprintf(fs.Output(), `
 The serve command initialises and runs a HTTP server.
@@ -54,9 +84,43 @@ Arguments:
 		fs.Usage()
 		return flag.ErrHelp
 	}
+	if c.noAuth && (c.jwksFile != "" || c.oidcIssuer != "") {
+		return fmt.Errorf("no-auth cannot be used with jwks-file or oidc-issuer")
+	}
 	return nil
 }
 
+// auth returns the authenticator of the server, nil if requests are not authenticated.
+func (c *serve) auth(ctx context.Context, fsys *fs.FS) (http.Authenticator, error) {
+	if c.noAuth {
+		return nil, nil
+	}
+	a := &http.Auth{FS: fsys}
+	var keys jwt.KeySet
+	switch {
+	case c.jwksFile != "":
+		b, err := os.ReadFile(c.jwksFile)
+		if err != nil {
+			return nil, err
+		}
+		if keys, err = jwt.ParseJWKS(b); err != nil {
+			return nil, err
+		}
+	case c.oidcIssuer != "":
+		ctx, cancel := context.WithTimeout(ctx, c.store.connectTimeout)
+		defer cancel()
+		var err error
+		if keys, err = jwt.Discover(ctx, nil, c.oidcIssuer); err != nil {
+			return nil, err
+		}
+	default:
+		// api keys only
+		return a, nil
+	}
+	a.JWT = &jwt.Verifier{Keys: keys, Issuer: c.oidcIssuer, Audience: c.jwtAudience, Leeway: time.Minute}
+	return a, nil
+}
+
 func (c *serve) run(ctx context.Context) error {
 	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, os.Kill)
 	defer cancel()
@@ -68,12 +132,28 @@ func (c *serve) run(ctx context.Context) error {
 	}
 	defer shutdown(ctx)
 
-	// create a grpc client that will be passed into the [http.Handler]
-	fsys := &fs.FS{ /* FIXME */ }
+	fsys, closeStore, err := c.store.open(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+	fsys.MaxVersions = c.maxVersions
+	if fsys.ShareKey = []byte(c.shareKey); len(fsys.ShareKey) == 0 {
+		fsys.ShareKey = make([]byte, 32)
+		if _, err := rand.Read(fsys.ShareKey); err != nil {
+			return fmt.Errorf("failed to generate share-key: %w", err)
+		}
+		logger.WarnContext(ctx, "share-key is not set, share and upload links do not outlive the server")
+	}
+
+	auth, err := c.auth(ctx, fsys)
+	if err != nil {
+		return err
+	}
 
 	hs := &http.Server{
 		Addr:           c.addr,
-		Handler:        http.Handler(c.rateLimit.N, c.rateLimit.D, fsys),
+		Handler:        http.Handler(c.rateLimit.N, c.rateLimit.D, fsys, auth),
 		BaseContext:    func(l net.Listener) context.Context { return ctx },
 		MaxHeaderBytes: c.maxHeaderBytes,
 		// todo: ReadHeaderTimeout uses ReadTimeout if not set
@@ -99,6 +179,40 @@ func (c *serve) run(ctx context.Context) error {
 		return err
 	})
 
+	eg.Go(func() error {
+		// complete or roll back abandoned uploads, starting with any left by a restart
+		reconcile := func(ctx context.Context) error {
+			n, m, err := fsys.Reconcile(ctx, time.Now().Add(-c.uploadTimeout))
+			debug.Printf(`%d, %d, %v := fsys.Reconcile(ctx, t)`, n, m, err)
+			return err
+		}
+		if c.reconcileInterval <= 0 {
+			return nil
+		}
+		if err := reconcile(ctx); err != nil {
+			logger.WarnContext(ctx, "failed to reconcile uploads", "error", err)
+		}
+		return every(ctx, "reconcile uploads", c.reconcileInterval, reconcile)
+	})
+
+	eg.Go(func() error {
+		// purge the trash
+		return every(ctx, "purge trash", c.purgeInterval, func(ctx context.Context) error {
+			n, err := fsys.Purge(ctx, time.Now().Add(-c.trashRetention))
+			debug.Printf(`%d, %v := fsys.Purge(ctx, t)`, n, err)
+			return err
+		})
+	})
+
+	eg.Go(func() error {
+		// collect unreferenced blobs
+		return every(ctx, "collect blobs", c.gcInterval, func(ctx context.Context) error {
+			stats, err := fsys.GC(ctx, fs.GCOptions{Before: time.Now().Add(-c.gcGrace)})
+			debug.Printf(`%+v, %v := fsys.GC(ctx, opts)`, stats, err)
+			return err
+		})
+	})
+
 	eg.Go(func() error {
 		// http close
 		<-ctx.Done()
@@ -114,3 +228,23 @@ func (c *serve) run(ctx context.Context) error {
 
 	return eg.Wait()
 }
+
+// every calls fn every d until ctx is cancelled. Errors returned by fn are logged
+// as failures to do task and do not stop the loop. If d is not positive, fn is never called.
+func every(ctx context.Context, task string, d time.Duration, fn func(context.Context) error) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTicker(d)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+			if err := fn(ctx); err != nil && ctx.Err() == nil {
+				logger.WarnContext(ctx, "failed to "+task, "error", err)
+			}
+		}
+	}
+}
@@ -15,6 +15,7 @@ import (
 func Test_serve_parse(t *testing.T) {
 	type testcase struct {
 		in   []string
+		env  map[string]string
 		want error
 	}
 
@@ -22,6 +23,13 @@ func Test_serve_parse(t *testing.T) {
 		"OKRate": {
 			in: []string{"--rate-limit", "1/10s"},
 		},
+		"OKEnv": {
+			env: map[string]string{"DATABASE_URL": "postgres://localhost:26257", "S3_PATH_STYLE": "true"},
+		},
+		"ErrEnv": {
+			env:  map[string]string{"DATABASE_MAX_CONNS": "abc"},
+			want: errParse,
+		},
 		"ErrTooManyArgs": {
 			in:   []string{"never"},
 			want: flag.ErrHelp,
@@ -29,8 +37,12 @@ func Test_serve_parse(t *testing.T) {
 	}
 	for name, tc := range tt {
 		t.Run(name, func(t *testing.T) {
-			err := (&serve{}).parse(tc.in, nil)
+			var s serve
+			err := s.parse(tc.in, func(key string) string { return tc.env[key] })
 			is.NotOK(t, err, tc.want) // got;want
+			if v, ok := tc.env["DATABASE_URL"]; ok {
+				is.Equal(t, s.store.dbURL, v) // got;want
+			}
 		})
 	}
 }
@@ -39,7 +51,7 @@ func Test_serve_run(t *testing.T) {
 	t.Run("OK", func(t *testing.T) {
 		var s serve
 		// random port?
-		err := s.parse([]string{"--http-address", ":8080"}, nil)
+		err := s.parse(append([]string{"--http-address", ":8080"}, newTestStore(t)...), nil)
 		is.OK(t, err)
 		// cancellable context is needed
 		ctx, cancel := context.WithCancel(context.Background())
@@ -58,6 +70,18 @@ func Test_serve_run(t *testing.T) {
 		})
 		is.OK(t, eg.Wait()) // service is ready
 	})
+
+	t.Run("ErrUnreachable", func(t *testing.T) {
+		var s serve
+		err := s.parse([]string{
+			"--http-address", ":8081",
+			"--database-url", "postgres://root@localhost:1/defaultdb?sslmode=disable",
+			"--s3-bucket", "eyeoh",
+			"--connect-timeout", "1s",
+		}, nil)
+		is.OK(t, err)
+		is.True(t, s.run(context.Background()) != nil) // fails fast
+	})
 }
 
 var options = func(r *http.Request) {
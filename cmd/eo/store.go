@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.adoublef/eyeoh/internal/blob"
+	"go.adoublef/eyeoh/internal/database/crdb"
+	"go.adoublef/eyeoh/internal/fs"
+)
+
+// store configures the database and blob storage backing a [fs.FS].
+type store struct {
+	dbURL                    string
+	dbMaxConns, dbMinConns   int
+	migrate                  bool
+	s3Endpoint, s3Region     string
+	s3Bucket                 string
+	s3AccessKey, s3SecretKey string
+	s3PathStyle              bool
+	connectTimeout           time.Duration
+}
+
+// flags registers the store arguments. Each default can be set with an environment variable,
+// a value that cannot be parsed is reported as the flag package reports a bad argument.
+func (s *store) flags(fs *flag.FlagSet, getenv func(string) string) error {
+	env := func(key, fallback string) string {
+		if getenv == nil {
+			return fallback
+		}
+		if v := getenv(key); v != "" {
+			return v
+		}
+		return fallback
+	}
+	var errs []error
+	parse := func(key string, fn func(string) error) {
+		if v := env(key, ""); v != "" {
+			if err := fn(v); err != nil {
+				errs = append(errs, fmt.Errorf("invalid value %q for $%s: %w", v, key, numError(err)))
+			}
+		}
+	}
+	atoi := func(key string) (n int) {
+		parse(key, func(v string) (err error) { n, err = strconv.Atoi(v); return err })
+		return n
+	}
+	parseBool := func(key string) (ok bool) {
+		parse(key, func(v string) (err error) { ok, err = strconv.ParseBool(v); return err })
+		return ok
+	}
+	fs.StringVar(&s.dbURL, "database-url", env("DATABASE_URL", ""), "cockroachdb connection string ($DATABASE_URL)")
+	fs.IntVar(&s.dbMaxConns, "database-max-conns", atoi("DATABASE_MAX_CONNS"), "max database pool size, 0 uses the driver default ($DATABASE_MAX_CONNS)")
+	fs.IntVar(&s.dbMinConns, "database-min-conns", atoi("DATABASE_MIN_CONNS"), "min database pool size ($DATABASE_MIN_CONNS)")
+	fs.BoolVar(&s.migrate, "migrate", parseBool("DATABASE_MIGRATE"), "run database migrations on start ($DATABASE_MIGRATE)")
+	fs.StringVar(&s.s3Endpoint, "s3-endpoint", env("S3_ENDPOINT", ""), "s3 endpoint, empty uses aws ($S3_ENDPOINT)")
+	fs.StringVar(&s.s3Region, "s3-region", env("S3_REGION", "auto"), "s3 region ($S3_REGION)")
+	fs.StringVar(&s.s3Bucket, "s3-bucket", env("S3_BUCKET", ""), "s3 bucket name ($S3_BUCKET)")
+	fs.StringVar(&s.s3AccessKey, "s3-access-key", env("S3_ACCESS_KEY_ID", ""), "s3 access key id, empty uses the default credential chain ($S3_ACCESS_KEY_ID)")
+	fs.StringVar(&s.s3SecretKey, "s3-secret-key", env("S3_SECRET_ACCESS_KEY", ""), "s3 secret access key ($S3_SECRET_ACCESS_KEY)")
+	fs.BoolVar(&s.s3PathStyle, "s3-path-style", parseBool("S3_PATH_STYLE"), "use path-style s3 addressing ($S3_PATH_STYLE)")
+	fs.DurationVar(&s.connectTimeout, "connect-timeout", 10*time.Second, "max duration to wait for the database and s3 on start")
+	return errors.Join(errs...)
+}
+
+var (
+	// errParse and errRange are the errors of a bad environment variable, as
+	// the flag package reports a bad argument.
+	errParse = errors.New("parse error")
+	errRange = errors.New("value out of range")
+)
+
+// numError returns the error of a failed [strconv] parse, without repeating the value.
+func numError(err error) error {
+	if errors.Is(err, strconv.ErrRange) {
+		return errRange
+	}
+	return errParse
+}
+
+// open connects to the database and the s3 bucket, failing if either is unreachable.
+// The returned close function releases the database pool.
+func (s *store) open(ctx context.Context) (fsys *fs.FS, close func(), err error) {
+	if s.dbURL == "" {
+		return nil, nil, errors.New("store: database url is required")
+	}
+	if s.s3Bucket == "" {
+		return nil, nil, errors.New("store: s3 bucket is required")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.connectTimeout)
+	defer cancel()
+
+	if s.migrate {
+		if err := crdb.Up(ctx, s.dbURL); err != nil {
+			return nil, nil, fmt.Errorf("store: %w", err)
+		}
+	}
+
+	conf, err := pgxpool.ParseConfig(s.dbURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("store: failed to parse database url: %w", err)
+	}
+	if s.dbMaxConns > 0 {
+		conf.MaxConns = int32(s.dbMaxConns)
+	}
+	if s.dbMinConns > 0 {
+		conf.MinConns = int32(s.dbMinConns)
+	}
+	pool, err := pgxpool.NewWithConfig(ctx, conf)
+	if err != nil {
+		return nil, nil, fmt.Errorf("store: failed to create database pool: %w", err)
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, nil, fmt.Errorf("store: database is unreachable: %w", err)
+	}
+
+	c, err := s.s3Client(ctx)
+	if err != nil {
+		pool.Close()
+		return nil, nil, err
+	}
+	if _, err := c.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: &s.s3Bucket}); err != nil {
+		pool.Close()
+		return nil, nil, fmt.Errorf("store: bucket %q is unreachable: %w", s.s3Bucket, err)
+	}
+
+	bc := blob.New(s.s3Bucket, c)
+	fsys = &fs.FS{
+		DB:           &fs.DB{RWC: pool},
+		Uploader:     bc,
+		Downloader:   bc,
+		Deleter:      bc,
+		Lister:       bc,
+		PartUploader: bc,
+	}
+	return fsys, pool.Close, nil
+}
+
+func (s *store) s3Client(ctx context.Context) (*s3.Client, error) {
+	opts := []func(*config.LoadOptions) error{config.WithRegion(s.s3Region)}
+	if s.s3AccessKey != "" {
+		cred := credentials.NewStaticCredentialsProvider(s.s3AccessKey, s.s3SecretKey, "")
+		opts = append(opts, config.WithCredentialsProvider(cred))
+	}
+	conf, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("store: failed to load s3 configuration: %w", err)
+	}
+	c := s3.NewFromConfig(conf, func(o *s3.Options) {
+		if s.s3Endpoint != "" {
+			o.BaseEndpoint = aws.String(s.s3Endpoint)
+		}
+		o.UsePathStyle = s.s3PathStyle
+	})
+	return c, nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	"go.adoublef/eyeoh/internal/fs"
+)
+
+var cmdUsers = &users{}
+
+type users struct {
+	admin           bool
+	issuer, subject string
+	name            fs.Name
+	store           store
+	stdout          io.Writer
+}
+
+func (c *users) parse(args []string, getenv func(string) string) error {
+	fs := flag.NewFlagSet("users", flag.ContinueOnError)
+	fs.BoolVar(&c.admin, "admin", false, "the user has full access")
+	fs.StringVar(&c.issuer, "issuer", "", "issuer of the jwts of the user, requires --subject")
+	fs.StringVar(&c.subject, "subject", "", "subject of the jwts of the user, requires --issuer")
+	if err := c.store.flags(fs, getenv); err != nil {
+		return err
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `
+The users command creates a user and prints its id.
+
+Usage:
+	%s users [arguments] NAME
+
+Arguments:
+`[1:], os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() != 1 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	if err := c.name.UnmarshalText([]byte(fs.Arg(0))); err != nil {
+		return err
+	}
+	if (c.issuer == "") != (c.subject == "") {
+		return fmt.Errorf("issuer and subject must be set together")
+	}
+	return nil
+}
+
+func (c *users) run(ctx context.Context) error {
+	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, os.Kill)
+	defer cancel()
+
+	fsys, closeStore, err := c.store.open(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	id, err := fsys.CreateUser(ctx, c.name, c.admin)
+	if err != nil {
+		return err
+	}
+	if c.issuer != "" {
+		if err := fsys.LinkIdentity(ctx, id, c.issuer, c.subject); err != nil {
+			return err
+		}
+	}
+	w := c.stdout
+	if w == nil {
+		w = os.Stdout
+	}
+	fmt.Fprintln(w, id)
+	return nil
+}
@@ -2,19 +2,23 @@ package blob
 
 import (
 	"io"
+	"path"
+	"strings"
 	"sync/atomic"
 
-	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/google/uuid"
 )
 
 type Client struct {
 	*Uploader
 	*Downloader
+	*Deleter
+	*Lister
+	*Multipart
 }
 
 type s3Client interface {
-	manager.UploadAPIClient
-	manager.DownloadAPIClient
+	MultipartAPIClient
 }
 
 // New returns a new [Client]
@@ -22,9 +26,25 @@ func New(bucket string, c s3Client) *Client {
 	return &Client{
 		Uploader:   NewUploader(bucket, c),
 		Downloader: NewDownloader(bucket, c),
+		Deleter:    NewDeleter(bucket, c),
+		Lister:     NewLister(bucket, c),
+		Multipart:  NewMultipart(bucket, c),
 	}
 }
 
+// prefix is the common prefix of every blob key.
+const prefix = "_blob/"
+
+// key returns the object key for the blob id.
+func key(id uuid.UUID) string {
+	// https://stackoverflow.com/questions/44852649/evenly-spread-files-in-directories-using-uuid-splits
+	// given a uuid, create a 2-level directory
+	// uuid does not _need_ to be sortable
+	// 01/23/456789...
+	s := strings.Replace(id.String(), "-", "", 4)
+	return prefix + path.Join(s[:2], s[2:4], s[4:])
+}
+
 type countReader struct {
 	n atomic.Int64
 	r io.Reader
@@ -0,0 +1,64 @@
+package blob
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/google/uuid"
+	"go.adoublef/eyeoh/internal/runtime/debug"
+)
+
+// maxDeleteObjects is the limit of keys in a single DeleteObjects request.
+const maxDeleteObjects = 1000
+
+// DeleteAPIClient is an S3 API client that can delete objects.
+type DeleteAPIClient interface {
+	DeleteObjects(context.Context, *s3.DeleteObjectsInput, ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error)
+}
+
+type Deleter struct {
+	bucket string
+	c      DeleteAPIClient
+}
+
+// Delete removes the blobs in batches. Blobs that do not exist are ignored.
+func (d *Deleter) Delete(ctx context.Context, ids ...uuid.UUID) error {
+	for len(ids) > 0 {
+		n := min(len(ids), maxDeleteObjects)
+		objs := make([]types.ObjectIdentifier, n)
+		for i, id := range ids[:n] {
+			objs[i] = types.ObjectIdentifier{Key: ptr(key(id))}
+		}
+		ids = ids[n:]
+
+		in := &s3.DeleteObjectsInput{
+			Bucket: &d.bucket,
+			Delete: &types.Delete{Objects: objs, Quiet: ptr(true)},
+		}
+		out, err := d.c.DeleteObjects(ctx, in)
+		if err != nil {
+			return Error(err)
+		}
+		debug.Printf(`%d := len(out.Errors)`, len(out.Errors))
+		if len(out.Errors) > 0 {
+			e := out.Errors[0]
+			return fmt.Errorf("blob: failed to delete %d objects: %s: %s", len(out.Errors), value(e.Key), value(e.Message))
+		}
+	}
+	return nil
+}
+
+func NewDeleter(bucket string, c DeleteAPIClient) *Deleter {
+	return &Deleter{bucket, c}
+}
+
+func ptr[V any](v V) *V { return &v }
+
+func value[V any](v *V) V {
+	if v == nil {
+		return *new(V)
+	}
+	return *v
+}
@@ -4,25 +4,31 @@ import (
 	"bufio"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
-	"path"
-	"strings"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/google/uuid"
 	"go.adoublef/eyeoh/internal/runtime/debug"
 )
 
+// DownloadAPIClient is an S3 API client that can read objects.
+type DownloadAPIClient interface {
+	manager.DownloadAPIClient
+	s3.HeadObjectAPIClient
+}
+
 type Downloader struct {
 	bucket string
 	m      *manager.Downloader // just have this as a global atomic?
+	c      DownloadAPIClient
 }
 
 func (d *Downloader) Download(ctx context.Context, id uuid.UUID) (rc io.ReadCloser, mime string, err error) {
-	s := strings.Replace(id.String(), "-", "", 4)
-	uri := path.Join("_blob", s[:2], s[2:4], s[4:])
+	uri := key(id)
 	// if the body is not used then this seems to not return an error
 	pr, pw := io.Pipe()
 	go func() {
@@ -31,7 +37,6 @@ func (d *Downloader) Download(ctx context.Context, id uuid.UUID) (rc io.ReadClos
 			Key:    &uri,
 			Bucket: &d.bucket,
 			// PartNumber *string
-			// Range *string
 		}
 		nw, err := d.m.Download(ctx, &writerAt{pw}, o)
 		if err != nil {
@@ -59,13 +64,49 @@ func (d *Downloader) Download(ctx context.Context, id uuid.UUID) (rc io.ReadClos
 	return br, http.DetectContentType(p), nil
 }
 
-func NewDownloader(bucket string, c manager.DownloadAPIClient) *Downloader {
+// DownloadRange returns the n bytes of the object id from off. Unlike [Downloader.Download],
+// only the bytes in the range are fetched. The range must be within the object.
+func (d *Downloader) DownloadRange(ctx context.Context, id uuid.UUID, off, n int64) (io.ReadCloser, error) {
+	uri := key(id)
+	o := &s3.GetObjectInput{
+		Key:    &uri,
+		Bucket: &d.bucket,
+		Range:  ptr(fmt.Sprintf("bytes=%d-%d", off, off+n-1)),
+	}
+	res, err := d.c.GetObject(ctx, o)
+	if err != nil {
+		return nil, Error(err)
+	}
+	return res.Body, nil
+}
+
+// Head returns the size and content type of the object id, without downloading it.
+// The content type is empty if it was not kept when the object was uploaded.
+func (d *Downloader) Head(ctx context.Context, id uuid.UUID) (sz int64, mime string, err error) {
+	uri := key(id)
+	o := &s3.HeadObjectInput{
+		Key:    &uri,
+		Bucket: &d.bucket,
+	}
+	res, err := d.c.HeadObject(ctx, o)
+	if err != nil {
+		return 0, "", Error(err)
+	}
+	switch mime = aws.ToString(res.ContentType); mime {
+	// set by s3 if the type was not given
+	case "binary/octet-stream", "application/octet-stream":
+		mime = ""
+	}
+	return aws.ToInt64(res.ContentLength), mime, nil
+}
+
+func NewDownloader(bucket string, c DownloadAPIClient) *Downloader {
 	d := manager.NewDownloader(c, func(u *manager.Downloader) {
 		u.PartSize = 1 << 24 // 16MB
 		// https://dev.to/flowup/using-io-reader-io-writer-in-go-to-stream-data-3i7b
 		u.Concurrency = 1 // force sequential writes
 	})
-	return &Downloader{bucket, d}
+	return &Downloader{bucket, d, c}
 }
 
 type readCloser struct {
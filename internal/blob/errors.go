@@ -17,7 +17,8 @@ func Error(err error) error {
 	}
 	// handling aws errors is so stupidly annoying
 	switch {
-	case errors.As(err, new(*types.NoSuchKey)):
+	case errors.As(err, new(*types.NoSuchKey)),
+		errors.As(err, new(*types.NotFound)):
 		return ErrNotExist
 	}
 	return err
@@ -0,0 +1,58 @@
+package blob
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/google/uuid"
+)
+
+// ListAPIClient is an S3 API client that can list objects.
+type ListAPIClient = s3.ListObjectsV2APIClient
+
+type Lister struct {
+	bucket string
+	c      ListAPIClient
+}
+
+// List calls fn for each blob in the bucket, in key order. Objects that were not
+// written by an [Uploader] are skipped. If fn returns an error, listing stops.
+func (l *Lister) List(ctx context.Context, fn func(id uuid.UUID, sz int64, modTime time.Time) error) error {
+	in := &s3.ListObjectsV2Input{
+		Bucket: &l.bucket,
+		Prefix: ptr(prefix),
+	}
+	p := s3.NewListObjectsV2Paginator(l.c, in)
+	for p.HasMorePages() {
+		out, err := p.NextPage(ctx)
+		if err != nil {
+			return Error(err)
+		}
+		for _, o := range out.Contents {
+			id, ok := parseKey(value(o.Key))
+			if !ok {
+				continue
+			}
+			if err := fn(id, value(o.Size), value(o.LastModified)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func NewLister(bucket string, c ListAPIClient) *Lister {
+	return &Lister{bucket, c}
+}
+
+// parseKey returns the blob id of an object key returned by [key].
+func parseKey(k string) (uuid.UUID, bool) {
+	s, ok := strings.CutPrefix(k, prefix)
+	if !ok {
+		return uuid.Nil, false
+	}
+	id, err := uuid.Parse(strings.ReplaceAll(s, "/", ""))
+	return id, err == nil && key(id) == k
+}
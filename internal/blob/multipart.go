@@ -0,0 +1,237 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/google/uuid"
+	"go.adoublef/eyeoh/internal/runtime/debug"
+)
+
+// partSize is the size of every part but the last, the minimum allowed by S3.
+const partSize = 5 << 20
+
+// MultipartAPIClient is an S3 API client that can write an object in parts.
+type MultipartAPIClient interface {
+	manager.UploadAPIClient
+	DownloadAPIClient
+	DeleteAPIClient
+	ListAPIClient
+	ListParts(context.Context, *s3.ListPartsInput, ...func(*s3.Options)) (*s3.ListPartsOutput, error)
+}
+
+// Multipart writes a blob with appends that can be resumed after a failure.
+//
+// Each append fills fixed-size parts of an S3 multipart upload. Bytes that do
+// not fill a part are held in a temporary object, which is only ever extended,
+// until the next append completes the part. The caller records the offset, so
+// an append that fails is repeated from the last recorded offset.
+type Multipart struct {
+	bucket string
+	c      MultipartAPIClient
+}
+
+// BeginParts starts a multipart upload of the blob id, returning its upload id.
+func (m *Multipart) BeginParts(ctx context.Context, id uuid.UUID) (upload string, err error) {
+	in := &s3.CreateMultipartUploadInput{
+		Bucket: &m.bucket,
+		Key:    ptr(key(id)),
+	}
+	out, err := m.c.CreateMultipartUpload(ctx, in)
+	if err != nil {
+		return "", Error(err)
+	}
+	return value(out.UploadId), nil
+}
+
+// AppendParts writes the content of r to the blob from off, which must be the end
+// of the previous append. It returns the number of bytes read from r. If reading r
+// fails, the bytes read before are kept and the error is returned with their count.
+func (m *Multipart) AppendParts(ctx context.Context, id uuid.UUID, upload string, off int64, r io.Reader) (n int64, err error) {
+	part, buf, err := m.tail(ctx, id, off)
+	if err != nil {
+		return 0, err
+	}
+	var rerr error
+	for {
+		nr, err := io.CopyN(buf, r, int64(partSize-buf.Len()))
+		n += nr
+		if buf.Len() < partSize {
+			if err != nil && err != io.EOF {
+				rerr = err
+			}
+			break
+		}
+		if err := m.uploadPart(ctx, id, upload, part, buf.Bytes()); err != nil {
+			return 0, err
+		}
+		part++
+		buf.Reset()
+	}
+	// an empty tail is never read, as the offset is at the start of a part
+	if buf.Len() > 0 {
+		in := &s3.PutObjectInput{
+			Bucket: &m.bucket,
+			Key:    ptr(tailKey(id, part)),
+			Body:   bytes.NewReader(buf.Bytes()),
+		}
+		if _, err := m.c.PutObject(ctx, in); err != nil {
+			return 0, Error(err)
+		}
+	}
+	debug.Printf(`%d, %v := m.AppendParts(ctx, %q, _, %d, r)`, n, rerr, id, off)
+	return n, rerr
+}
+
+// CompleteParts writes the last part of the blob, which is sz bytes in total, and
+// completes the multipart upload.
+func (m *Multipart) CompleteParts(ctx context.Context, id uuid.UUID, upload string, sz int64) error {
+	part, buf, err := m.tail(ctx, id, sz)
+	if err != nil {
+		return err
+	}
+	// an empty blob still needs a part
+	last := part - 1
+	if buf.Len() > 0 || part == 1 {
+		if err := m.uploadPart(ctx, id, upload, part, buf.Bytes()); err != nil {
+			return err
+		}
+		last = part
+	}
+
+	var parts []types.CompletedPart
+	in := &s3.ListPartsInput{
+		Bucket:   &m.bucket,
+		Key:      ptr(key(id)),
+		UploadId: &upload,
+	}
+	for {
+		out, err := m.c.ListParts(ctx, in)
+		if err != nil {
+			return Error(err)
+		}
+		for _, p := range out.Parts {
+			if value(p.PartNumber) > last {
+				continue
+			}
+			parts = append(parts, types.CompletedPart{ETag: p.ETag, PartNumber: p.PartNumber})
+		}
+		if !value(out.IsTruncated) {
+			break
+		}
+		in.PartNumberMarker = out.NextPartNumberMarker
+	}
+	if len(parts) != int(last) {
+		return fmt.Errorf("blob: multipart upload has %d of %d parts", len(parts), last)
+	}
+	cin := &s3.CompleteMultipartUploadInput{
+		Bucket:          &m.bucket,
+		Key:             ptr(key(id)),
+		UploadId:        &upload,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	}
+	if _, err := m.c.CompleteMultipartUpload(ctx, cin); err != nil {
+		return Error(err)
+	}
+	return m.deleteTails(ctx, id)
+}
+
+// AbortParts stops the multipart upload and deletes anything it wrote.
+func (m *Multipart) AbortParts(ctx context.Context, id uuid.UUID, upload string) error {
+	in := &s3.AbortMultipartUploadInput{
+		Bucket:   &m.bucket,
+		Key:      ptr(key(id)),
+		UploadId: &upload,
+	}
+	// the upload is gone if it was aborted before
+	if _, err := m.c.AbortMultipartUpload(ctx, in); err != nil && !errors.As(err, new(*types.NoSuchUpload)) {
+		return Error(err)
+	}
+	return m.deleteTails(ctx, id)
+}
+
+// tail returns the number of the part that contains off and the bytes of that part before it.
+func (m *Multipart) tail(ctx context.Context, id uuid.UUID, off int64) (part int32, buf *bytes.Buffer, err error) {
+	part, sz := int32(off/partSize)+1, off%partSize
+	buf = bytes.NewBuffer(make([]byte, 0, partSize))
+	if sz == 0 {
+		return part, buf, nil
+	}
+	// later appends may have extended the tail, but the bytes before off are the same
+	in := &s3.GetObjectInput{
+		Bucket: &m.bucket,
+		Key:    ptr(tailKey(id, part)),
+		Range:  ptr(fmt.Sprintf("bytes=0-%d", sz-1)),
+	}
+	out, err := m.c.GetObject(ctx, in)
+	if err != nil {
+		return 0, nil, Error(err)
+	}
+	defer out.Body.Close()
+	if _, err := io.CopyN(buf, out.Body, sz); err != nil {
+		return 0, nil, err
+	}
+	return part, buf, nil
+}
+
+func (m *Multipart) uploadPart(ctx context.Context, id uuid.UUID, upload string, part int32, p []byte) error {
+	in := &s3.UploadPartInput{
+		Bucket:     &m.bucket,
+		Key:        ptr(key(id)),
+		UploadId:   &upload,
+		PartNumber: &part,
+		Body:       bytes.NewReader(p),
+	}
+	_, err := m.c.UploadPart(ctx, in)
+	return Error(err)
+}
+
+func (m *Multipart) deleteTails(ctx context.Context, id uuid.UUID) error {
+	in := &s3.ListObjectsV2Input{
+		Bucket: &m.bucket,
+		Prefix: ptr(tailPrefix + id.String() + "/"),
+	}
+	// a page has no more keys than a single request can delete
+	p := s3.NewListObjectsV2Paginator(m.c, in)
+	for p.HasMorePages() {
+		out, err := p.NextPage(ctx)
+		if err != nil {
+			return Error(err)
+		}
+		if len(out.Contents) == 0 {
+			continue
+		}
+		objs := make([]types.ObjectIdentifier, len(out.Contents))
+		for i, o := range out.Contents {
+			objs[i] = types.ObjectIdentifier{Key: o.Key}
+		}
+		din := &s3.DeleteObjectsInput{
+			Bucket: &m.bucket,
+			Delete: &types.Delete{Objects: objs, Quiet: ptr(true)},
+		}
+		if _, err := m.c.DeleteObjects(ctx, din); err != nil {
+			return Error(err)
+		}
+	}
+	return nil
+}
+
+func NewMultipart(bucket string, c MultipartAPIClient) *Multipart {
+	return &Multipart{bucket, c}
+}
+
+// tailPrefix is the common prefix of the temporary objects of a [Multipart].
+const tailPrefix = "_tus/"
+
+// tailKey returns the key of the temporary object that holds the start of a part.
+func tailKey(id uuid.UUID, part int32) string {
+	return tailPrefix + path.Join(id.String(), strconv.Itoa(int(part)))
+}
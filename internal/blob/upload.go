@@ -1,10 +1,10 @@
 package blob
 
 import (
+	"bufio"
 	"context"
 	"io"
-	"path"
-	"strings"
+	"net/http"
 
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
@@ -18,29 +18,26 @@ type Uploader struct {
 	m *manager.Uploader
 }
 
-func (u Uploader) Upload(ctx context.Context, r io.Reader) (id uuid.UUID, sz int64, err error) {
-	id, err = uuid.NewV7()
-	if err != nil {
-		return uuid.Nil, 0, err
-	}
-	// https://stackoverflow.com/questions/44852649/evenly-spread-files-in-directories-using-uuid-splits
-	// given a uuid, create a 2-level directory
-	// uuid does not _need_ to be sortable
-	// 01/23/456789...
-	s := strings.Replace(id.String(), "-", "", 4)
-	uri := path.Join("_blob", s[:2], s[2:4], s[4:])
-	cr := &countReader{r: r}
+// Upload writes the content of r to the object for id, returning the number of bytes written.
+func (u Uploader) Upload(ctx context.Context, id uuid.UUID, r io.Reader) (sz int64, err error) {
+	uri := key(id)
+	// the content type is kept with the object, so that it can be read with
+	// [Downloader.Head]. An error reading is returned by the upload.
+	br := bufio.NewReaderSize(r, 512)
+	p, _ := br.Peek(512)
+	cr := &countReader{r: br}
 	in := &s3.PutObjectInput{
-		Key:    &uri,
-		Bucket: &u.bucket,
-		Body:   cr,
+		Key:         &uri,
+		Bucket:      &u.bucket,
+		Body:        cr,
+		ContentType: ptr(http.DetectContentType(p)),
 	}
 	out, err := u.m.Upload(ctx, in)
 	if err != nil {
-		return uuid.Nil, 0, err
+		return 0, err
 	}
 	debug.Printf("%v := out.ETag", out.ETag)
-	return id, cr.n.Load(), nil
+	return cr.n.Load(), nil
 }
 
 func NewUploader(bucket string, c manager.UploadAPIClient) *Uploader {
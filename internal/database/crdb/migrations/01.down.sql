@@ -0,0 +1 @@
+alter table fs.blob_data drop column ref;
@@ -0,0 +1,3 @@
+-- blob data can be shared by many entries (i.e. copies) without a new object.
+-- ref is the object the row points to, if null the object is the row id.
+alter table fs.blob_data add column ref uuid;
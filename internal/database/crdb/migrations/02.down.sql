@@ -0,0 +1,2 @@
+drop table fs.trash;
+alter table fs.dir_entry drop column del;
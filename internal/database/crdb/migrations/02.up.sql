@@ -0,0 +1,18 @@
+-- entries in the trash are hidden until they are restored or purged.
+-- del is the id of the entry that was removed, shared by its whole subtree.
+alter table fs.dir_entry add column del uuid;
+
+create table fs.trash (
+  -- the removed entry, renamed to its id so the name can be reused
+  id uuid
+  -- original parent & name for restoring
+  , root uuid
+  , name text not null
+  -- top-level directory the entry was removed from, null if it was top-level
+  , tree uuid
+  , del_at timestamptz not null default now()
+  , foreign key (id) references fs.dir_entry (id)
+  , primary key (id)
+);
+
+create index on fs.trash (tree, del_at);
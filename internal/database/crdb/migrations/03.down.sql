@@ -0,0 +1,3 @@
+drop index fs.blob_data@blob_data_dir_entry_v_idx;
+
+alter table fs.dir_entry drop column max_v;
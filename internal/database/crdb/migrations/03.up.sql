@@ -0,0 +1,4 @@
+-- the number of versions kept for a file, null uses the deployment default.
+alter table fs.dir_entry add column max_v int check (max_v > 0);
+
+create index blob_data_dir_entry_v_idx on fs.blob_data (dir_entry, v desc);
@@ -0,0 +1,6 @@
+drop index up.inflight@inflight_mod_at_idx;
+drop index up.inflight@inflight_root_name_key cascade;
+
+alter table up.inflight drop column mod_at;
+alter table up.inflight drop column v;
+alter table up.inflight drop column dir_entry;
@@ -0,0 +1,10 @@
+-- an upload is recorded before its content is streamed, so a failure on either side
+-- can be completed or rolled back. the id is the id of the blob being written.
+-- dir_entry & v are set when the content of an existing file is replaced.
+alter table up.inflight add column dir_entry uuid;
+alter table up.inflight add column v int;
+alter table up.inflight add column mod_at timestamptz default now();
+
+-- a name can only be uploaded to once at a time
+create unique index inflight_root_name_key on up.inflight (coalesce(root, b'0000000000000000'), name);
+create index inflight_mod_at_idx on up.inflight (mod_at);
@@ -0,0 +1 @@
+drop index fs.blob_data@blob_data_ref_idx;
@@ -0,0 +1,2 @@
+-- blobs are looked up by the object they point at when collecting garbage.
+create index blob_data_ref_idx on fs.blob_data (ref);
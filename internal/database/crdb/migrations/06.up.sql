@@ -0,0 +1,12 @@
+-- each object in the blob store, shared by every version with the same content.
+-- refs is the number of fs.blob_data rows that point at the object.
+create table fs.blob (
+  id uuid
+  , sha bytes not null
+  , sz int not null default 0 check (sz >= 0)
+  , refs int not null default 0 check (refs >= 0)
+  , mod_at timestamptz default now()
+  , primary key (id)
+);
+
+create index blob_sha_idx on fs.blob (sha, sz);
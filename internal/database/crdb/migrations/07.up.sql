@@ -0,0 +1,5 @@
+-- objects written before deduplication are counted by the versions that point at them.
+insert into fs.blob (id, sha, sz, refs)
+select coalesce(ref, id), max(sha), max(sz), count(*)
+from fs.blob_data
+group by coalesce(ref, id);
@@ -0,0 +1,4 @@
+alter table up.inflight drop column lock_at;
+alter table up.inflight drop column off;
+alter table up.inflight drop column len;
+alter table up.inflight drop column mp_id;
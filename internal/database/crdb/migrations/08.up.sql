@@ -0,0 +1,8 @@
+-- resumable uploads are written in parts. mp_id is the multipart upload, len is
+-- the total size, off is the number of bytes written, and sha holds the state of
+-- the running hash until the upload is written. lock_at is set while an append is
+-- in progress, so only one can write at a time.
+alter table up.inflight add column mp_id text;
+alter table up.inflight add column len int check (len >= 0);
+alter table up.inflight add column off int default 0 check (off >= 0);
+alter table up.inflight add column lock_at timestamptz;
@@ -0,0 +1,12 @@
+-- the space used by the live files within each directory, kept up to date as
+-- versions are added and removed. latest counts the latest version of each file
+-- and total counts every version. the row of the top-level directory has the nil
+-- id, and phys is the size of the objects in the blob store, counted only there.
+create table fs.usage (
+  id uuid
+  , files int not null default 0
+  , latest int not null default 0
+  , total int not null default 0
+  , phys int not null default 0
+  , primary key (id)
+);
@@ -0,0 +1,26 @@
+-- directories are credited with every live file beneath them.
+with recursive
+  f (id, root, latest, total) as (
+    select d.id
+      , d.root
+      , (select sz from fs.blob_data where dir_entry = d.id order by v desc limit 1)
+      , (select sum(sz) from fs.blob_data where dir_entry = d.id)
+    from fs.dir_entry d
+    where d.del is null and exists (select 1 from fs.blob_data where dir_entry = d.id)
+  ),
+  ancestor (file, id) as (
+    select id, root from f where root is not null
+    union all
+    select a.file, d.root from ancestor a join fs.dir_entry d on d.id = a.id
+    where d.root is not null
+  )
+insert into fs.usage (id, files, latest, total)
+select a.id, count(*), sum(f.latest), sum(f.total)
+from ancestor a join f on f.id = a.file
+group by a.id
+union all
+select '00000000-0000-0000-0000-000000000000', count(*), coalesce(sum(latest), 0), coalesce(sum(total), 0)
+from f;
+
+update fs.usage set phys = (select coalesce(sum(sz), 0) from fs.blob)
+where id = '00000000-0000-0000-0000-000000000000';
@@ -0,0 +1 @@
+drop table fs.quota;
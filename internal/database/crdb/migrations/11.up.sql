@@ -0,0 +1,12 @@
+-- quotas limit the space used by a top-level directory, as counted by fs.usage.
+-- max_* are hard limits that fail writes and soft_* are only reported. a null
+-- limit is unlimited.
+create table fs.quota (
+  id uuid
+  , max_sz int check (max_sz >= 0)
+  , max_files int check (max_files >= 0)
+  , soft_sz int check (soft_sz >= 0)
+  , soft_files int check (soft_files >= 0)
+  , foreign key (id) references fs.dir_entry (id) on delete cascade
+  , primary key (id)
+);
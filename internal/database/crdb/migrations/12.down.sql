@@ -0,0 +1,5 @@
+alter table up.inflight drop column owner;
+alter table fs.dir_entry drop column owner;
+drop table fs.acl;
+drop table fs.member;
+drop table fs.principal;
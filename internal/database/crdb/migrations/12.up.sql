@@ -0,0 +1,38 @@
+-- principals are the users and groups that are granted access to entries.
+-- an admin user can access every entry.
+create table fs.principal (
+  id uuid
+  , name text not null check (name <> '' and length(name) < 256)
+  , grp bool not null default false
+  , admin bool not null default false
+  , created_at timestamptz not null default now()
+  , unique (name)
+  , primary key (id)
+);
+
+create table fs.member (
+  grp uuid
+  , usr uuid
+  , foreign key (grp) references fs.principal (id) on delete cascade
+  , foreign key (usr) references fs.principal (id) on delete cascade
+  , primary key (grp, usr)
+);
+
+create index on fs.member (usr);
+
+-- acl entries grant a principal access to an entry and everything below it,
+-- unless an entry below has its own acl entries for the principal. perm is
+-- 0 (none), 1 (read), 2 (write) or 3 (admin).
+create table fs.acl (
+  dir_entry uuid
+  , principal uuid
+  , perm int not null check (perm between 0 and 3)
+  , foreign key (dir_entry) references fs.dir_entry (id) on delete cascade
+  , foreign key (principal) references fs.principal (id) on delete cascade
+  , primary key (dir_entry, principal)
+);
+
+-- the owner has admin access to the entry, null if it was created without a user.
+-- uploads keep the user that started them until they are committed.
+alter table fs.dir_entry add column owner uuid;
+alter table up.inflight add column owner uuid;
@@ -0,0 +1,2 @@
+drop table fs.identity;
+drop table fs.api_key;
@@ -0,0 +1,25 @@
+-- api keys authenticate a user. only the hash of the secret is kept, the key
+-- can no longer be used once it expires or is revoked.
+create table fs.api_key (
+  id uuid
+  , usr uuid not null
+  , name text not null default ''
+  , hash bytes not null
+  , created_at timestamptz not null default now()
+  , expires_at timestamptz
+  , revoked_at timestamptz
+  , foreign key (usr) references fs.principal (id) on delete cascade
+  , primary key (id)
+);
+
+create index on fs.api_key (usr);
+
+-- identities link a user to the subject of an identity provider, so that a jwt
+-- issued for the subject authenticates the user.
+create table fs.identity (
+  iss text
+  , sub text
+  , usr uuid not null
+  , foreign key (usr) references fs.principal (id) on delete cascade
+  , primary key (iss, sub)
+);
@@ -0,0 +1,14 @@
+-- capabilities are tokens minted by a user that can only do part of what the
+-- user can. the root key signs the token and is needed to verify it, so unlike
+-- api keys it is kept as is.
+create table fs.capability (
+  id uuid
+  , usr uuid not null
+  , key bytes not null
+  , created_at timestamptz not null default now()
+  , revoked_at timestamptz
+  , foreign key (usr) references fs.principal (id) on delete cascade
+  , primary key (id)
+);
+
+create index on fs.capability (usr);
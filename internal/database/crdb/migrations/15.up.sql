@@ -0,0 +1,18 @@
+-- share links give access to an entry, and the entries below it, to anyone with
+-- the link. the link is signed, so only the bcrypt hash of the optional password
+-- is kept.
+create table fs.share (
+  id uuid
+  , dir_entry uuid not null
+  , owner uuid
+  , pass_hash bytes
+  , max_downloads int8
+  , downloads int8 not null default 0
+  , created_at timestamptz not null default now()
+  , expires_at timestamptz not null
+  , revoked_at timestamptz
+  , foreign key (dir_entry) references fs.dir_entry (id) on delete cascade
+  , primary key (id)
+);
+
+create index on fs.share (dir_entry);
@@ -0,0 +1,3 @@
+alter table up.inflight drop column upload_link;
+alter table fs.dir_entry drop column upload_link;
+drop table fs.upload_link;
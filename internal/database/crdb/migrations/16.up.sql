@@ -0,0 +1,22 @@
+-- upload links let anyone with the link add files to a directory, without
+-- reading it. uploads counts the files added, or being added, with the link.
+create table fs.upload_link (
+  id uuid
+  , dir_entry uuid not null
+  , owner uuid
+  , max_files int8 check (max_files > 0)
+  , max_sz int8 check (max_sz > 0)
+  , content_types string[]
+  , uploads int8 not null default 0
+  , created_at timestamptz not null default now()
+  , expires_at timestamptz not null
+  , revoked_at timestamptz
+  , foreign key (dir_entry) references fs.dir_entry (id) on delete cascade
+  , primary key (id)
+);
+
+create index on fs.upload_link (dir_entry);
+
+-- files added with an upload link are attributed to it.
+alter table fs.dir_entry add column upload_link uuid;
+alter table up.inflight add column upload_link uuid;
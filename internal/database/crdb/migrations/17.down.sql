@@ -0,0 +1,14 @@
+with top (id) as (
+  select id from fs.dir_entry where root is null and del is null
+),
+latest (sz) as (
+  select distinct on (dir_entry) sz from fs.blob_data
+  where dir_entry in (select id from top)
+  order by dir_entry, v desc
+)
+insert into fs.usage (id, files, latest, total, phys)
+select '00000000-0000-0000-0000-000000000000'
+  , coalesce((select sum(files) from fs.usage where id in (select id from top)), 0) + (select count(*) from latest)
+  , coalesce((select sum(latest) from fs.usage where id in (select id from top)), 0) + (select coalesce(sum(sz), 0) from latest)
+  , coalesce((select sum(total) from fs.usage where id in (select id from top)), 0) + (select coalesce(sum(sz), 0) from fs.blob_data where dir_entry in (select id from top))
+  , (select coalesce(sum(sz), 0) from fs.blob);
@@ -0,0 +1 @@
+alter table fs.usage add column phys int not null default 0;
@@ -0,0 +1,2 @@
+-- the size of the objects in the blob store is summed from fs.blob when it is read.
+alter table fs.usage drop column phys;
@@ -0,0 +1 @@
+drop table fs.usage_shard;
@@ -0,0 +1,10 @@
+-- the usage of the whole tree, and the size of the objects in the blob store, are
+-- kept in a few shards, so that writes are spread across rows and reads sum them.
+create table fs.usage_shard (
+  shard int
+  , files int not null default 0
+  , latest int not null default 0
+  , total int not null default 0
+  , phys int not null default 0
+  , primary key (shard)
+);
@@ -0,0 +1 @@
+delete from fs.usage_shard;
@@ -0,0 +1,11 @@
+-- the first shard is credited with every live file and every object.
+with f (latest, total) as (
+  select (select sz from fs.blob_data where dir_entry = d.id order by v desc limit 1)
+    , (select sum(sz) from fs.blob_data where dir_entry = d.id)
+  from fs.dir_entry d
+  where d.del is null and exists (select 1 from fs.blob_data where dir_entry = d.id)
+)
+insert into fs.usage_shard (shard, files, latest, total, phys)
+select 0, count(*), coalesce(sum(latest), 0), coalesce(sum(total), 0)
+  , (select coalesce(sum(sz), 0) from fs.blob)
+from f;
@@ -8,4 +8,6 @@ var (
 	ErrExist      = errors.New("already exists")
 	ErrNotExist   = errors.New("does not exist")
 	ErrClosed     = errors.New("already closed")
+	ErrStale      = errors.New("stale version")
+	ErrQuota      = errors.New("quota exceeded")
 )
@@ -0,0 +1,394 @@
+package fs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	dberrors "go.adoublef/eyeoh/internal/database/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Perm is the access a principal has to an entry and, unless an entry below has
+// its own, to everything below it. Each level includes the ones before it.
+type Perm int
+
+const (
+	// PermNone denies access, which overrides access granted above.
+	PermNone Perm = iota
+	// PermRead allows reading the content and listing directories.
+	PermRead
+	// PermWrite allows creating, changing and removing entries.
+	PermWrite
+	// PermAdmin allows changing the access of others.
+	PermAdmin
+)
+
+var permNames = [...]string{PermNone: "none", PermRead: "read", PermWrite: "write", PermAdmin: "admin"}
+
+func (p Perm) String() string {
+	if p < 0 || int(p) >= len(permNames) {
+		return fmt.Sprintf("Perm(%d)", int(p))
+	}
+	return permNames[p]
+}
+
+func (p Perm) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *Perm) UnmarshalText(text []byte) (err error) {
+	*p, err = ParsePerm(string(text))
+	return err
+}
+
+// ParsePerm returns the [Perm] for the name, as returned by [Perm.String].
+func ParsePerm(s string) (Perm, error) {
+	for i, name := range permNames {
+		if s == name {
+			return Perm(i), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid permission: %q", s)
+}
+
+type userKey struct{}
+
+// WithUser returns a copy of ctx that acts as user. Without a user, calls are
+// made by the system and are not checked, as for background jobs.
+func WithUser(ctx context.Context, user uuid.UUID) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// UserFromContext returns the user ctx acts as, if any.
+func UserFromContext(ctx context.Context) (uuid.UUID, bool) {
+	user, ok := ctx.Value(userKey{}).(uuid.UUID)
+	return user, ok
+}
+
+// Principal is a user or a group of users that is granted access to entries.
+type Principal struct {
+	ID    uuid.UUID `json:"id"`
+	Name  Name      `json:"name"`
+	Group bool      `json:"group"`
+	// Admin users can access every entry.
+	Admin     bool      `json:"admin"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ACLEntry grants the principal access to an entry.
+type ACLEntry struct {
+	Principal uuid.UUID `json:"principalId"`
+	Perm      Perm      `json:"perm"`
+}
+
+// CreateUser creates a user named name. Only an admin can create users.
+func (d *DB) CreateUser(ctx context.Context, name Name, admin bool) (uuid.UUID, error) {
+	return d.createPrincipal(ctx, "DB.CreateUser", name, false, admin)
+}
+
+// CreateGroup creates a group named name. Only an admin can create groups.
+func (d *DB) CreateGroup(ctx context.Context, name Name) (uuid.UUID, error) {
+	return d.createPrincipal(ctx, "DB.CreateGroup", name, true, false)
+}
+
+func (d *DB) createPrincipal(ctx context.Context, spanName string, name Name, grp, admin bool) (id uuid.UUID, err error) {
+	const query = `insert into fs.principal (id, name, grp, admin) values ($1, $2, $3, $4)`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("principal.name", name.String()),
+	)
+	ctx, span := tracer.Start(ctx, spanName, attr)
+	defer span.End()
+
+	if id, err = uuid.NewV7(); err != nil {
+		return uuid.Nil, Error(err)
+	}
+	err = pgx.BeginTxFunc(ctx, d.RWC, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		if err := authorize(ctx, tx, uuid.Nil, PermAdmin); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, query, id, name, grp, admin)
+		return err
+	})
+	if err != nil {
+		return uuid.Nil, Error(err)
+	}
+	return id, nil
+}
+
+const selectPrincipal = `select id, name, grp, admin, created_at from fs.principal `
+
+// Principal returns the user or group id.
+func (d *DB) Principal(ctx context.Context, id uuid.UUID) (Principal, error) {
+	const query = selectPrincipal + `where id = $1`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("principal.id", id.String()),
+	)
+	ctx, span := tracer.Start(ctx, "DB.Principal", attr)
+	defer span.End()
+
+	return scanPrincipal(d.RWC.QueryRow(ctx, query, id))
+}
+
+// PrincipalByName returns the user or group named name.
+func (d *DB) PrincipalByName(ctx context.Context, name Name) (Principal, error) {
+	const query = selectPrincipal + `where name = $1`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("principal.name", name.String()),
+	)
+	ctx, span := tracer.Start(ctx, "DB.PrincipalByName", attr)
+	defer span.End()
+
+	return scanPrincipal(d.RWC.QueryRow(ctx, query, name))
+}
+
+func scanPrincipal(row pgx.Row) (Principal, error) {
+	var p Principal
+	err := row.Scan(&p.ID, &p.Name, &p.Group, &p.Admin, &p.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return Principal{}, fmt.Errorf("fs: no principal: %w", dberrors.ErrNotExist)
+	} else if err != nil {
+		return Principal{}, Error(err)
+	}
+	return p, nil
+}
+
+// AddMember adds the user to the group. Only an admin can change a group.
+func (d *DB) AddMember(ctx context.Context, grp, user uuid.UUID) error {
+	const query = `insert into fs.member (grp, usr) values ($1, $2) on conflict do nothing`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("principal.group", grp.String()),
+		attribute.String("principal.user", user.String()),
+	)
+	ctx, span := tracer.Start(ctx, "DB.AddMember", attr)
+	defer span.End()
+
+	err := pgx.BeginTxFunc(ctx, d.RWC, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		if err := authorize(ctx, tx, uuid.Nil, PermAdmin); err != nil {
+			return err
+		}
+		var ok bool
+		const exists = `select exists (select 1 from fs.principal where id = $1 and grp)
+	and exists (select 1 from fs.principal where id = $2 and not grp)`
+		if err := tx.QueryRow(ctx, exists, grp, user).Scan(&ok); err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("fs: no group or user: %w", dberrors.ErrNotExist)
+		}
+		_, err := tx.Exec(ctx, query, grp, user)
+		return err
+	})
+	return Error(err)
+}
+
+// RemoveMember removes the user from the group. Only an admin can change a group.
+func (d *DB) RemoveMember(ctx context.Context, grp, user uuid.UUID) error {
+	const query = `delete from fs.member where grp = $1 and usr = $2`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("principal.group", grp.String()),
+		attribute.String("principal.user", user.String()),
+	)
+	ctx, span := tracer.Start(ctx, "DB.RemoveMember", attr)
+	defer span.End()
+
+	err := pgx.BeginTxFunc(ctx, d.RWC, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		if err := authorize(ctx, tx, uuid.Nil, PermAdmin); err != nil {
+			return err
+		}
+		cmd, err := tx.Exec(ctx, query, grp, user)
+		if err != nil {
+			return err
+		}
+		if err := mustRowsAffected(cmd); err != nil {
+			return fmt.Errorf("fs: user is not a member: %w", dberrors.ErrNotExist)
+		}
+		return nil
+	})
+	return Error(err)
+}
+
+// ACL returns the access granted on file itself, not including that inherited
+// from above. It needs admin access to file.
+func (d *DB) ACL(ctx context.Context, file uuid.UUID) ([]ACLEntry, error) {
+	const query = `select principal, perm from fs.acl where dir_entry = $1 order by principal`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("file.id", file.String()),
+	)
+	ctx, span := tracer.Start(ctx, "DB.ACL", attr)
+	defer span.End()
+
+	if err := authorize(ctx, d.RWC, file, PermAdmin); err != nil {
+		return nil, Error(err)
+	}
+	rows, err := d.RWC.Query(ctx, query, file)
+	if err != nil {
+		return nil, Error(err)
+	}
+	acl, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (ACLEntry, error) {
+		var e ACLEntry
+		var perm int
+		err := row.Scan(&e.Principal, &perm)
+		e.Perm = Perm(perm)
+		return e, err
+	})
+	if err != nil {
+		return nil, Error(err)
+	}
+	return acl, nil
+}
+
+// SetACL grants access to file for each principal, replacing what was granted on
+// file before. [PermNone] denies access that would be inherited. It needs admin
+// access to file.
+func (d *DB) SetACL(ctx context.Context, file uuid.UUID, entries ...ACLEntry) error {
+	const query = `upsert into fs.acl (dir_entry, principal, perm) values ($1, $2, $3)`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("file.id", file.String()),
+		attribute.Int("acl.count", len(entries)),
+	)
+	ctx, span := tracer.Start(ctx, "DB.SetACL", attr)
+	defer span.End()
+
+	for _, e := range entries {
+		if e.Perm < PermNone || e.Perm > PermAdmin {
+			return fmt.Errorf("fs: %v: %w", e.Perm, dberrors.ErrInvalid)
+		}
+	}
+	err := pgx.BeginTxFunc(ctx, d.RWC, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		if err := authorize(ctx, tx, file, PermAdmin); err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if _, err := tx.Exec(ctx, query, file, e.Principal, int(e.Perm)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return Error(err)
+}
+
+// RemoveACL removes the access granted to principal on file, so that it is
+// inherited from above again. It needs admin access to file.
+func (d *DB) RemoveACL(ctx context.Context, file, principal uuid.UUID) error {
+	const query = `delete from fs.acl where dir_entry = $1 and principal = $2`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("file.id", file.String()),
+		attribute.String("principal.id", principal.String()),
+	)
+	ctx, span := tracer.Start(ctx, "DB.RemoveACL", attr)
+	defer span.End()
+
+	err := pgx.BeginTxFunc(ctx, d.RWC, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		if err := authorize(ctx, tx, file, PermAdmin); err != nil {
+			return err
+		}
+		cmd, err := tx.Exec(ctx, query, file, principal)
+		if err != nil {
+			return err
+		}
+		if err := mustRowsAffected(cmd); err != nil {
+			return fmt.Errorf("fs: no acl entry for principal: %w", dberrors.ErrNotExist)
+		}
+		return nil
+	})
+	return Error(err)
+}
+
+// Access returns the access the user of ctx has to file.
+func (d *DB) Access(ctx context.Context, file uuid.UUID) (Perm, error) {
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", effectivePerm),
+		attribute.String("file.id", file.String()),
+	)
+	ctx, span := tracer.Start(ctx, "DB.Access", attr)
+	defer span.End()
+
+	p, err := access(ctx, d.RWC, file)
+	return p, Error(err)
+}
+
+// effectivePerm returns the access of a user to an entry, which is granted by the
+// nearest entry, from the entry itself up to the top-level, that is owned by the
+// user or has acl entries for the user or one of their groups.
+const effectivePerm = `with recursive ancestor (id, root, owner, depth) as (
+	select id, root, owner, 0 from fs.dir_entry where id = $1
+	union all
+	select f.id, f.root, f.owner, a.depth + 1 from fs.dir_entry f join ancestor a on f.id = a.root
+), who (id) as (
+	select $2::uuid
+	union all
+	select grp from fs.member where usr = $2
+), granted (depth, perm) as (
+	select depth, 3 from ancestor where owner = $2
+	union all
+	select a.depth, c.perm from ancestor a
+	join fs.acl c on c.dir_entry = a.id
+	join who w on w.id = c.principal
+)
+select coalesce((select max(perm) from granted where depth = (select min(depth) from granted)), 0)
+	, coalesce((select admin from fs.principal where id = $2 and not grp), false)`
+
+// access returns the access the user of ctx has to file. Without a user, or for
+// an admin, it is [PermAdmin]. Every user can read and create top-level entries,
+// which is [uuid.Nil]. Entries outside the scopes of ctx cannot be accessed.
+func access(ctx context.Context, q querier, file uuid.UUID) (Perm, error) {
+	if ok, err := inScope(ctx, q, file); err != nil || !ok {
+		return PermNone, err
+	}
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		return PermAdmin, nil
+	}
+	var p int
+	var admin bool
+	if err := q.QueryRow(ctx, effectivePerm, file, user).Scan(&p, &admin); err != nil {
+		return PermNone, err
+	}
+	switch {
+	case admin:
+		return PermAdmin, nil
+	case file == uuid.Nil:
+		return PermWrite, nil
+	}
+	return Perm(p), nil
+}
+
+// authorize returns [dberrors.ErrPermission] unless the user of ctx has at least
+// want access to file.
+func authorize(ctx context.Context, q querier, file uuid.UUID, want Perm) error {
+	p, err := access(ctx, q, file)
+	if err != nil {
+		return err
+	}
+	if p < want {
+		return fmt.Errorf("fs: %s access denied: %w", want, dberrors.ErrPermission)
+	}
+	return nil
+}
+
+// owner returns the user of ctx that owns the entries it creates, or nil.
+func owner(ctx context.Context) *uuid.UUID {
+	user, _ := UserFromContext(ctx)
+	return ptr(user)
+}
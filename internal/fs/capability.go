@@ -0,0 +1,167 @@
+package fs
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	dberrors "go.adoublef/eyeoh/internal/database/errors"
+	"go.adoublef/eyeoh/internal/macaroon"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// CapabilityPrefix starts every capability token.
+const CapabilityPrefix = "eoc_"
+
+// CreateCapability mints a capability token that acts as the user of ctx,
+// restricted by the caveats. The holder of the token can restrict it further
+// with [macaroon.Macaroon.Add]. It returns the id of the capability and its token.
+func (d *DB) CreateCapability(ctx context.Context, caveats ...string) (uuid.UUID, string, error) {
+	const query = `insert into fs.capability (id, usr, key) values ($1, $2, $3)`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.Int("capability.caveats", len(caveats)),
+	)
+	ctx, span := tracer.Start(ctx, "DB.CreateCapability", attr)
+	defer span.End()
+
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		return uuid.Nil, "", fmt.Errorf("fs: capabilities are minted by a user: %w", dberrors.ErrInvalid)
+	}
+	id, err := uuid.NewV7()
+	if err != nil {
+		return uuid.Nil, "", Error(err)
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return uuid.Nil, "", Error(err)
+	}
+	if _, err := d.RWC.Exec(ctx, query, id, user, key); err != nil {
+		return uuid.Nil, "", Error(err)
+	}
+	m := macaroon.New(key, id[:])
+	for _, c := range caveats {
+		m.Add(c)
+	}
+	return id, CapabilityPrefix + m.String(), nil
+}
+
+// RevokeCapability revokes the capability id, and every token derived from it.
+func (d *DB) RevokeCapability(ctx context.Context, id uuid.UUID) error {
+	const query = `update fs.capability set revoked_at = now() where id = $1 and revoked_at is null`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("capability.id", id.String()),
+	)
+	ctx, span := tracer.Start(ctx, "DB.RevokeCapability", attr)
+	defer span.End()
+
+	err := pgx.BeginTxFunc(ctx, d.RWC, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		var user uuid.UUID
+		if err := tx.QueryRow(ctx, `select usr from fs.capability where id = $1`, id).Scan(&user); err == pgx.ErrNoRows {
+			return fmt.Errorf("fs: no capability: %w", dberrors.ErrNotExist)
+		} else if err != nil {
+			return err
+		}
+		if err := authorizeUser(ctx, tx, user); err != nil {
+			return err
+		}
+		cmd, err := tx.Exec(ctx, query, id)
+		if err != nil {
+			return err
+		}
+		if err := mustRowsAffected(cmd); err != nil {
+			return fmt.Errorf("fs: capability is revoked: %w", dberrors.ErrNotExist)
+		}
+		return nil
+	})
+	return Error(err)
+}
+
+// VerifyCapability returns the user of the capability token once check has
+// accepted each of its caveats. It fails with [dberrors.ErrPermission] if the
+// token is not a capability that can be used or a caveat does not hold.
+func (d *DB) VerifyCapability(ctx context.Context, token string, check func(caveat string) error) (uuid.UUID, error) {
+	const query = `select usr, key from fs.capability where id = $1 and revoked_at is null`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+	)
+	ctx, span := tracer.Start(ctx, "DB.VerifyCapability", attr)
+	defer span.End()
+
+	invalid := fmt.Errorf("fs: invalid capability: %w", dberrors.ErrPermission)
+	s, ok := strings.CutPrefix(token, CapabilityPrefix)
+	if !ok {
+		return uuid.Nil, invalid
+	}
+	m, err := macaroon.Parse(s)
+	if err != nil {
+		return uuid.Nil, invalid
+	}
+	id, err := uuid.FromBytes(m.ID())
+	if err != nil {
+		return uuid.Nil, invalid
+	}
+	span.SetAttributes(attribute.String("capability.id", id.String()))
+
+	var user uuid.UUID
+	var key []byte
+	err = d.RWC.QueryRow(ctx, query, id).Scan(&user, &key)
+	if err == pgx.ErrNoRows {
+		return uuid.Nil, invalid
+	} else if err != nil {
+		return uuid.Nil, Error(err)
+	}
+	if err := m.Verify(key, check); err == macaroon.ErrInvalid {
+		return uuid.Nil, invalid
+	} else if err != nil {
+		return uuid.Nil, fmt.Errorf("fs: %v: %w", err, dberrors.ErrPermission)
+	}
+	return user, nil
+}
+
+type scopeKey struct{}
+
+// WithScope returns a copy of ctx that can only access the entry at the path p
+// and the entries below it. Scopes add up, so a scope within another can only
+// narrow it. If there is no entry at p, nothing can be accessed.
+func WithScope(ctx context.Context, p Path) context.Context {
+	return context.WithValue(ctx, scopeKey{}, append(slices.Clip(scopes(ctx)), p))
+}
+
+func scopes(ctx context.Context) []Path {
+	pp, _ := ctx.Value(scopeKey{}).([]Path)
+	return pp
+}
+
+// inScope reports whether file is within every scope of ctx.
+func inScope(ctx context.Context, q querier, file uuid.UUID) (bool, error) {
+	for _, p := range scopes(ctx) {
+		if len(p) == 0 {
+			continue
+		}
+		root, err := lookup(ctx, q, uuid.Nil, p)
+		if errors.Is(err, dberrors.ErrNotExist) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		if root == file {
+			continue
+		}
+		if ok, err := isAncestor(ctx, q, root, file); err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,299 @@
+package fs
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.adoublef/eyeoh/internal/database/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Conflict is the policy applied when a name is already taken in a directory.
+type Conflict int
+
+const (
+	// ConflictFail returns an error that wraps [errors.ErrExist].
+	ConflictFail Conflict = iota
+	// ConflictReplace adds a new version to an existing file or merges into an existing directory.
+	ConflictReplace
+	// ConflictRename appends a suffix to the name until it is free.
+	ConflictRename
+)
+
+var conflictNames = [...]string{ConflictFail: "fail", ConflictReplace: "replace", ConflictRename: "rename"}
+
+func (c Conflict) String() string {
+	if c < 0 || int(c) >= len(conflictNames) {
+		return fmt.Sprintf("Conflict(%d)", int(c))
+	}
+	return conflictNames[c]
+}
+
+func (c Conflict) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+func (c *Conflict) UnmarshalText(text []byte) (err error) {
+	*c, err = ParseConflict(string(text))
+	return err
+}
+
+// ParseConflict returns the [Conflict] for the name, as returned by [Conflict.String].
+func ParseConflict(s string) (Conflict, error) {
+	for i, name := range conflictNames {
+		if s == name {
+			return Conflict(i), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid conflict policy: %q", s)
+}
+
+// CopyEntry is an entry to duplicate with [DB.Copy].
+type CopyEntry struct {
+	ID uuid.UUID
+	// Name renames the copy, if set.
+	Name Name
+}
+
+// Copy duplicates each entry under root in a single transaction, recursively for directories.
+// The copies point at the blob data of the originals so no content is uploaded.
+// It returns the ids of the copied entries in the same order as entries.
+func (d *DB) Copy(ctx context.Context, root uuid.UUID, c Conflict, entries ...CopyEntry) ([]uuid.UUID, error) {
+	attr := trace.WithAttributes(
+		attribute.String("file.root", root.String()),
+		attribute.String("file.conflict", c.String()),
+		attribute.Int("file.count", len(entries)),
+	)
+	ctx, span := tracer.Start(ctx, "DB.Copy", attr)
+	defer span.End()
+
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("fs: no entries to copy: %w", errors.ErrInvalid)
+	}
+	var files []uuid.UUID
+	err := pgx.BeginTxFunc(ctx, d.RWC, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		files = files[:0] // reset on retry
+		if err := isDir(ctx, tx, root); err != nil {
+			return err
+		}
+		if err := authorize(ctx, tx, root, PermWrite); err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if err := authorize(ctx, tx, e.ID, PermRead); err != nil {
+				return err
+			}
+			if ok, err := isAncestor(ctx, tx, e.ID, root); err != nil {
+				return err
+			} else if ok {
+				return fmt.Errorf("fs: cannot copy a directory into itself: %w", errors.ErrInvalid)
+			}
+			// read the whole subtree before writing so the copy is a snapshot
+			n, err := readTree(ctx, tx, e.ID)
+			if err != nil {
+				return err
+			}
+			if e.Name != "" {
+				n.name = e.Name
+			}
+			file, err := copyTree(ctx, tx, n, root, c)
+			if err != nil {
+				return err
+			}
+			files = append(files, file)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, Error(err)
+	}
+	return files, nil
+}
+
+// node is an entry of a tree read by [readTree].
+type node struct {
+	id       uuid.UUID
+	name     Name
+	ref      *uuid.UUID // null for directories
+	sz       *int64
+	sha      []byte
+	children []*node
+}
+
+// readTree returns the entry and all of its descendants with their latest blob data.
+func readTree(ctx context.Context, q querier, file uuid.UUID) (*node, error) {
+	const query = `with recursive tree (id, root, name, depth) as (
+	select id, root, name, 0 from fs.dir_entry where id = $1 and del is null
+	union all
+	select f.id, f.root, f.name, t.depth + 1 from fs.dir_entry f join tree t on f.root = t.id
+	where f.del is null
+)
+select t.id
+	, t.root
+	, t.name
+	, b.ref
+	, b.sz
+	, b.sha
+from tree t
+left join lateral (
+	select coalesce(ref, id) as ref, sz, sha
+	from fs.blob_data
+	where dir_entry = t.id
+	order by v desc
+	limit 1) b on true
+order by t.depth, t.name
+`
+	rows, err := q.Query(ctx, query, file)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	nodes := make(map[uuid.UUID]*node)
+	var top *node
+	for rows.Next() {
+		var n node
+		var root *uuid.UUID
+		if err := rows.Scan(&n.id, &root, &n.name, &n.ref, &n.sz, &n.sha); err != nil {
+			return nil, err
+		}
+		nodes[n.id] = &n
+		// parents are always read before their children
+		if top == nil {
+			top = &n
+		} else if p, ok := nodes[value(root)]; ok {
+			p.children = append(p.children, &n)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if top == nil {
+		return nil, fmt.Errorf("fs: no entry for file: %w", errors.ErrNotExist)
+	}
+	return top, nil
+}
+
+// copyTree inserts a copy of n named n.name under root, applying c if the name is taken.
+func copyTree(ctx context.Context, q querier, n *node, root uuid.UUID, c Conflict) (uuid.UUID, error) {
+	const query = `select f.id
+	, exists (select 1 from fs.blob_data where dir_entry = f.id)
+from fs.dir_entry f
+where f.root is not distinct from $1 and f.name = $2`
+
+	var found uuid.UUID
+	var isFile bool
+	err := q.QueryRow(ctx, query, ptr(root), n.name).Scan(&found, &isFile)
+	switch {
+	case err == pgx.ErrNoRows:
+		return insertTree(ctx, q, n, n.name, root)
+	case err != nil:
+		return uuid.Nil, err
+	}
+
+	switch c {
+	case ConflictRename:
+		name, err := freeName(ctx, q, n.name, root)
+		if err != nil {
+			return uuid.Nil, err
+		}
+		return insertTree(ctx, q, n, name, root)
+	case ConflictReplace:
+		// an entry below root can have its own access
+		if err := authorize(ctx, q, found, PermWrite); err != nil {
+			return uuid.Nil, err
+		}
+		switch {
+		case n.ref != nil && isFile:
+			return found, appendBlob(ctx, q, found, *n.ref, *n.sz, n.sha)
+		case n.ref == nil && !isFile:
+			// merge into the existing directory
+			for _, child := range n.children {
+				if _, err := copyTree(ctx, q, child, found, c); err != nil {
+					return uuid.Nil, err
+				}
+			}
+			return found, nil
+		}
+	}
+	return uuid.Nil, fmt.Errorf("file name taken: %w", errors.ErrExist)
+}
+
+// insertTree inserts a copy of n and its descendants under root.
+func insertTree(ctx context.Context, q querier, n *node, name Name, root uuid.UUID) (uuid.UUID, error) {
+	file, err := uuid.NewV7()
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if _, err := q.Exec(ctx, insertDirEntry, file, name, ptr(root), owner(ctx)); err != nil {
+		return uuid.Nil, err
+	}
+	if n.ref != nil {
+		return file, appendBlob(ctx, q, file, *n.ref, *n.sz, n.sha)
+	}
+	for _, child := range n.children {
+		if _, err := insertTree(ctx, q, child, child.name, file); err != nil {
+			return uuid.Nil, err
+		}
+	}
+	return file, nil
+}
+
+// appendBlob adds a version to the file that points at an existing object.
+func appendBlob(ctx context.Context, q querier, file, ref uuid.UUID, sz int64, sha []byte) error {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return err
+	}
+	before, err := fileUsage(ctx, q, file)
+	if err != nil {
+		return err
+	}
+	const query = `
+with dir_entry as (
+	update fs.dir_entry
+	set v = v + 1, mod_at = now()
+	where id = $1
+	returning id, mod_at, v)
+insert into fs.blob_data (id, dir_entry, sz, sha, mod_at, v, ref)
+select $2, id, $3, $4, mod_at, v, $5 from dir_entry
+`
+	cmd, err := q.Exec(ctx, query, file, id, sz, sha, ref)
+	if err != nil {
+		return err
+	}
+	if err := mustRowsAffected(cmd); err != nil {
+		return err
+	}
+	if err := accountFile(ctx, q, file, before); err != nil {
+		return err
+	}
+	if err := checkQuota(ctx, q, file); err != nil {
+		return err
+	}
+	return retain(ctx, q, ref)
+}
+
+// freeName returns the first suffixed name that is not taken under root.
+func freeName(ctx context.Context, q querier, name Name, root uuid.UUID) (Name, error) {
+	const query = `select exists (
+	select 1 from fs.dir_entry where root is not distinct from $1 and name = $2)`
+
+	for i := 1; i <= maxSuffix; i++ {
+		next := name.Suffix(i)
+		var taken bool
+		if err := q.QueryRow(ctx, query, ptr(root), next).Scan(&taken); err != nil {
+			return "", err
+		}
+		if !taken {
+			return next, nil
+		}
+	}
+	return "", fmt.Errorf("file name taken: %w", errors.ErrExist)
+}
+
+// maxSuffix is the number of suffixes tried by [freeName].
+const maxSuffix = 100
@@ -0,0 +1,123 @@
+package fs
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Sort is the key used to order entries returned by [DB.ReadDir].
+type Sort int
+
+const (
+	SortName Sort = iota
+	SortModTime
+	SortSize
+)
+
+var sortNames = [...]string{SortName: "name", SortModTime: "modTime", SortSize: "size"}
+
+func (s Sort) String() string {
+	if s < 0 || int(s) >= len(sortNames) {
+		return "Sort(" + strconv.Itoa(int(s)) + ")"
+	}
+	return sortNames[s]
+}
+
+// ParseSort returns the [Sort] for the name, as returned by [Sort.String].
+func ParseSort(s string) (Sort, error) {
+	for i, name := range sortNames {
+		if s == name {
+			return Sort(i), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid sort: %q", s)
+}
+
+// Cursor is a position within a directory listing. The zero value starts
+// a listing sorted by name in ascending order.
+type Cursor struct {
+	Sort Sort
+	Desc bool
+	// Next is the id of the last entry read.
+	// If it is [uuid.Nil] the listing starts from the beginning.
+	Next uuid.UUID
+	// Key is the value of the sort key for Next.
+	Key any
+}
+
+// IsZero reports whether c starts from the beginning of a listing.
+func (c Cursor) IsZero() bool { return c.Next == uuid.Nil }
+
+// String returns c as an opaque token that is safe to use in a URL.
+func (c Cursor) String() string {
+	var key string
+	switch v := c.Key.(type) {
+	case Name:
+		key = v.String()
+	case time.Time:
+		key = v.UTC().Format(time.RFC3339Nano)
+	case int64:
+		key = strconv.FormatInt(v, 10)
+	}
+	order := "asc"
+	if c.Desc {
+		order = "desc"
+	}
+	// [sort],[order],[key],[uuid]
+	s := strings.Join([]string{c.Sort.String(), order, key, c.Next.String()}, ",")
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+func (c Cursor) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+func (c *Cursor) UnmarshalText(text []byte) (err error) {
+	*c, err = ParseCursor(string(text))
+	return err
+}
+
+// ParseCursor parses a token returned by [Cursor.String].
+func ParseCursor(s string) (Cursor, error) {
+	p, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("invalid cursor: %w", err)
+	}
+	// names cannot contain a comma, so a split is safe
+	parts := strings.Split(string(p), ",")
+	if len(parts) != 4 {
+		return Cursor{}, errors.New("invalid cursor: malformed token")
+	}
+	var c Cursor
+	if c.Sort, err = ParseSort(parts[0]); err != nil {
+		return Cursor{}, fmt.Errorf("invalid cursor: %w", err)
+	}
+	switch parts[1] {
+	case "asc":
+	case "desc":
+		c.Desc = true
+	default:
+		return Cursor{}, fmt.Errorf("invalid cursor: order %q", parts[1])
+	}
+	switch c.Sort {
+	case SortName:
+		c.Key, err = ParseName(parts[2])
+	case SortModTime:
+		c.Key, err = time.Parse(time.RFC3339Nano, parts[2])
+	case SortSize:
+		c.Key, err = strconv.ParseInt(parts[2], 10, 64)
+	}
+	if err != nil {
+		return Cursor{}, fmt.Errorf("invalid cursor: %w", err)
+	}
+	if c.Next, err = uuid.Parse(parts[3]); err != nil {
+		return Cursor{}, fmt.Errorf("invalid cursor: %w", err)
+	}
+	return c, nil
+}
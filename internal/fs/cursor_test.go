@@ -0,0 +1,42 @@
+package fs_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	. "go.adoublef/eyeoh/internal/fs"
+	"go.adoublef/eyeoh/internal/testing/is"
+)
+
+func Test_ParseCursor(t *testing.T) {
+	type testcase struct {
+		in Cursor
+	}
+
+	var tt = map[string]testcase{
+		"Name": {
+			in: Cursor{Sort: SortName, Next: uuid.New(), Key: Name("hello.txt")},
+		},
+		"ModTimeDesc": {
+			in: Cursor{Sort: SortModTime, Desc: true, Next: uuid.New(), Key: time.Date(2024, 1, 2, 3, 4, 5, 6000, time.UTC)},
+		},
+		"Size": {
+			in: Cursor{Sort: SortSize, Next: uuid.New(), Key: int64(14)},
+		},
+	}
+	for name, tc := range tt {
+		t.Run(name, func(t *testing.T) {
+			c, err := ParseCursor(tc.in.String())
+			is.OK(t, err)
+			is.Equal(t, c, tc.in) // got;want
+		})
+	}
+
+	t.Run("ErrInvalid", func(t *testing.T) {
+		for _, s := range []string{"", "next:", "bmFtZSxhc2MsaGVsbG8udHh0"} {
+			_, err := ParseCursor(s)
+			is.True(t, err != nil)
+		}
+	})
+}
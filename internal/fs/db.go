@@ -1,10 +1,11 @@
-// TODO: mv (rename and multiple files under a new directory location), cp (single file or many under a new directory location), rm (single file or many)
 package fs
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"go.adoublef/eyeoh/internal/database/errors"
@@ -16,75 +17,90 @@ type DB struct {
 	RWC *pgxpool.Pool
 }
 
+// insertDirEntry creates an entry if its parent exists and is not in the trash.
+const insertDirEntry = `insert into fs.dir_entry (id, name, root, owner)
+select $1, $2, $3, $4
+where $3::uuid is null or exists (select 1 from fs.dir_entry where id = $3 and del is null)`
+
 // Touch attempts to create a new [DirEntry] for a file. If root is set, the file is nested.
 func (d *DB) Touch(ctx context.Context, name Name, root uuid.UUID) (file uuid.UUID, err error) {
 	file, err = uuid.NewV7()
 	if err != nil {
 		return uuid.Nil, Error(err)
 	}
-	const query = `insert into fs.dir_entry (id, name, root) values ($1, $2, $3)`
-
 	attr := trace.WithAttributes(
-		attribute.String("sql.query", query),
+		attribute.String("sql.query", insertDirEntry),
 		attribute.String("file.id", file.String()),
 		attribute.String("file.root", root.String()),
 	)
 	ctx, span := tracer.Start(ctx, "DB.Touch", attr)
 	defer span.End()
 
-	_, err = d.RWC.Exec(ctx, query, file, name, ptr(root))
+	if err := authorize(ctx, d.RWC, root, PermWrite); err != nil {
+		return uuid.Nil, Error(err)
+	}
+	cmd, err := d.RWC.Exec(ctx, insertDirEntry, file, name, ptr(root), owner(ctx))
 	if err != nil {
 		return uuid.Nil, Error(err)
 	}
-	return file, nil
+	return file, mustRowsAffected(cmd)
 }
 
-// Cat updates [FileInfo.Ref] and [FileInfo.Size]. The version of the file enables safe mutli-user modifications.
-func (d *DB) Cat(ctx context.Context, ref uuid.UUID, sz int64, sha []byte, file uuid.UUID, v uint64) error {
-	const query = `
+// catBlob adds a version to the file if v is its current version. If the version
+// shares the object of another, ref is the object.
+const catBlob = `
 with dir_entry as (
 	update fs.dir_entry
 	set v = v + 1, mod_at = now()
-	where id = $1 and v = $2
+	where id = $1 and v = $2 and del is null
 	returning id, mod_at, v)
-insert into fs.blob_data (id, dir_entry, sz, sha, mod_at, v)
-values ($3
-	, (select id from dir_entry)
-	, $4
-	, $5
-	, (select mod_at from dir_entry)
-	, (select v from dir_entry))
+insert into fs.blob_data (id, dir_entry, sz, sha, mod_at, v, ref)
+select $3, id, $4, $5, mod_at, v, $6 from dir_entry
 `
 
-	attr := trace.WithAttributes(
-		attribute.String("sql.query", query),
-		attribute.String("file.id", file.String()),
-		attribute.Int("file.v", int(v)),
-		attribute.String("file.ref", ref.String()),
-		attribute.Int("file.sz", int(sz)),
-	)
-	ctx, span := tracer.Start(ctx, "DB.Cat", attr)
-	defer span.End()
-
-	cmd, err := d.RWC.Exec(ctx, query, file, v, ref, sz, sha)
+// cat adds the blob id as a version of file. The version of the file enables safe
+// mutli-user modifications. If the file exists but v is not its current version,
+// [errors.ErrStale] is returned.
+func cat(ctx context.Context, q querier, id, ref uuid.UUID, sz int64, sha []byte, file uuid.UUID, v uint64) error {
+	before, err := fileUsage(ctx, q, file)
 	if err != nil {
-		return Error(err)
+		return err
 	}
-	return mustRowsAffected(cmd)
+	cmd, err := q.Exec(ctx, catBlob, file, v, id, sz, sha, ptr(ref))
+	if err != nil {
+		return err
+	}
+	if err := mustRowsAffected(cmd); err == nil {
+		if err := accountFile(ctx, q, file, before); err != nil {
+			return err
+		}
+		return checkQuota(ctx, q, file)
+	}
+	// nothing was written, so find out if the file is missing or was modified
+	var ok bool
+	const exists = `select exists (select 1 from fs.dir_entry where id = $1 and del is null)`
+	if err := q.QueryRow(ctx, exists, file).Scan(&ok); err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("fs: no entry for file: %w", errors.ErrNotExist)
+	}
+	return fmt.Errorf("fs: file was modified: %w", errors.ErrStale)
 }
 
 // Stat return [FileInfo] if successful, else returns an error.
 func (d *DB) Stat(ctx context.Context, file uuid.UUID) (info FileInfo, v uint64, etag Etag, err error) {
 	const query = `select distinct on (b.dir_entry)
 	f.name
-	, b.id
+	, coalesce(b.ref, b.id)
 	, b.sz
 	, f.mod_at
 	, f.v
 	, b.sha
+	, f.upload_link
 from fs.dir_entry f 
 left join fs.blob_data b on f.id = b.dir_entry
-where f.id = $1
+where f.id = $1 and f.del is null
 order by b.dir_entry, b.v desc
 `
 
@@ -104,19 +120,17 @@ order by b.dir_entry, b.v desc
 		&de.modAt,
 		&de.v,
 		&bd.sha,
+		&de.link,
 	); err != nil {
 		return FileInfo{}, 0, nil, Error(err)
 	}
-	fi := FileInfo{
-		ID:      file,
-		Ref:     value(bd.id),
-		Name:    de.name,
-		Size:    value(bd.sz),
-		ModTime: de.modAt,
-		IsDir:   bd.sz == nil, // todo: maybe check if blobdata exists instead
+	// a missing entry is reported before the access to it
+	if err := authorize(ctx, d.RWC, file, PermRead); err != nil {
+		return FileInfo{}, 0, nil, Error(err)
 	}
+	de.id = file
 	// URLEncoding version?
-	return fi, de.v, bd.sha, nil
+	return de.info(bd), de.v, bd.sha, nil
 }
 
 // Mkdir attempts to create a new [DirEntry] for a directory. If root is not nil, the directory is nested.
@@ -125,27 +139,28 @@ func (d *DB) Mkdir(ctx context.Context, name Name, root uuid.UUID) (file uuid.UU
 	if err != nil {
 		return uuid.Nil, Error(err)
 	}
-	const query = `insert into fs.dir_entry (id, name, root) values ($1, $2, $3)`
-
 	attr := trace.WithAttributes(
-		attribute.String("sql.query", query),
+		attribute.String("sql.query", insertDirEntry),
 		attribute.String("file.id", file.String()),
 		attribute.String("file.root", root.String()),
 	)
 	ctx, span := tracer.Start(ctx, "DB.Mkdir", attr)
 	defer span.End()
 
-	_, err = d.RWC.Exec(ctx, query, file, name, ptr(root))
+	if err := authorize(ctx, d.RWC, root, PermWrite); err != nil {
+		return uuid.Nil, Error(err)
+	}
+	cmd, err := d.RWC.Exec(ctx, insertDirEntry, file, name, ptr(root), owner(ctx))
 	if err != nil {
 		return uuid.Nil, Error(err)
 	}
-	return file, nil
+	return file, mustRowsAffected(cmd)
 }
 
 func (d *DB) Mv(ctx context.Context, name Name, file uuid.UUID, v uint64) error {
 	const query = `update fs.dir_entry
 set name = $1, mod_at = now(), v = v + 1
-where id = $2 and v = $3`
+where id = $2 and v = $3 and del is null`
 	attr := trace.WithAttributes(
 		attribute.String("sql.query", query),
 		attribute.String("file.id", file.String()),
@@ -154,6 +169,10 @@ where id = $2 and v = $3`
 	)
 	ctx, span := tracer.Start(ctx, "DB.Mv", attr)
 	defer span.End()
+
+	if err := authorize(ctx, d.RWC, file, PermWrite); err != nil {
+		return Error(err)
+	}
 	// need to be set
 	cmd, err := d.RWC.Exec(ctx, query, name, file, v)
 	if err != nil {
@@ -162,6 +181,265 @@ where id = $2 and v = $3`
 	return mustRowsAffected(cmd)
 }
 
+// MoveEntry is an entry to reparent with [DB.Move].
+type MoveEntry struct {
+	ID uuid.UUID
+	V  uint64
+	// Name renames the entry in the same step, if set.
+	Name Name
+}
+
+// Move reparents each entry under root in a single transaction. If root is [uuid.Nil],
+// the entries are moved to the top-level. A directory cannot be moved into its own subtree.
+func (d *DB) Move(ctx context.Context, root uuid.UUID, entries ...MoveEntry) error {
+	const query = `update fs.dir_entry
+set root = $1, name = coalesce($2, name), mod_at = now(), v = v + 1
+where id = $3 and v = $4 and del is null`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("file.root", root.String()),
+		attribute.Int("file.count", len(entries)),
+	)
+	ctx, span := tracer.Start(ctx, "DB.Move", attr)
+	defer span.End()
+
+	if len(entries) == 0 {
+		return fmt.Errorf("fs: no entries to move: %w", errors.ErrInvalid)
+	}
+	err := pgx.BeginTxFunc(ctx, d.RWC, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		if err := isDir(ctx, tx, root); err != nil {
+			return err
+		}
+		if err := authorize(ctx, tx, root, PermWrite); err != nil {
+			return err
+		}
+		tree, err := topLevel(ctx, tx, root)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if err := authorize(ctx, tx, e.ID, PermWrite); err != nil {
+				return err
+			}
+			// moving into itself or a descendant would detach the subtree
+			if ok, err := isAncestor(ctx, tx, e.ID, root); err != nil {
+				return err
+			} else if ok {
+				return fmt.Errorf("fs: cannot move a directory into itself: %w", errors.ErrInvalid)
+			}
+			// the usage of the entry moves from the old directories to the new
+			var from *uuid.UUID
+			if err := tx.QueryRow(ctx, `select root from fs.dir_entry where id = $1`, e.ID).Scan(&from); err != nil {
+				return err
+			}
+			fromTree, err := topLevel(ctx, tx, value(from))
+			if err != nil {
+				return err
+			}
+			u, err := entryUsage(ctx, tx, e.ID)
+			if err != nil {
+				return err
+			}
+			if err := account(ctx, tx, value(from), u.neg()); err != nil {
+				return err
+			}
+			cmd, err := tx.Exec(ctx, query, ptr(root), ptr(e.Name), e.ID, e.V)
+			if err != nil {
+				return err
+			}
+			if err := mustRowsAffected(cmd); err != nil {
+				return err
+			}
+			if err := account(ctx, tx, root, u); err != nil {
+				return err
+			}
+			// a quota is only kept by a top-level directory
+			if root != uuid.Nil {
+				if _, err := tx.Exec(ctx, `delete from fs.quota where id = $1`, e.ID); err != nil {
+					return err
+				}
+			}
+			// only a move between trees can grow one
+			if tree != fromTree {
+				if err := checkQuota(ctx, tx, root); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	return Error(err)
+}
+
+// ReadDir returns up to limit entries of the directory dir, starting after c.
+// If dir is [uuid.Nil] the top-level entries are returned. The returned [Cursor]
+// is the position to continue from and is zero once the listing is complete.
+func (d *DB) ReadDir(ctx context.Context, dir uuid.UUID, c Cursor, limit int) ([]DirEntry, Cursor, error) {
+	if limit <= 0 {
+		limit = DefaultReadDirLimit
+	}
+	// the sort key must be the same expression in the filter and the order
+	var key, typ string
+	switch c.Sort {
+	case SortName:
+		key, typ = "f.name", "string"
+	case SortModTime:
+		key, typ = "f.mod_at", "timestamptz"
+	case SortSize:
+		key, typ = "coalesce(b.sz, 0)", "int"
+	default:
+		return nil, Cursor{}, fmt.Errorf("fs: unknown sort %d: %w", c.Sort, errors.ErrInvalid)
+	}
+	cmp, order := ">", "asc"
+	if c.Desc {
+		cmp, order = "<", "desc"
+	}
+	args := []any{ptr(dir), limit + 1}
+	var after string
+	if !c.IsZero() {
+		after = fmt.Sprintf("and (%s, f.id) %s ($3::%s, $4::uuid)", key, cmp, typ)
+		args = append(args, c.Key, c.Next)
+	}
+	// a user only sees the top-level entries they have been given access to
+	after += fmt.Sprintf(` and ($%[1]d::uuid is null or f.owner = $%[1]d or exists (
+	select 1 from fs.acl c where c.dir_entry = f.id and c.perm > 0
+	and (c.principal = $%[1]d or c.principal in (select grp from fs.member where usr = $%[1]d))))`, len(args)+1)
+	query := fmt.Sprintf(`select f.id
+	, f.name
+	, f.mod_at
+	, b.ref
+	, b.sz
+	, b.sha
+from fs.dir_entry f
+left join lateral (
+	select coalesce(ref, id) as ref, sz, sha
+	from fs.blob_data
+	where dir_entry = f.id
+	order by v desc
+	limit 1) b on true
+where f.root is not distinct from $1 and f.del is null %[2]s
+order by %[1]s %[3]s, f.id %[3]s
+limit $2
+`, key, after, order)
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("file.id", dir.String()),
+		attribute.String("cursor.sort", c.Sort.String()),
+		attribute.Int("cursor.limit", limit),
+	)
+	ctx, span := tracer.Start(ctx, "DB.ReadDir", attr)
+	defer span.End()
+
+	if err := isDir(ctx, d.RWC, dir); err != nil {
+		return nil, Cursor{}, err
+	}
+	perm, err := access(ctx, d.RWC, dir)
+	switch {
+	case err != nil:
+		return nil, Cursor{}, Error(err)
+	case perm < PermRead:
+		return nil, Cursor{}, fmt.Errorf("fs: %s access denied: %w", PermRead, errors.ErrPermission)
+	case dir == uuid.Nil && perm < PermAdmin:
+		args = append(args, owner(ctx))
+	default:
+		args = append(args, nil)
+	}
+	p, err := pathOf(ctx, d.RWC, dir)
+	if err != nil {
+		return nil, Cursor{}, err
+	}
+	p = p[:len(p):len(p)]
+
+	rows, err := d.RWC.Query(ctx, query, args...)
+	if err != nil {
+		return nil, Cursor{}, Error(err)
+	}
+	defer rows.Close()
+
+	var entries []DirEntry
+	for rows.Next() {
+		var de dirEntry
+		var bd blobData
+		if err := rows.Scan(
+			&de.id,
+			&de.name,
+			&de.modAt,
+			&bd.id,
+			&bd.sz,
+			&bd.sha,
+		); err != nil {
+			return nil, Cursor{}, Error(err)
+		}
+		entries = append(entries, DirEntry{Path: append(p, de.name).String(), FileInfo: de.info(bd), ETag: bd.sha})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, Cursor{}, Error(err)
+	}
+	if len(entries) <= limit {
+		return entries, Cursor{}, nil
+	}
+	// the extra row only signals that there is another page
+	entries = entries[:limit]
+	last := entries[limit-1]
+	next := Cursor{Sort: c.Sort, Desc: c.Desc, Next: last.ID}
+	switch c.Sort {
+	case SortName:
+		next.Key = last.Name
+	case SortModTime:
+		next.Key = last.ModTime
+	case SortSize:
+		next.Key = last.Size
+	}
+	return entries, next, nil
+}
+
+// querier is implemented by both [pgxpool.Pool] and [pgx.Tx].
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// isDir returns an error if file is not a directory. [uuid.Nil] is the top-level directory.
+func isDir(ctx context.Context, q querier, file uuid.UUID) error {
+	if file == uuid.Nil {
+		return nil
+	}
+	const query = `select exists (select 1 from fs.blob_data where dir_entry = f.id)
+from fs.dir_entry f
+where f.id = $1 and f.del is null`
+
+	var hasBlob bool
+	if err := q.QueryRow(ctx, query, file).Scan(&hasBlob); err != nil {
+		return Error(err)
+	}
+	if hasBlob {
+		return fmt.Errorf("fs: not a directory: %w", errors.ErrInvalid)
+	}
+	return nil
+}
+
+// isAncestor reports whether file is the same as root or one of its ancestors.
+func isAncestor(ctx context.Context, q querier, file, root uuid.UUID) (bool, error) {
+	if root == uuid.Nil {
+		return false, nil
+	}
+	const query = `with recursive ancestor (id, root) as (
+	select id, root from fs.dir_entry where id = $1
+	union all
+	select f.id, f.root from fs.dir_entry f join ancestor a on f.id = a.root
+)
+select exists (select 1 from ancestor where id = $2)`
+
+	var ok bool
+	if err := q.QueryRow(ctx, query, root, file).Scan(&ok); err != nil {
+		return false, Error(err)
+	}
+	return ok, nil
+}
+
 func ptr[V comparable](v V) *V {
 	if z := *new(V); v == z {
 		return nil
@@ -178,9 +456,11 @@ func value[V comparable](v *V) V {
 
 func mustRowsAffected(cmd pgconn.CommandTag) error {
 	// if update and no affect then assume not found
-	if cmd.Update() && cmd.RowsAffected() < 1 {
+	if (cmd.Update() || cmd.Insert()) && cmd.RowsAffected() < 1 {
+		return errors.ErrNotExist
+	}
+	if cmd.Delete() && cmd.RowsAffected() < 1 {
 		return errors.ErrNotExist
 	}
-	// todo: if delete and no affect then assume not found
 	return nil
 }
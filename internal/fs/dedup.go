@@ -0,0 +1,166 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	dberrors "go.adoublef/eyeoh/internal/database/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// CreateByHash creates a file named name within root that shares an existing
+// object with the same content. The user of ctx must be able to read a file with
+// the content, so that a hash cannot be used to read the files of others. If
+// there is none, [dberrors.ErrNotExist] is returned and the content must be
+// uploaded with [FS.Create].
+func (d *DB) CreateByHash(ctx context.Context, name Name, root uuid.UUID, sz int64, sha []byte) (file uuid.UUID, err error) {
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", findReadableBlob),
+		attribute.String("file.root", root.String()),
+		attribute.Int("file.sz", int(sz)),
+	)
+	ctx, span := tracer.Start(ctx, "DB.CreateByHash", attr)
+	defer span.End()
+
+	err = pgx.BeginTxFunc(ctx, d.RWC, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		if err := isDir(ctx, tx, root); err != nil {
+			return err
+		}
+		if err := authorize(ctx, tx, root, PermWrite); err != nil {
+			return err
+		}
+		obj, err := readableBlob(ctx, tx, sha, sz)
+		if err != nil {
+			return err
+		}
+		if file, err = uuid.NewV7(); err != nil {
+			return err
+		}
+		cmd, err := tx.Exec(ctx, insertDirEntry, file, name, ptr(root), owner(ctx))
+		if err != nil {
+			return err
+		}
+		if err := mustRowsAffected(cmd); err != nil {
+			return fmt.Errorf("fs: no entry for parent: %w", dberrors.ErrNotExist)
+		}
+		id, err := uuid.NewV7()
+		if err != nil {
+			return err
+		}
+		if err := cat(ctx, tx, id, obj, sz, sha, file, 0); err != nil {
+			return err
+		}
+		return retain(ctx, tx, obj)
+	})
+	if err != nil {
+		return uuid.Nil, Error(err)
+	}
+	return file, nil
+}
+
+// findReadableBlob returns the files that have a version with an object of the
+// same content, those owned by the user first.
+const findReadableBlob = `select file, obj from (
+  select distinct on (f.id) f.id as file, o.id as obj, f.owner is not distinct from $3::uuid as owned
+  from fs.blob o
+  join fs.blob_data b on b.id = o.id or b.ref = o.id
+  join fs.dir_entry f on f.id = b.dir_entry
+  where o.sha = $1 and o.sz = $2 and f.del is null
+)
+order by owned desc
+limit 100`
+
+// readableBlob returns an object with the content of sha, of a file the user of
+// ctx can read. Only some of the files are checked, which is enough as the user
+// usually owns one. If there is none the object does not exist, so that the
+// caller cannot learn what content is stored.
+func readableBlob(ctx context.Context, q querier, sha []byte, sz int64) (uuid.UUID, error) {
+	rows, err := q.Query(ctx, findReadableBlob, sha, sz, owner(ctx))
+	if err != nil {
+		return uuid.Nil, err
+	}
+	type candidate struct{ file, obj uuid.UUID }
+	cc, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (c candidate, err error) {
+		err = row.Scan(&c.file, &c.obj)
+		return c, err
+	})
+	if err != nil {
+		return uuid.Nil, err
+	}
+	for _, c := range cc {
+		switch err := authorize(ctx, q, c.file, PermRead); {
+		case err == nil:
+			return c.obj, nil
+		case !errors.Is(err, dberrors.ErrPermission):
+			return uuid.Nil, err
+		}
+	}
+	return uuid.Nil, fmt.Errorf("fs: no blob for hash: %w", dberrors.ErrNotExist)
+}
+
+// findBlob returns an object with the same content.
+const findBlob = `select id from fs.blob where sha = $1 and sz = $2 limit 1`
+
+// dedup returns an existing object with the same content as the object id, retaining
+// it for a new version. If there is none, id is recorded as a new object and returned.
+func dedup(ctx context.Context, q querier, id uuid.UUID, sz int64, sha []byte) (uuid.UUID, error) {
+	var obj uuid.UUID
+	err := q.QueryRow(ctx, findBlob, sha, sz).Scan(&obj)
+	switch {
+	case err == nil:
+		return obj, retain(ctx, q, obj)
+	case err != pgx.ErrNoRows:
+		return uuid.Nil, err
+	}
+	const query = `insert into fs.blob (id, sha, sz, refs) values ($1, $2, $3, 1)`
+	if _, err := q.Exec(ctx, query, id, sha, sz); err != nil {
+		return uuid.Nil, err
+	}
+	return id, accountObject(ctx, q, sz)
+}
+
+// retain adds a reference to the object for a new version.
+func retain(ctx context.Context, q querier, obj uuid.UUID) error {
+	cmd, err := q.Exec(ctx, `update fs.blob set refs = refs + 1 where id = $1`, obj)
+	if err != nil {
+		return err
+	}
+	return mustRowsAffected(cmd)
+}
+
+// release removes a reference to each object for every version that was deleted,
+// so an object may appear more than once. It returns the objects that are no longer
+// referenced, which must be deleted from the blob store by the caller.
+func release(ctx context.Context, q querier, objs []uuid.UUID) ([]uuid.UUID, error) {
+	if len(objs) == 0 {
+		return nil, nil
+	}
+	const query = `update fs.blob
+set refs = refs - d.n
+from (select r, count(*) as n from unnest($1::uuid[]) as r group by r) as d
+where id = d.r`
+
+	if _, err := q.Exec(ctx, query, objs); err != nil {
+		return nil, err
+	}
+	rows, err := q.Query(ctx, `delete from fs.blob where id = any($1) and refs = 0 returning id, sz`, objs)
+	if err != nil {
+		return nil, err
+	}
+	var sz int64
+	deleted, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (uuid.UUID, error) {
+		var id uuid.UUID
+		var n int64
+		err := row.Scan(&id, &n)
+		sz += n
+		return id, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deleted, accountObject(ctx, q, -sz)
+}
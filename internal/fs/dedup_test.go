@@ -0,0 +1,50 @@
+package fs_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	dberrors "go.adoublef/eyeoh/internal/database/errors"
+	. "go.adoublef/eyeoh/internal/fs"
+	"go.adoublef/eyeoh/internal/testing/is"
+)
+
+func Test_CreateByHash(t *testing.T) {
+	const content = "Hello, World!"
+	sum := sha256.Sum256([]byte(content))
+
+	t.Run("OK", func(t *testing.T) {
+		fsys, ctx := newTestFS(t), context.Background()
+
+		alice, err := fsys.CreateUser(ctx, "alice", false)
+		is.OK(t, err) // create user
+		_, err = fsys.Create(WithUser(ctx, alice), "hello.txt", strings.NewReader(content), uuid.Nil)
+		is.OK(t, err) // create file
+
+		_, err = fsys.CreateByHash(WithUser(ctx, alice), "world.txt", uuid.Nil, int64(len(content)), sum[:])
+		is.OK(t, err) // create file by hash
+	})
+
+	t.Run("ErrNotExist", func(t *testing.T) {
+		fsys, ctx := newTestFS(t), context.Background()
+
+		alice, err := fsys.CreateUser(ctx, "alice", false)
+		is.OK(t, err) // create user
+		bob, err := fsys.CreateUser(ctx, "bob", false)
+		is.OK(t, err) // create user
+		file, err := fsys.Create(WithUser(ctx, alice), "hello.txt", strings.NewReader(content), uuid.Nil)
+		is.OK(t, err) // create file
+
+		// the content of a file bob cannot read is not revealed
+		_, err = fsys.CreateByHash(WithUser(ctx, bob), "world.txt", uuid.Nil, int64(len(content)), sum[:])
+		is.NotOK(t, err, dberrors.ErrNotExist)
+
+		err = fsys.SetACL(WithUser(ctx, alice), file, ACLEntry{Principal: bob, Perm: PermRead})
+		is.OK(t, err) // share file
+		_, err = fsys.CreateByHash(WithUser(ctx, bob), "world.txt", uuid.Nil, int64(len(content)), sum[:])
+		is.OK(t, err) // create file by hash
+	})
+}
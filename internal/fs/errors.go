@@ -17,11 +17,14 @@ func Error(err error) error {
 	if err == pgx.ErrNoRows {
 		return fmt.Errorf("fs: no entry for file: %w", dberrors.ErrNotExist)
 	}
+	var pe *pgconn.PgError
 	switch {
-	case errors.As(err, new(*pgconn.PgError)):
-		switch pe := err.(*pgconn.PgError); pe.Code {
+	case errors.As(err, &pe):
+		switch pe.Code {
 		case "23505": // unique constraint (i.e. fs_expr_name_key)
 			return fmt.Errorf("file name taken: %w", dberrors.ErrExist)
+		case "23503": // foreign key violation (i.e. missing parent directory)
+			return fmt.Errorf("fs: no entry for parent: %w", dberrors.ErrNotExist)
 		}
 	}
 	debug.Printf(`fs: %T, %v := err`, err, err)
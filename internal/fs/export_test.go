@@ -0,0 +1,13 @@
+package fs
+
+import "context"
+
+const (
+	BlockSize = blockSize
+	MaxBlocks = maxBlocks
+)
+
+// NewFile returns a [File] of the content described by fi that is read from d.
+func NewFile(ctx context.Context, fi FileInfo, d Downloader) *File {
+	return &File{Info: fi, ctx: ctx, d: d}
+}
@@ -1,11 +1,17 @@
 package fs
 
 import (
+	"context"
 	"encoding/hex"
+	"fmt"
 	"io"
+	"net/http"
+	"os"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	dberrors "go.adoublef/eyeoh/internal/database/errors"
 	olog "go.opentelemetry.io/contrib/bridges/otelslog"
 	"go.opentelemetry.io/otel"
 )
@@ -18,9 +24,173 @@ var (
 	_      = olog.NewLogger(scopeName)
 )
 
+const (
+	// blockSize is the number of bytes of content fetched by each read of a [File].
+	blockSize = 1 << 20 // 1MB
+	// maxBlocks is the number of blocks a [File] keeps for reads that follow.
+	maxBlocks = 4
+)
+
+// File is the content of a file opened with [FS.Open]. Only the blocks that are
+// read are downloaded, so a File can be read from any offset. It implements
+// [io.ReaderAt] and [io.ReadSeeker] so it can be used with [net/http.ServeContent],
+// [archive/zip.NewReader] and the like.
+//
+// A File is read with the context it was opened with.
 type File struct {
-	io.ReadCloser
 	Info FileInfo
+
+	ctx context.Context
+	d   Downloader
+	// off is the offset of the next call to [File.Read].
+	off int64
+
+	mu     sync.Mutex
+	blocks []block // least recently used first
+	closed bool
+}
+
+// block is the content of a [File] from the offset i*blockSize.
+type block struct {
+	i int64
+	p []byte
+}
+
+var (
+	_ io.ReaderAt   = (*File)(nil)
+	_ io.ReadSeeker = (*File)(nil)
+	_ io.Closer     = (*File)(nil)
+)
+
+// Read reads up to len(p) bytes from the current offset of f.
+func (f *File) Read(p []byte) (int, error) {
+	n, err := f.ReadAt(p, f.off)
+	f.off += int64(n)
+	if err == io.EOF && n > 0 {
+		// the end is reported by the next call, as it is by most readers
+		err = nil
+	}
+	return n, err
+}
+
+// ReadAt reads len(p) bytes from off, or fewer with [io.EOF] at the end of f.
+// It is safe to call in parallel.
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("fs: negative offset: %w", dberrors.ErrInvalid)
+	}
+	var n int
+	for n < len(p) && off < f.Info.Size {
+		b, err := f.block(off / blockSize)
+		if err != nil {
+			return n, err
+		}
+		m := copy(p[n:], b[off%blockSize:])
+		n, off = n+m, off+int64(m)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Seek sets the offset of the next call to [File.Read], with the semantics of [io.Seeker].
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		offset += f.Info.Size
+	default:
+		return 0, fmt.Errorf("fs: invalid whence %d: %w", whence, dberrors.ErrInvalid)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("fs: negative offset: %w", dberrors.ErrInvalid)
+	}
+	f.off = offset
+	return offset, nil
+}
+
+// Close releases the blocks of f. Reads after Close fail with [os.ErrClosed].
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return os.ErrClosed
+	}
+	f.blocks, f.closed = nil, true
+	return nil
+}
+
+// block returns the i-th block of f, downloading it if it is not kept. Blocks
+// are downloaded without the lock held, so that reads of other blocks are not
+// held up; a block read by two calls at once may be downloaded twice.
+func (f *File) block(i int64) ([]byte, error) {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return nil, os.ErrClosed
+	}
+	for j, b := range f.blocks {
+		if b.i == i {
+			// move to the back, as the most recently used
+			f.blocks = append(append(f.blocks[:j:j], f.blocks[j+1:]...), b)
+			f.mu.Unlock()
+			return b.p, nil
+		}
+	}
+	f.mu.Unlock()
+
+	off := i * blockSize
+	rc, err := f.d.DownloadRange(f.ctx, f.Info.Ref, off, min(blockSize, f.Info.Size-off))
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	p, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(p)) != min(blockSize, f.Info.Size-off) {
+		return nil, fmt.Errorf("fs: short read of block %d: %w", i, io.ErrUnexpectedEOF)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.closed {
+		f.blocks = append(f.blocks, block{i, p})
+		if len(f.blocks) > maxBlocks {
+			f.blocks = f.blocks[1:]
+		}
+	}
+	return p, nil
+}
+
+// contentType returns the content type that was kept with the content of f, or
+// sniffs it from the first bytes.
+func (f *File) contentType() (string, error) {
+	if f.Info.IsDir {
+		return "inode/directory", nil
+	}
+	_, mime, err := f.d.Head(f.ctx, f.Info.Ref)
+	if err != nil || mime != "" {
+		return mime, err
+	}
+	if f.Info.Size == 0 {
+		return http.DetectContentType(nil), nil
+	}
+	// only the bytes that are sniffed are downloaded, not a whole block
+	rc, err := f.d.DownloadRange(f.ctx, f.Info.Ref, 0, min(f.Info.Size, 512))
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	p, err := io.ReadAll(rc)
+	if err != nil {
+		return "", err
+	}
+	return http.DetectContentType(p), nil
 }
 
 type FileInfo struct {
@@ -30,11 +200,15 @@ type FileInfo struct {
 	Size    int64     `json:"size"`
 	ModTime time.Time `json:"modifiedAt"`
 	IsDir   bool      `json:"isDir"`
+	// UploadLink is the upload link the file was added with, if any. It is only
+	// set by [FS.Stat].
+	UploadLink *uuid.UUID `json:"uploadLinkId,omitempty"`
 }
 
 type DirEntry struct {
-	Path string
+	Path string `json:"path,omitempty"`
 	FileInfo
+	ETag Etag `json:"etag,omitempty"`
 }
 
 type Etag []byte
@@ -43,14 +217,18 @@ func (e Etag) String() string {
 	return hex.EncodeToString(e)
 }
 
+func (e Etag) MarshalText() ([]byte, error) {
+	return []byte(e.String()), nil
+}
+
 type dirEntry struct {
-	//lint:ignore U1000 ignore this field for now
 	id uuid.UUID
 	//lint:ignore U1000 ignore this field for now
 	root  *uuid.UUID // can be null
 	name  Name       // using Name
 	modAt time.Time
 	v     uint64
+	link  *uuid.UUID
 }
 
 type blobData struct {
@@ -61,3 +239,17 @@ type blobData struct {
 	modAt time.Time
 	sha   []byte // for files
 }
+
+// info returns the [FileInfo] for a directory entry and its latest blob data, if any.
+func (de dirEntry) info(bd blobData) FileInfo {
+	return FileInfo{
+		ID:      de.id,
+		Ref:     value(bd.id),
+		Name:    de.name,
+		Size:    value(bd.sz),
+		ModTime: de.modAt,
+		IsDir:   bd.sz == nil, // todo: maybe check if blobdata exists instead
+
+		UploadLink: de.link,
+	}
+}
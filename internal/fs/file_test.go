@@ -0,0 +1,247 @@
+package fs_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+	dberrors "go.adoublef/eyeoh/internal/database/errors"
+	. "go.adoublef/eyeoh/internal/fs"
+	"go.adoublef/eyeoh/internal/testing/is"
+)
+
+// memDownloader is a [Downloader] of a single object held in memory, that
+// records the offset of each range that is downloaded.
+type memDownloader struct {
+	p    []byte
+	offs []int64
+}
+
+func (d *memDownloader) Download(ctx context.Context, id uuid.UUID) (io.ReadCloser, string, error) {
+	return io.NopCloser(bytes.NewReader(d.p)), "", nil
+}
+
+func (d *memDownloader) DownloadRange(ctx context.Context, id uuid.UUID, off, n int64) (io.ReadCloser, error) {
+	d.offs = append(d.offs, off)
+	return io.NopCloser(bytes.NewReader(d.p[off : off+n])), nil
+}
+
+func (d *memDownloader) Head(ctx context.Context, id uuid.UUID) (int64, string, error) {
+	return int64(len(d.p)), "", nil
+}
+
+// newFile returns a [File] of sz bytes of content, along with the content and
+// the downloader it is read from.
+func newFile(sz int) (*File, []byte, *memDownloader) {
+	p := make([]byte, sz)
+	for i := range p {
+		p[i] = byte(i % 251)
+	}
+	d := &memDownloader{p: p}
+	return NewFile(context.Background(), FileInfo{Size: int64(sz)}, d), p, d
+}
+
+func Test_File(t *testing.T) {
+	t.Run("ReadAt", func(t *testing.T) {
+		const sz = 2*BlockSize + 10
+
+		type testcase struct {
+			off int64
+			len int
+			n   int
+			err error
+		}
+		var tt = map[string]testcase{
+			"OK": {
+				off: 10,
+				len: 100,
+				n:   100,
+			},
+			"Boundary": {
+				off: BlockSize - 5,
+				len: 10,
+				n:   10,
+			},
+			"Boundaries": {
+				off: BlockSize - 1,
+				len: BlockSize + 2,
+				n:   BlockSize + 2,
+			},
+			"End": {
+				off: sz - 10,
+				len: 10,
+				n:   10,
+			},
+			"Short": {
+				off: sz - 3,
+				len: 10,
+				n:   3,
+				err: io.EOF,
+			},
+			"EOF": {
+				off: sz,
+				len: 1,
+				err: io.EOF,
+			},
+			"PastEOF": {
+				off: sz + 5,
+				len: 1,
+				err: io.EOF,
+			},
+			"ErrNegative": {
+				off: -1,
+				len: 1,
+				err: dberrors.ErrInvalid,
+			},
+		}
+		for name, tc := range tt {
+			t.Run(name, func(t *testing.T) {
+				f, content, _ := newFile(sz)
+
+				p := make([]byte, tc.len)
+				n, err := f.ReadAt(p, tc.off)
+				is.NotOK(t, err, tc.err)
+				is.Equal(t, n, tc.n)
+				if tc.n > 0 {
+					is.True(t, bytes.Equal(p[:n], content[tc.off:tc.off+int64(n)]))
+				}
+			})
+		}
+	})
+
+	t.Run("Read", func(t *testing.T) {
+		f, content, _ := newFile(BlockSize + 10)
+
+		p, err := io.ReadAll(f)
+		is.OK(t, err) // read content
+		is.True(t, bytes.Equal(p, content))
+
+		n, err := f.Read(make([]byte, 1))
+		is.Equal(t, n, 0)
+		is.NotOK(t, err, io.EOF)
+	})
+
+	t.Run("Seek", func(t *testing.T) {
+		const sz = BlockSize + 10
+
+		type testcase struct {
+			offset int64
+			whence int
+			want   int64
+			err    error
+		}
+		// each case seeks from an offset of 100
+		var tt = map[string]testcase{
+			"Start": {
+				offset: 5,
+				whence: io.SeekStart,
+				want:   5,
+			},
+			"Current": {
+				offset: 5,
+				whence: io.SeekCurrent,
+				want:   105,
+			},
+			"CurrentBack": {
+				offset: -50,
+				whence: io.SeekCurrent,
+				want:   50,
+			},
+			"End": {
+				offset: -10,
+				whence: io.SeekEnd,
+				want:   sz - 10,
+			},
+			"PastEnd": {
+				offset: 10,
+				whence: io.SeekEnd,
+				want:   sz + 10,
+			},
+			"ErrStart": {
+				offset: -1,
+				whence: io.SeekStart,
+				want:   100,
+				err:    dberrors.ErrInvalid,
+			},
+			"ErrCurrent": {
+				offset: -101,
+				whence: io.SeekCurrent,
+				want:   100,
+				err:    dberrors.ErrInvalid,
+			},
+			"ErrEnd": {
+				offset: -sz - 1,
+				whence: io.SeekEnd,
+				want:   100,
+				err:    dberrors.ErrInvalid,
+			},
+			"ErrWhence": {
+				offset: 0,
+				whence: 3,
+				want:   100,
+				err:    dberrors.ErrInvalid,
+			},
+		}
+		for name, tc := range tt {
+			t.Run(name, func(t *testing.T) {
+				f, content, _ := newFile(sz)
+				_, err := f.Seek(100, io.SeekStart)
+				is.OK(t, err) // seek to start
+
+				off, err := f.Seek(tc.offset, tc.whence)
+				is.NotOK(t, err, tc.err)
+				if tc.err == nil {
+					is.Equal(t, off, tc.want)
+				}
+
+				// a failed seek leaves the offset where it was
+				p := make([]byte, 1)
+				n, err := f.Read(p)
+				if tc.want >= sz {
+					is.Equal(t, n, 0)
+					is.NotOK(t, err, io.EOF)
+					return
+				}
+				is.OK(t, err) // read from offset
+				is.Equal(t, p[:n], content[tc.want:tc.want+1])
+			})
+		}
+	})
+
+	t.Run("Cache", func(t *testing.T) {
+		f, _, d := newFile((MaxBlocks+1)*BlockSize + 10)
+
+		read := func(i int64) {
+			t.Helper()
+			_, err := f.ReadAt(make([]byte, 1), i*BlockSize)
+			is.OK(t, err) // read block
+		}
+		for i := range int64(MaxBlocks) {
+			read(i)
+		}
+		// a block that is kept is not downloaded again, and is the last to go
+		read(0)
+		read(0)
+		is.Equal(t, len(d.offs), MaxBlocks)
+
+		// the least recently used block is evicted
+		read(MaxBlocks)
+		read(0)
+		is.Equal(t, len(d.offs), MaxBlocks+1)
+		read(1)
+		is.Equal(t, len(d.offs), MaxBlocks+2)
+		is.Equal(t, d.offs[len(d.offs)-1], BlockSize)
+	})
+
+	t.Run("ErrClosed", func(t *testing.T) {
+		f, _, _ := newFile(10)
+
+		is.OK(t, f.Close())
+		_, err := f.ReadAt(make([]byte, 1), 0)
+		is.NotOK(t, err, os.ErrClosed)
+		is.NotOK(t, f.Close(), os.ErrClosed)
+	})
+}
@@ -2,12 +2,13 @@ package fs
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/base64"
 	"errors"
+	"fmt"
 	"io"
+	"time"
 
 	"github.com/google/uuid"
+	dberrors "go.adoublef/eyeoh/internal/database/errors"
 	"go.adoublef/eyeoh/internal/runtime/debug"
 )
 
@@ -15,94 +16,138 @@ var (
 	ErrOpenFile = errors.New("cannot open file")
 )
 
+const (
+	// DefaultReadDirLimit is the number of entries returned by [DB.ReadDir] if no limit is given.
+	DefaultReadDirLimit = 100
+	// MaxReadDirLimit is the largest number of entries that should be requested from [DB.ReadDir].
+	MaxReadDirLimit = 1000
+)
+
 type Uploader interface {
-	Upload(ctx context.Context, r io.Reader) (id uuid.UUID, sz int64, err error)
+	Upload(ctx context.Context, id uuid.UUID, r io.Reader) (sz int64, err error)
 }
 type Downloader interface {
 	Download(ctx context.Context, id uuid.UUID) (rc io.ReadCloser, mime string, err error)
+	DownloadRange(ctx context.Context, id uuid.UUID, off, n int64) (io.ReadCloser, error)
+	Head(ctx context.Context, id uuid.UUID) (sz int64, mime string, err error)
+}
+type Deleter interface {
+	Delete(ctx context.Context, ids ...uuid.UUID) error
+}
+type Lister interface {
+	List(ctx context.Context, fn func(id uuid.UUID, sz int64, modTime time.Time) error) error
 }
 type FS struct {
 	*DB
 	Uploader
 	Downloader
+	Deleter
+	Lister
+	PartUploader
+	// MaxVersions is the number of versions kept for a file without its own limit.
+	// If zero, every version is kept.
+	MaxVersions int
+	// ShareKey signs share links. Share links cannot be created without it.
+	ShareKey []byte
 }
 
+// Create uploads the content of r as a new file named filename within parent.
+// The upload is recorded before it is written, so that a failure of either the
+// database or the blob store can be recovered from with [FS.Reconcile].
 func (fsys *FS) Create(ctx context.Context, filename Name, r io.Reader, parent uuid.UUID) (file uuid.UUID, err error) {
-	file, err = fsys.Touch(ctx, filename, parent)
+	// fail before the upload is over quota, the quota is checked again on commit
+	qr, err := fsys.limit(ctx, parent, 1, r)
 	if err != nil {
 		return uuid.Nil, err
 	}
-	// what if the s3 goes down shortly
-	// we must rollback the request that created the header
-	// but it too could go down, so need something like temporal
-	// to figure it out for us. add this next
-	//
-	// this calculation should likely be handled by downloader given size is also handled by it.
-	//
-	// introduce an uploads table that is used to query inflight attempts to upload a file.
-	// this means two db call look ups potentially 1) fs.dir_entry, 2) up.inflight
-	// nil error in both cases for this request to be allowed to proceed.
-	h := sha256.New()
-	tr := io.TeeReader(r, h)
-	// seek to find out the content type may not work with encryption?
-	ref, sz, err := fsys.Upload(ctx, tr)
+	id, err := fsys.BeginCreate(ctx, filename, parent)
 	if err != nil {
 		return uuid.Nil, err
 	}
-	debug.Printf(`ref, %d, err := fsys.Upload(ctx, tr)`, sz)
-	if err := fsys.Cat(ctx, ref, sz, h.Sum(nil), file, 0); err != nil {
+	// seek to find out the content type may not work with encryption?
+	if _, err := fsys.write(ctx, id, qr); err != nil {
+		if qr.err != nil {
+			err = qr.err
+		}
+		aerr := fsys.abort(context.WithoutCancel(ctx), id)
+		debug.Printf(`%v := fsys.abort(ctx, %q)`, aerr, id)
+		return uuid.Nil, err
+	}
+	file, err = fsys.commit(ctx, id)
+	if err != nil {
+		aerr := fsys.abort(context.WithoutCancel(ctx), id)
+		debug.Printf(`%v := fsys.abort(ctx, %q)`, aerr, id)
 		return uuid.Nil, err
 	}
 	return file, nil
 }
 
-func (fsys *FS) Open(ctx context.Context, file uuid.UUID) (f *File, mime string, etag Etag, err error) {
-	fi, _, sha, err := fsys.Stat(ctx, file)
+// Replace writes the content of r as the latest version of file, if v is its current
+// version. If the version does not match, the uploaded blob is deleted and
+// [dberrors.ErrStale] is returned. It returns the new version and etag of the file.
+func (fsys *FS) Replace(ctx context.Context, file uuid.UUID, r io.Reader, v uint64) (uint64, Etag, error) {
+	// fail before the upload if possible, the version is checked again on commit
+	fi, cur, _, err := fsys.Stat(ctx, file)
 	if err != nil {
-		return nil, "", nil, err
+		return 0, nil, err
 	}
-	// does the stdlib allow opening a directory or can only read?
-	// any id seems to allow this to be pass, which is wrong.
-	// for folders I can just check with [FS.Stat] but
-	// I should check that an error can be returned at this level
-	// we need to cause a block
 	if fi.IsDir {
-		// return a file that has no body
-		// let the caller determine what they want to do with this.
-		return &File{ReadCloser: io.NopCloser(nil), Info: fi}, "inode/directory", nil, nil
+		return 0, nil, fmt.Errorf("fs: is a directory: %w", dberrors.ErrInvalid)
+	}
+	if cur != v {
+		return 0, nil, fmt.Errorf("fs: file was modified: %w", dberrors.ErrStale)
 	}
-	rc, mime, err := fsys.Download(ctx, fi.Ref)
+	qr, err := fsys.limit(ctx, file, 0, r)
 	if err != nil {
-		return nil, "", nil, err
+		return 0, nil, err
 	}
-	return &File{ReadCloser: rc, Info: fi}, mime, sha, nil
-}
-
-type Cursor struct {
-	Next uuid.UUID
-}
-
-func (c Cursor) String() string {
-	return "next:" + c.Next.String()
-}
-
-func (c Cursor) Base64() string {
-	// serialize as a string
-	// [uuid],[...]
-	s := c.Next.String()
-	return base64.StdEncoding.EncodeToString([]byte(s))
+	id, err := fsys.BeginReplace(ctx, file, v)
+	if err != nil {
+		return 0, nil, err
+	}
+	sha, err := fsys.write(ctx, id, qr)
+	if err != nil {
+		if qr.err != nil {
+			err = qr.err
+		}
+		aerr := fsys.abort(context.WithoutCancel(ctx), id)
+		debug.Printf(`%v := fsys.abort(ctx, %q)`, aerr, id)
+		return 0, nil, err
+	}
+	if _, err := fsys.commit(ctx, id); err != nil {
+		// nothing references the blob if the write lost a race
+		aerr := fsys.abort(context.WithoutCancel(ctx), id)
+		debug.Printf(`%v := fsys.abort(ctx, %q)`, aerr, id)
+		return 0, nil, err
+	}
+	fsys.prune(ctx, file)
+	return v + 1, sha, nil
 }
 
-func Parse(s string) (Cursor, error) {
-	p, err := base64.URLEncoding.DecodeString(s)
+// Open opens file for reading, see [File]. Nothing is downloaded until the file
+// is read. A directory has no content.
+func (fsys *FS) Open(ctx context.Context, file uuid.UUID) (f *File, mime string, etag Etag, err error) {
+	fi, _, sha, err := fsys.Stat(ctx, file)
 	if err != nil {
-		return Cursor{}, err
+		return nil, "", nil, err
 	}
-	// [uuid],[...]
-	// for now its just [uuid]
-	uid, err := uuid.FromBytes(p)
+	return fsys.open(ctx, fi, sha)
+}
+
+// open returns a [File] of the content described by fi, with its content type.
+func (fsys *FS) open(ctx context.Context, fi FileInfo, sha Etag) (*File, string, Etag, error) {
+	f := &File{Info: fi, ctx: ctx, d: fsys.Downloader}
+	mime, err := f.contentType()
 	if err != nil {
-		return Cursor{}, err
+		return nil, "", nil, err
 	}
-	return Cursor{Next: uid}, nil
+	return f, mime, sha, nil
+}
+
+// ContentType returns the content type of the content described by fi, as
+// returned by [FS.Open], without downloading the content. fi must be returned by
+// [FS.Stat] or [FS.StatVersion].
+func (fsys *FS) ContentType(ctx context.Context, fi FileInfo) (string, error) {
+	f := &File{Info: fi, ctx: ctx, d: fsys.Downloader}
+	return f.contentType()
 }
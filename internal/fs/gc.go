@@ -0,0 +1,118 @@
+package fs
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.adoublef/eyeoh/internal/runtime/debug"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// gcBatchSize is the number of blobs checked against the database at a time.
+const gcBatchSize = 1000
+
+// Referenced returns the blobs in ids that are used by a version of a file
+// or by an upload that is inflight.
+func (d *DB) Referenced(ctx context.Context, ids []uuid.UUID) ([]uuid.UUID, error) {
+	const query = `select r from unnest($1::uuid[]) as r
+where exists (select 1 from fs.blob_data where ref = r or (id = r and ref is null))
+or exists (select 1 from up.inflight where id = r)`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.Int("blob.count", len(ids)),
+	)
+	ctx, span := tracer.Start(ctx, "DB.Referenced", attr)
+	defer span.End()
+
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	rows, err := d.RWC.Query(ctx, query, ids)
+	if err != nil {
+		return nil, Error(err)
+	}
+	refs, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return nil, Error(err)
+	}
+	return refs, nil
+}
+
+// GCOptions configures [FS.GC].
+type GCOptions struct {
+	// Before is the time blobs must have been modified before to be collected,
+	// so that blobs still being written are left alone.
+	Before time.Time
+	// DryRun reports the unreferenced blobs without deleting them.
+	DryRun bool
+	// Orphan is called with each unreferenced blob, if set.
+	Orphan func(id uuid.UUID, sz int64)
+}
+
+// GCStats is the result of [FS.GC].
+type GCStats struct {
+	// Scanned is the number of blobs in the blob store.
+	Scanned int
+	// Orphaned is the number of blobs that were not referenced, and their total size.
+	Orphaned int
+	Size     int64
+}
+
+// GC deletes blobs that are not referenced by any file or upload, in batches.
+func (fsys *FS) GC(ctx context.Context, opts GCOptions) (stats GCStats, err error) {
+	ctx, span := tracer.Start(ctx, "FS.GC", trace.WithAttributes(attribute.Bool("gc.dry_run", opts.DryRun)))
+	defer span.End()
+
+	sizes := make(map[uuid.UUID]int64, gcBatchSize)
+	collect := func() error {
+		if len(sizes) == 0 {
+			return nil
+		}
+		ids := make([]uuid.UUID, 0, len(sizes))
+		for id := range sizes {
+			ids = append(ids, id)
+		}
+		refs, err := fsys.Referenced(ctx, ids)
+		if err != nil {
+			return err
+		}
+		for _, id := range refs {
+			delete(sizes, id)
+		}
+		orphans := make([]uuid.UUID, 0, len(sizes))
+		for id, sz := range sizes {
+			if opts.Orphan != nil {
+				opts.Orphan(id, sz)
+			}
+			stats.Orphaned++
+			stats.Size += sz
+			orphans = append(orphans, id)
+		}
+		clear(sizes)
+		if opts.DryRun {
+			return nil
+		}
+		return fsys.Delete(ctx, orphans...)
+	}
+
+	err = fsys.List(ctx, func(id uuid.UUID, sz int64, modTime time.Time) error {
+		stats.Scanned++
+		if !modTime.Before(opts.Before) {
+			return nil
+		}
+		sizes[id] = sz
+		if len(sizes) < gcBatchSize {
+			return nil
+		}
+		return collect()
+	})
+	if err == nil {
+		err = collect()
+	}
+	debug.Printf(`%d, %d, %v := fsys.GC(ctx, opts)`, stats.Scanned, stats.Orphaned, err)
+	return stats, err
+}
@@ -0,0 +1,49 @@
+package fs_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	. "go.adoublef/eyeoh/internal/fs"
+	"go.adoublef/eyeoh/internal/testing/is"
+)
+
+func Test_GC(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		fsys, ctx := newTestFS(t), context.Background()
+
+		file, err := fsys.Create(ctx, "hello.txt", strings.NewReader("hello, world!"), uuid.Nil)
+		is.OK(t, err) // create file
+
+		// an object that was never committed
+		orphan := uuid.Must(uuid.NewV7())
+		_, err = fsys.Upload(ctx, orphan, strings.NewReader("Hello, World!"))
+		is.OK(t, err) // upload content
+
+		opts := GCOptions{Before: time.Now().Add(time.Minute), DryRun: true}
+		stats, err := fsys.GC(ctx, opts)
+		is.OK(t, err) // report unreferenced blobs
+		is.Equal(t, stats.Scanned, 2)
+		is.Equal(t, stats.Orphaned, 1)
+
+		opts.DryRun = false
+		_, err = fsys.GC(ctx, opts)
+		is.OK(t, err) // delete unreferenced blobs
+
+		stats, err = fsys.GC(ctx, opts)
+		is.OK(t, err) // delete unreferenced blobs
+		is.Equal(t, stats.Scanned, 1)
+		is.Equal(t, stats.Orphaned, 0)
+
+		f, _, _, err := fsys.Open(ctx, file)
+		is.OK(t, err) // open file
+		p, err := io.ReadAll(f)
+		is.OK(t, err) // read file content
+		is.Equal(t, string(p), "hello, world!")
+		is.OK(t, f.Close())
+	})
+}
@@ -0,0 +1,355 @@
+package fs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	dberrors "go.adoublef/eyeoh/internal/database/errors"
+	"go.adoublef/eyeoh/internal/runtime/debug"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Inflight is an upload recorded with [DB.BeginCreate] or [DB.BeginReplace]
+// that has not been committed or aborted.
+type Inflight struct {
+	// ID is the id of the blob being written.
+	ID   uuid.UUID
+	Root uuid.UUID
+	Name Name
+	// File is set if the upload replaces the content of an existing file.
+	File uuid.UUID
+	V    uint64
+	// Upload is set if the content is written in parts with [FS.Append].
+	Upload string
+	// Size and SHA are set once the content has been written.
+	Size    *int64
+	SHA     []byte
+	ModTime time.Time
+}
+
+// BeginCreate records an upload of a new file named name within root.
+// It fails if root is not a directory or the name is taken, unless the file is
+// added through an upload link.
+func (d *DB) BeginCreate(ctx context.Context, name Name, root uuid.UUID) (id uuid.UUID, err error) {
+	const query = `insert into up.inflight (id, root, name, owner, upload_link) values ($1, $2, $3, $4, $5)`
+
+	id, err = uuid.NewV7()
+	if err != nil {
+		return uuid.Nil, Error(err)
+	}
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("upload.id", id.String()),
+		attribute.String("file.root", root.String()),
+	)
+	ctx, span := tracer.Start(ctx, "DB.BeginCreate", attr)
+	defer span.End()
+
+	err = pgx.BeginTxFunc(ctx, d.RWC, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		if err := isDir(ctx, tx, root); err != nil {
+			return err
+		}
+		if err := authorize(ctx, tx, root, PermWrite); err != nil {
+			return err
+		}
+		// fail before the content is written, the name is checked again on commit
+		var taken bool
+		const exists = `select exists (
+	select 1 from fs.dir_entry where root is not distinct from $1 and name = $2)`
+		if err := tx.QueryRow(ctx, exists, ptr(root), name).Scan(&taken); err != nil {
+			return err
+		}
+		// a file dropped through an upload link is renamed on commit instead
+		if taken && uploadLink(ctx) == nil {
+			return fmt.Errorf("file name taken: %w", dberrors.ErrExist)
+		}
+		_, err := tx.Exec(ctx, query, id, ptr(root), name, owner(ctx), uploadLink(ctx))
+		return err
+	})
+	if err != nil {
+		return uuid.Nil, Error(err)
+	}
+	return id, nil
+}
+
+// BeginReplace records an upload of new content for file at version v.
+func (d *DB) BeginReplace(ctx context.Context, file uuid.UUID, v uint64) (id uuid.UUID, err error) {
+	const query = `insert into up.inflight (id, dir_entry, v, owner) values ($1, $2, $3, $4)`
+
+	id, err = uuid.NewV7()
+	if err != nil {
+		return uuid.Nil, Error(err)
+	}
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("upload.id", id.String()),
+		attribute.String("file.id", file.String()),
+		attribute.Int("file.v", int(v)),
+	)
+	ctx, span := tracer.Start(ctx, "DB.BeginReplace", attr)
+	defer span.End()
+
+	if err := authorize(ctx, d.RWC, file, PermWrite); err != nil {
+		return uuid.Nil, Error(err)
+	}
+	if _, err := d.RWC.Exec(ctx, query, id, file, v, owner(ctx)); err != nil {
+		return uuid.Nil, Error(err)
+	}
+	return id, nil
+}
+
+// Written records that the content of the upload was written to the blob store.
+// Once written, an upload can be committed by [FS.Reconcile] if the caller fails to.
+func (d *DB) Written(ctx context.Context, id uuid.UUID, sz int64, sha []byte) error {
+	const query = `update up.inflight set sz = $2, sha = $3, mod_at = now() where id = $1`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("upload.id", id.String()),
+		attribute.Int("file.sz", int(sz)),
+	)
+	ctx, span := tracer.Start(ctx, "DB.Written", attr)
+	defer span.End()
+
+	cmd, err := d.RWC.Exec(ctx, query, id, sz, sha)
+	if err != nil {
+		return Error(err)
+	}
+	return mustRowsAffected(cmd)
+}
+
+// Commit creates the file or adds the version recorded by the upload, in the same
+// transaction that removes the upload. If an object with the same content exists,
+// the version shares it. It returns the id of the file and the object of the version,
+// if it is not id the blob of the upload must be deleted by the caller.
+func (d *DB) Commit(ctx context.Context, id uuid.UUID) (file, obj uuid.UUID, err error) {
+	const query = `select root, name, dir_entry, v, sz, sha, owner, upload_link from up.inflight where id = $1 for update`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("upload.id", id.String()),
+	)
+	ctx, span := tracer.Start(ctx, "DB.Commit", attr)
+	defer span.End()
+
+	err = pgx.BeginTxFunc(ctx, d.RWC, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		var (
+			root, dirEntry *uuid.UUID
+			name           *Name
+			v              *uint64
+			sz             *int64
+			sha            []byte
+			user, link     *uuid.UUID
+		)
+		// the access was checked when the upload began, the owner is the user that began it
+		if err := tx.QueryRow(ctx, query, id).Scan(&root, &name, &dirEntry, &v, &sz, &sha, &user, &link); err != nil {
+			return err
+		}
+		if sz == nil {
+			return fmt.Errorf("fs: upload is not written: %w", dberrors.ErrInvalid)
+		}
+		file = value(dirEntry)
+		if file == uuid.Nil {
+			var err error
+			if file, err = uuid.NewV7(); err != nil {
+				return err
+			}
+			if link != nil {
+				if *name, err = dropName(ctx, tx, *name, value(root), id); err != nil {
+					return err
+				}
+			}
+			cmd, err := tx.Exec(ctx, insertDirEntry, file, value(name), root, user)
+			if err != nil {
+				return err
+			}
+			if err := mustRowsAffected(cmd); err != nil {
+				return fmt.Errorf("fs: no entry for parent: %w", dberrors.ErrNotExist)
+			}
+			if link != nil {
+				if _, err := tx.Exec(ctx, `update fs.dir_entry set upload_link = $2 where id = $1`, file, link); err != nil {
+					return err
+				}
+			}
+		}
+		var err error
+		if obj, err = dedup(ctx, tx, id, *sz, sha); err != nil {
+			return err
+		}
+		var ref uuid.UUID
+		if obj != id {
+			ref = obj
+		}
+		if err := cat(ctx, tx, id, ref, *sz, sha, file, value(v)); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `delete from up.inflight where id = $1`, id)
+		return err
+	})
+	if err != nil {
+		return uuid.Nil, uuid.Nil, Error(err)
+	}
+	return file, obj, nil
+}
+
+// Abort removes the record of an upload. The blob must be deleted by the caller.
+func (d *DB) Abort(ctx context.Context, id uuid.UUID) error {
+	const query = `delete from up.inflight where id = $1`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("upload.id", id.String()),
+	)
+	ctx, span := tracer.Start(ctx, "DB.Abort", attr)
+	defer span.End()
+
+	_, err := d.RWC.Exec(ctx, query, id)
+	return Error(err)
+}
+
+// Inflights returns up to limit uploads last modified before t, oldest first.
+func (d *DB) Inflights(ctx context.Context, t time.Time, limit int) ([]Inflight, error) {
+	const query = `select id, root, name, dir_entry, v, mp_id, sz, sha, mod_at
+from up.inflight
+where mod_at < $1
+order by mod_at
+limit $2`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("upload.before", t.String()),
+	)
+	ctx, span := tracer.Start(ctx, "DB.Inflights", attr)
+	defer span.End()
+
+	rows, err := d.RWC.Query(ctx, query, t, limit)
+	if err != nil {
+		return nil, Error(err)
+	}
+	uploads, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (Inflight, error) {
+		var (
+			in             Inflight
+			root, dirEntry *uuid.UUID
+			name           *Name
+			v              *uint64
+			upload         *string
+		)
+		err := row.Scan(&in.ID, &root, &name, &dirEntry, &v, &upload, &in.Size, &in.SHA, &in.ModTime)
+		in.Root, in.Name, in.File, in.V, in.Upload = value(root), value(name), value(dirEntry), value(v), value(upload)
+		return in, err
+	})
+	if err != nil {
+		return nil, Error(err)
+	}
+	return uploads, nil
+}
+
+// write streams r to the blob of the upload and records its size and hash.
+func (fsys *FS) write(ctx context.Context, id uuid.UUID, r io.Reader) (sha []byte, err error) {
+	h := sha256.New()
+	sz, err := fsys.Upload(ctx, id, io.TeeReader(r, h))
+	if err != nil {
+		return nil, err
+	}
+	debug.Printf(`%d, err := fsys.Upload(ctx, %q, tr)`, sz, id)
+	sha = h.Sum(nil)
+	if err := fsys.Written(ctx, id, sz, sha); err != nil {
+		return nil, err
+	}
+	return sha, nil
+}
+
+// commit commits the upload. If the version shares an existing object, the blob of
+// the upload is deleted, or left for [FS.GC] if that fails.
+func (fsys *FS) commit(ctx context.Context, id uuid.UUID) (file uuid.UUID, err error) {
+	file, obj, err := fsys.Commit(ctx, id)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if obj != id {
+		err := fsys.Delete(ctx, id)
+		debug.Printf(`%v := fsys.Delete(ctx, %q)`, err, id)
+	}
+	return file, nil
+}
+
+// dropName returns name, or a free suffixed name if it is taken under root, so
+// that a file dropped through an upload link is never refused for its name. If
+// every suffix is taken, the name is suffixed with the random bits of the upload id.
+func dropName(ctx context.Context, q querier, name Name, root, id uuid.UUID) (Name, error) {
+	const exists = `select exists (
+	select 1 from fs.dir_entry where root is not distinct from $1 and name = $2)`
+
+	var taken bool
+	if err := q.QueryRow(ctx, exists, ptr(root), name).Scan(&taken); err != nil {
+		return "", err
+	}
+	if !taken {
+		return name, nil
+	}
+	next, err := freeName(ctx, q, name, root)
+	if errors.Is(err, dberrors.ErrExist) {
+		return name.Suffix(int(binary.BigEndian.Uint32(id[12:]))), nil
+	}
+	return next, err
+}
+
+// abort deletes the blob of the upload and its record. If either fails, the upload
+// is left for [FS.Reconcile].
+func (fsys *FS) abort(ctx context.Context, id uuid.UUID) error {
+	if err := fsys.Delete(ctx, id); err != nil {
+		return err
+	}
+	return fsys.Abort(ctx, id)
+}
+
+// Reconcile completes or rolls back uploads last modified before t, which are
+// assumed to have been abandoned. Uploads that were written are committed, unless
+// the commit can no longer succeed, and the rest are aborted. It returns the number
+// of uploads that were committed and aborted.
+func (fsys *FS) Reconcile(ctx context.Context, t time.Time) (committed, aborted int, err error) {
+	const limit = 100
+	for {
+		uploads, err := fsys.Inflights(ctx, t, limit)
+		if err != nil {
+			return committed, aborted, err
+		}
+		for _, in := range uploads {
+			if in.Size != nil {
+				_, err := fsys.commit(ctx, in.ID)
+				switch {
+				case err == nil:
+					committed++
+					continue
+				// the name was taken, the parent was removed, the file was modified
+				// or the tree is full
+				case errors.Is(err, dberrors.ErrExist),
+					errors.Is(err, dberrors.ErrNotExist),
+					errors.Is(err, dberrors.ErrStale),
+					errors.Is(err, dberrors.ErrQuota):
+				default:
+					return committed, aborted, err
+				}
+			}
+			abort := fsys.abort
+			if in.Upload != "" && in.Size == nil {
+				abort = func(ctx context.Context, id uuid.UUID) error { return fsys.abortParts(ctx, id, in.Upload) }
+			}
+			if err := abort(ctx, in.ID); err != nil {
+				return committed, aborted, err
+			}
+			aborted++
+		}
+		if len(uploads) < limit {
+			return committed, aborted, nil
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package fs_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	dberrors "go.adoublef/eyeoh/internal/database/errors"
+	. "go.adoublef/eyeoh/internal/fs"
+	"go.adoublef/eyeoh/internal/testing/is"
+)
+
+// abortCounter counts the multipart uploads that are aborted.
+type abortCounter struct {
+	PartUploader
+	n atomic.Int32
+}
+
+func (p *abortCounter) AbortParts(ctx context.Context, id uuid.UUID, upload string) error {
+	p.n.Add(1)
+	return p.PartUploader.AbortParts(ctx, id, upload)
+}
+
+func Test_Reconcile(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		fsys, ctx := newTestFS(t), context.Background()
+
+		// the upload was written but the caller failed before committing
+		written, err := fsys.BeginCreate(ctx, "hello.txt", uuid.Nil)
+		is.OK(t, err) // record upload
+		sz, err := fsys.Upload(ctx, written, strings.NewReader("Hello, World!"))
+		is.OK(t, err) // upload content
+		is.OK(t, fsys.Written(ctx, written, sz, []byte("sha256")))
+
+		// the caller failed before the content was written
+		_, err = fsys.BeginCreate(ctx, "world.txt", uuid.Nil)
+		is.OK(t, err) // record upload
+
+		committed, aborted, err := fsys.Reconcile(ctx, time.Now().Add(time.Minute))
+		is.OK(t, err) // reconcile uploads
+		is.Equal(t, committed, 1)
+		is.Equal(t, aborted, 1)
+
+		entries, _, err := fsys.ReadDir(ctx, uuid.Nil, Cursor{}, 10)
+		is.OK(t, err) // read directory
+		is.Equal(t, len(entries), 1)
+		is.Equal(t, entries[0].Name, "hello.txt")
+		is.Equal(t, entries[0].Size, sz)
+	})
+
+	t.Run("Multipart", func(t *testing.T) {
+		fsys, ctx := newTestFS(t), context.Background()
+		parts := &abortCounter{PartUploader: fsys.PartUploader}
+		fsys.PartUploader = parts
+
+		// the client went away before the first part was written
+		id, _, err := fsys.CreateResumable(ctx, "hello.txt", uuid.Nil, 14)
+		is.OK(t, err) // create resumable upload
+
+		committed, aborted, err := fsys.Reconcile(ctx, time.Now().Add(time.Minute))
+		is.OK(t, err) // reconcile uploads
+		is.Equal(t, committed, 0)
+		is.Equal(t, aborted, 1)
+		is.Equal(t, parts.n.Load(), 1)
+
+		_, err = fsys.Resumable(ctx, id)
+		is.True(t, errors.Is(err, dberrors.ErrNotExist))
+	})
+}
@@ -0,0 +1,204 @@
+// Package iofs adapts a [fs.FS] to the interfaces of [io/fs], so that it can be
+// used with [net/http.FileServerFS], [html/template.ParseFS] and the like.
+package iofs
+
+import (
+	"context"
+	"errors"
+	"io"
+	iofs "io/fs"
+	"time"
+
+	dberrors "go.adoublef/eyeoh/internal/database/errors"
+	"go.adoublef/eyeoh/internal/fs"
+)
+
+// FS is a read-only view of a [fs.FS] where slash separated paths are
+// resolved from the top-level directory.
+type FS struct {
+	// ctx is used for each call, as the methods of [iofs.FS] take no context.
+	ctx  context.Context
+	fsys *fs.FS
+}
+
+var (
+	_ iofs.FS        = (*FS)(nil)
+	_ iofs.ReadDirFS = (*FS)(nil)
+	_ iofs.StatFS    = (*FS)(nil)
+)
+
+// New returns a [FS] for fsys. Every call is made with ctx.
+func New(ctx context.Context, fsys *fs.FS) *FS {
+	return &FS{ctx, fsys}
+}
+
+// Open opens the named file or directory. The content of a file is downloaded
+// from the blob store as it is read, and a file implements [io.Seeker] and
+// [io.ReaderAt] so that [net/http.FileServerFS] can serve ranges of it.
+func (f *FS) Open(name string) (iofs.File, error) {
+	de, err := f.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if de.IsDir {
+		return &dir{fsys: f, name: name, info: fileInfo{de}, c: fs.Cursor{Sort: fs.SortName}}, nil
+	}
+	rc, _, _, err := f.fsys.Open(f.ctx, de.ID)
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+	return &file{rc, fileInfo{de}}, nil
+}
+
+// Stat returns a [iofs.FileInfo] describing the named file or directory.
+func (f *FS) Stat(name string) (iofs.FileInfo, error) {
+	de, err := f.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return fileInfo{de}, nil
+}
+
+// ReadDir reads the named directory and returns its entries sorted by filename.
+func (f *FS) ReadDir(name string) ([]iofs.DirEntry, error) {
+	de, err := f.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !de.IsDir {
+		return nil, &iofs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	d := &dir{fsys: f, name: name, info: fileInfo{de}, c: fs.Cursor{Sort: fs.SortName}}
+	return d.ReadDir(-1)
+}
+
+// lookup returns the entry at name, which must be a valid path as defined by [iofs.ValidPath].
+func (f *FS) lookup(op, name string) (fs.DirEntry, error) {
+	if !iofs.ValidPath(name) {
+		return fs.DirEntry{}, &iofs.PathError{Op: op, Path: name, Err: iofs.ErrInvalid}
+	}
+	if name == "." {
+		name = "/"
+	}
+	de, err := f.fsys.Lookup(f.ctx, name)
+	// a name that is not valid for an entry cannot exist
+	if errors.Is(err, dberrors.ErrInvalid) {
+		err = dberrors.ErrNotExist
+	}
+	if err != nil {
+		return fs.DirEntry{}, pathError(op, name, err)
+	}
+	return de, nil
+}
+
+var (
+	_ io.ReadSeeker = (*file)(nil)
+	_ io.ReaderAt   = (*file)(nil)
+)
+
+// file is a regular file opened with [FS.Open].
+type file struct {
+	*fs.File
+	info fileInfo
+}
+
+func (f *file) Stat() (iofs.FileInfo, error) { return f.info, nil }
+
+// dir is a directory opened with [FS.Open]. Its entries are read a page at a time.
+type dir struct {
+	fsys *FS
+	name string
+	info fileInfo
+	// c is the position of the next page and buf holds the entries not yet returned.
+	c   fs.Cursor
+	buf []fs.DirEntry
+	eof bool
+}
+
+func (d *dir) Stat() (iofs.FileInfo, error) { return d.info, nil }
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &iofs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *dir) Close() error { return nil }
+
+// ReadDir reads the entries of the directory, with the semantics of [iofs.ReadDirFile].
+func (d *dir) ReadDir(n int) ([]iofs.DirEntry, error) {
+	for !d.eof && (n <= 0 || len(d.buf) < n) {
+		entries, next, err := d.fsys.fsys.ReadDir(d.fsys.ctx, d.info.ID, d.c, fs.MaxReadDirLimit)
+		if err != nil {
+			return nil, pathError("readdir", d.name, err)
+		}
+		d.buf = append(d.buf, entries...)
+		d.c, d.eof = next, next.IsZero()
+	}
+	m := len(d.buf)
+	if n > 0 {
+		if m == 0 {
+			return nil, io.EOF
+		}
+		m = min(m, n)
+	}
+	list := make([]iofs.DirEntry, m)
+	for i, de := range d.buf[:m] {
+		list[i] = dirEntry{fileInfo{de}}
+	}
+	d.buf = d.buf[m:]
+	return list, nil
+}
+
+// fileInfo implements [iofs.FileInfo] for an entry.
+type fileInfo struct {
+	fs.DirEntry
+}
+
+func (fi fileInfo) Name() string {
+	// the top-level directory has no name
+	if fi.DirEntry.Name == "" {
+		return "."
+	}
+	return fi.DirEntry.Name.String()
+}
+
+func (fi fileInfo) Size() int64 { return fi.DirEntry.Size }
+
+func (fi fileInfo) Mode() iofs.FileMode {
+	if fi.DirEntry.IsDir {
+		return iofs.ModeDir | 0o555
+	}
+	return 0o444
+}
+
+func (fi fileInfo) ModTime() time.Time { return fi.DirEntry.ModTime }
+
+func (fi fileInfo) IsDir() bool { return fi.DirEntry.IsDir }
+
+// Sys returns the [fs.FileInfo] of the entry.
+func (fi fileInfo) Sys() any { return fi.DirEntry.FileInfo }
+
+// dirEntry implements [iofs.DirEntry] for an entry.
+type dirEntry struct {
+	info fileInfo
+}
+
+func (de dirEntry) Name() string { return de.info.Name() }
+
+func (de dirEntry) IsDir() bool { return de.info.IsDir() }
+
+func (de dirEntry) Type() iofs.FileMode { return de.info.Mode().Type() }
+
+func (de dirEntry) Info() (iofs.FileInfo, error) { return de.info, nil }
+
+// pathError maps the errors of [fs.FS] to those of [iofs].
+func pathError(op, name string, err error) error {
+	switch {
+	case errors.Is(err, dberrors.ErrNotExist):
+		err = iofs.ErrNotExist
+	case errors.Is(err, dberrors.ErrPermission):
+		err = iofs.ErrPermission
+	case errors.Is(err, dberrors.ErrInvalid):
+		err = iofs.ErrInvalid
+	}
+	return &iofs.PathError{Op: op, Path: name, Err: err}
+}
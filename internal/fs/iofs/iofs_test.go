@@ -0,0 +1,77 @@
+package iofs_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	iofs "io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"testing/iotest"
+
+	"github.com/google/uuid"
+	. "go.adoublef/eyeoh/internal/fs/iofs"
+	"go.adoublef/eyeoh/internal/testing/is"
+)
+
+func Test_FS(t *testing.T) {
+	t.Run("TestFS", func(t *testing.T) {
+		fsys, ctx := newTestFS(t), context.Background()
+
+		// src/hello.txt, src/lib/world.txt, README.md
+		src, err := fsys.Mkdir(ctx, "src", uuid.Nil)
+		is.OK(t, err) // create directory
+		lib, err := fsys.Mkdir(ctx, "lib", src)
+		is.OK(t, err) // create directory
+		_, err = fsys.Create(ctx, "hello.txt", strings.NewReader("Hello, World!"), src)
+		is.OK(t, err) // create file
+		_, err = fsys.Create(ctx, "world.txt", strings.NewReader("Hello, again!"), lib)
+		is.OK(t, err) // create file
+		_, err = fsys.Create(ctx, "README.md", strings.NewReader("# eyeoh"), uuid.Nil)
+		is.OK(t, err) // create file
+
+		err = fstest.TestFS(New(ctx, fsys), "README.md", "src/hello.txt", "src/lib/world.txt")
+		is.OK(t, err) // pass the io/fs conformance tests
+	})
+
+	t.Run("ReadFile", func(t *testing.T) {
+		fsys, ctx := newTestFS(t), context.Background()
+
+		_, err := fsys.Create(ctx, "hello.txt", strings.NewReader("Hello, World!"), uuid.Nil)
+		is.OK(t, err) // create file
+
+		p, err := iofs.ReadFile(New(ctx, fsys), "hello.txt")
+		is.OK(t, err) // read file content
+		is.Equal(t, string(p), "Hello, World!")
+	})
+
+	t.Run("Seek", func(t *testing.T) {
+		fsys, ctx := newTestFS(t), context.Background()
+
+		// spans more blocks than are kept
+		content := make([]byte, 5<<20+7)
+		for i := range content {
+			content[i] = byte(i % 251)
+		}
+		_, err := fsys.Create(ctx, "blob.bin", bytes.NewReader(content), uuid.Nil)
+		is.OK(t, err) // create file
+
+		f, err := New(ctx, fsys).Open("blob.bin")
+		is.OK(t, err) // open file
+		t.Cleanup(func() { f.Close() })
+
+		rs, ok := f.(io.ReadSeeker)
+		is.True(t, ok)                           // file can seek
+		is.OK(t, iotest.TestReader(rs, content)) // read, read at and seek
+	})
+
+	t.Run("ErrNotExist", func(t *testing.T) {
+		fsys, ctx := newTestFS(t), context.Background()
+
+		for _, name := range []string{"hello.txt", "src/hello.txt", "hello world.txt"} {
+			_, err := New(ctx, fsys).Open(name)
+			is.NotOK(t, err, iofs.ErrNotExist)
+		}
+	})
+}
@@ -0,0 +1,17 @@
+package iofs_test
+
+import (
+	"testing"
+
+	"go.adoublef/eyeoh/internal/fs"
+	"go.adoublef/eyeoh/internal/testing/storetest"
+)
+
+// newTestFS returns a [fs.FS] for use within tests.
+// A new bucket is created for each call.
+func newTestFS(tb testing.TB) *fs.FS {
+	tb.Helper()
+	return storetest.New(tb).FS(tb)
+}
+
+func TestMain(m *testing.M) { storetest.Main(m) }
@@ -0,0 +1,257 @@
+package fs
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	dberrors "go.adoublef/eyeoh/internal/database/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// KeyPrefix starts every api key, so they can be told apart from other tokens.
+const KeyPrefix = "eo_"
+
+// Key is an api key of a user. The secret is only known when it is created.
+type Key struct {
+	ID        uuid.UUID  `json:"keyId"`
+	User      uuid.UUID  `json:"userId"`
+	Name      string     `json:"name,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
+
+// CreateKey creates an api key for user, named name for the user to recognise it.
+// If ttl is positive the key expires after it. Users can create their own keys
+// and an admin can create keys for anyone. It returns the token of the key, which
+// cannot be recovered.
+func (d *DB) CreateKey(ctx context.Context, user uuid.UUID, name string, ttl time.Duration) (token string, k Key, err error) {
+	const query = `insert into fs.api_key (id, usr, name, hash, expires_at)
+select $1, id, $3, $4, $5 from fs.principal where id = $2 and not grp
+returning created_at`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("principal.user", user.String()),
+	)
+	ctx, span := tracer.Start(ctx, "DB.CreateKey", attr)
+	defer span.End()
+
+	if ttl < 0 {
+		return "", Key{}, fmt.Errorf("fs: ttl must not be negative: %w", dberrors.ErrInvalid)
+	}
+	if err := authorizeUser(ctx, d.RWC, user); err != nil {
+		return "", Key{}, Error(err)
+	}
+	k = Key{User: user, Name: name}
+	if k.ID, err = uuid.NewV7(); err != nil {
+		return "", Key{}, Error(err)
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", Key{}, Error(err)
+	}
+	if ttl > 0 {
+		k.ExpiresAt = ptr(time.Now().Add(ttl).UTC())
+	}
+	sum := sha256.Sum256(secret)
+	err = d.RWC.QueryRow(ctx, query, k.ID, user, name, sum[:], k.ExpiresAt).Scan(&k.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return "", Key{}, fmt.Errorf("fs: no user: %w", dberrors.ErrNotExist)
+	} else if err != nil {
+		return "", Key{}, Error(err)
+	}
+	token = KeyPrefix + hex.EncodeToString(k.ID[:]) + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	return token, k, nil
+}
+
+// RevokeKey revokes the api key id, which cannot be used again.
+func (d *DB) RevokeKey(ctx context.Context, id uuid.UUID) error {
+	const query = `update fs.api_key set revoked_at = now() where id = $1 and revoked_at is null`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("key.id", id.String()),
+	)
+	ctx, span := tracer.Start(ctx, "DB.RevokeKey", attr)
+	defer span.End()
+
+	err := pgx.BeginTxFunc(ctx, d.RWC, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		var user uuid.UUID
+		if err := tx.QueryRow(ctx, `select usr from fs.api_key where id = $1`, id).Scan(&user); err == pgx.ErrNoRows {
+			return fmt.Errorf("fs: no api key: %w", dberrors.ErrNotExist)
+		} else if err != nil {
+			return err
+		}
+		if err := authorizeUser(ctx, tx, user); err != nil {
+			return err
+		}
+		cmd, err := tx.Exec(ctx, query, id)
+		if err != nil {
+			return err
+		}
+		if err := mustRowsAffected(cmd); err != nil {
+			return fmt.Errorf("fs: api key is revoked: %w", dberrors.ErrNotExist)
+		}
+		return nil
+	})
+	return Error(err)
+}
+
+// Keys returns the api keys of user, newest first.
+func (d *DB) Keys(ctx context.Context, user uuid.UUID) ([]Key, error) {
+	const query = `select id, usr, name, created_at, expires_at, revoked_at
+from fs.api_key
+where usr = $1
+order by id desc`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("principal.user", user.String()),
+	)
+	ctx, span := tracer.Start(ctx, "DB.Keys", attr)
+	defer span.End()
+
+	if err := authorizeUser(ctx, d.RWC, user); err != nil {
+		return nil, Error(err)
+	}
+	rows, err := d.RWC.Query(ctx, query, user)
+	if err != nil {
+		return nil, Error(err)
+	}
+	keys, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (Key, error) {
+		var k Key
+		err := row.Scan(&k.ID, &k.User, &k.Name, &k.CreatedAt, &k.ExpiresAt, &k.RevokedAt)
+		return k, err
+	})
+	if err != nil {
+		return nil, Error(err)
+	}
+	return keys, nil
+}
+
+// VerifyKey returns the user of the api key token. It fails with
+// [dberrors.ErrPermission] if the token is not a key that can be used.
+func (d *DB) VerifyKey(ctx context.Context, token string) (uuid.UUID, error) {
+	const query = `select usr, hash from fs.api_key
+where id = $1 and revoked_at is null and (expires_at is null or expires_at > now())`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+	)
+	ctx, span := tracer.Start(ctx, "DB.VerifyKey", attr)
+	defer span.End()
+
+	invalid := fmt.Errorf("fs: invalid api key: %w", dberrors.ErrPermission)
+	s, ok := strings.CutPrefix(token, KeyPrefix)
+	if !ok {
+		return uuid.Nil, invalid
+	}
+	s, enc, ok := strings.Cut(s, "_")
+	if !ok {
+		return uuid.Nil, invalid
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != len(uuid.UUID{}) {
+		return uuid.Nil, invalid
+	}
+	secret, err := base64.RawURLEncoding.DecodeString(enc)
+	if err != nil {
+		return uuid.Nil, invalid
+	}
+	var user uuid.UUID
+	var hash []byte
+	err = d.RWC.QueryRow(ctx, query, uuid.UUID(b)).Scan(&user, &hash)
+	if err == pgx.ErrNoRows {
+		return uuid.Nil, invalid
+	} else if err != nil {
+		return uuid.Nil, Error(err)
+	}
+	sum := sha256.Sum256(secret)
+	if subtle.ConstantTimeCompare(sum[:], hash) != 1 {
+		return uuid.Nil, invalid
+	}
+	span.SetAttributes(attribute.String("principal.user", user.String()))
+	return user, nil
+}
+
+// LinkIdentity links user to the subject sub of the identity provider iss, so
+// that a token issued for the subject authenticates the user. Only an admin can
+// link identities.
+func (d *DB) LinkIdentity(ctx context.Context, user uuid.UUID, iss, sub string) error {
+	const query = `insert into fs.identity (iss, sub, usr)
+select $1, $2, id from fs.principal where id = $3 and not grp`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("principal.user", user.String()),
+		attribute.String("identity.iss", iss),
+	)
+	ctx, span := tracer.Start(ctx, "DB.LinkIdentity", attr)
+	defer span.End()
+
+	if iss == "" || sub == "" {
+		return fmt.Errorf("fs: issuer and subject are required: %w", dberrors.ErrInvalid)
+	}
+	if err := authorize(ctx, d.RWC, uuid.Nil, PermAdmin); err != nil {
+		return Error(err)
+	}
+	cmd, err := d.RWC.Exec(ctx, query, iss, sub, user)
+	if err != nil {
+		return identityError(err)
+	}
+	if err := mustRowsAffected(cmd); err != nil {
+		return fmt.Errorf("fs: no user: %w", dberrors.ErrNotExist)
+	}
+	return nil
+}
+
+// identityError reports a taken subject as such, not as a taken file name.
+func identityError(err error) error {
+	var pe *pgconn.PgError
+	if errors.As(err, &pe) && pe.Code == "23505" {
+		return fmt.Errorf("fs: subject is linked to another user: %w", dberrors.ErrExist)
+	}
+	return Error(err)
+}
+
+// Identity returns the user linked to the subject sub of the identity provider iss.
+func (d *DB) Identity(ctx context.Context, iss, sub string) (uuid.UUID, error) {
+	const query = `select usr from fs.identity where iss = $1 and sub = $2`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("identity.iss", iss),
+	)
+	ctx, span := tracer.Start(ctx, "DB.Identity", attr)
+	defer span.End()
+
+	var user uuid.UUID
+	err := d.RWC.QueryRow(ctx, query, iss, sub).Scan(&user)
+	if err == pgx.ErrNoRows {
+		return uuid.Nil, fmt.Errorf("fs: no user for subject: %w", dberrors.ErrPermission)
+	} else if err != nil {
+		return uuid.Nil, Error(err)
+	}
+	return user, nil
+}
+
+// authorizeUser returns [dberrors.ErrPermission] unless ctx acts as user or an admin.
+func authorizeUser(ctx context.Context, q querier, user uuid.UUID) error {
+	if u, ok := UserFromContext(ctx); ok && u == user {
+		return nil
+	}
+	return authorize(ctx, q, uuid.Nil, PermAdmin)
+}
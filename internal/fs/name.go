@@ -3,6 +3,8 @@ package fs
 import (
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 )
 
 type Name string
@@ -42,3 +44,17 @@ func isAlphaNumeric(ch rune) bool {
 	return (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') ||
 		(ch >= '0' && ch <= '9') || ch == '-' || ch == '_' || ch == '.'
 }
+
+// Suffix returns the name with i appended before the extension (i.e. "hello-1.txt").
+// The base is truncated if the result would be too long.
+func (n Name) Suffix(i int) Name {
+	base, ext := n.String(), ""
+	if j := strings.LastIndexByte(base, '.'); j > 0 {
+		base, ext = base[:j], base[j:]
+	}
+	sfx := "-" + strconv.Itoa(i)
+	if over := len(base) + len(sfx) + len(ext) - 255; over > 0 {
+		base = base[:max(len(base)-over, 0)]
+	}
+	return Name(base + sfx + ext)
+}
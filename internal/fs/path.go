@@ -0,0 +1,203 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	dberrors "go.adoublef/eyeoh/internal/database/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Path is a list of names from a directory to one of its descendants.
+// The empty path is the directory itself.
+type Path []Name
+
+func (p Path) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *Path) UnmarshalText(text []byte) (err error) {
+	*p, err = ParsePath(string(text))
+	if err != nil {
+		return err
+	}
+	if len(*p) == 0 {
+		return errors.New("empty path")
+	}
+	return nil
+}
+
+// String returns the path with a leading slash, as if it starts at the top-level.
+func (p Path) String() string {
+	var sb strings.Builder
+	for _, name := range p {
+		sb.WriteByte('/')
+		sb.WriteString(name.String())
+	}
+	if sb.Len() == 0 {
+		return "/"
+	}
+	return sb.String()
+}
+
+// ParsePath parses a slash separated path. Leading and trailing slashes are ignored.
+func ParsePath(s string) (Path, error) {
+	s = strings.Trim(s, "/")
+	if s == "" {
+		return Path{}, nil
+	}
+	elems := strings.Split(s, "/")
+	p := make(Path, len(elems))
+	for i, elem := range elems {
+		// relative paths would need resolving against an ancestor
+		if elem == "." || elem == ".." {
+			return nil, fmt.Errorf("invalid path element %q", elem)
+		}
+		name, err := ParseName(elem)
+		if err != nil {
+			return nil, err
+		}
+		p[i] = name
+	}
+	return p, nil
+}
+
+// Lookup returns the entry at the slash separated path from the top-level.
+// The path "/" is the top-level directory, which has no id.
+func (d *DB) Lookup(ctx context.Context, path string) (DirEntry, error) {
+	p, err := ParsePath(path)
+	if err != nil {
+		return DirEntry{}, fmt.Errorf("fs: %v: %w", err, dberrors.ErrInvalid)
+	}
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", walkPath),
+		attribute.String("file.path", p.String()),
+	)
+	ctx, span := tracer.Start(ctx, "DB.Lookup", attr)
+	defer span.End()
+
+	if len(p) == 0 {
+		return DirEntry{Path: p.String(), FileInfo: FileInfo{IsDir: true}}, nil
+	}
+	file, err := lookup(ctx, d.RWC, uuid.Nil, p)
+	if err != nil {
+		return DirEntry{}, err
+	}
+	info, _, etag, err := d.Stat(ctx, file)
+	if err != nil {
+		return DirEntry{}, err
+	}
+	return DirEntry{Path: p.String(), FileInfo: info, ETag: etag}, nil
+}
+
+// MkdirAll creates the directory at p within root, along with any missing
+// parents, in a single transaction. Directories that exist are left as they are.
+func (d *DB) MkdirAll(ctx context.Context, p Path, root uuid.UUID) (file uuid.UUID, err error) {
+	const query = `select f.id, exists (select 1 from fs.blob_data where dir_entry = f.id)
+from fs.dir_entry f
+where f.root is not distinct from $1 and f.name = $2 and f.del is null`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("file.path", p.String()),
+		attribute.String("file.root", root.String()),
+	)
+	ctx, span := tracer.Start(ctx, "DB.MkdirAll", attr)
+	defer span.End()
+
+	if len(p) == 0 {
+		return uuid.Nil, fmt.Errorf("fs: empty path: %w", dberrors.ErrInvalid)
+	}
+	err = pgx.BeginTxFunc(ctx, d.RWC, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		if err := isDir(ctx, tx, root); err != nil {
+			return err
+		}
+		file = root
+		for _, name := range p {
+			var hasBlob bool
+			err := tx.QueryRow(ctx, query, ptr(file), name).Scan(&file, &hasBlob)
+			switch {
+			case err == nil:
+				if hasBlob {
+					return fmt.Errorf("fs: %s is not a directory: %w", name, dberrors.ErrInvalid)
+				}
+				continue
+			case !errors.Is(err, pgx.ErrNoRows):
+				return err
+			}
+			parent := file
+			if err := authorize(ctx, tx, parent, PermWrite); err != nil {
+				return err
+			}
+			if file, err = uuid.NewV7(); err != nil {
+				return err
+			}
+			cmd, err := tx.Exec(ctx, insertDirEntry, file, name, ptr(parent), owner(ctx))
+			if err != nil {
+				return err
+			}
+			if err := mustRowsAffected(cmd); err != nil {
+				return fmt.Errorf("fs: no entry for parent: %w", dberrors.ErrNotExist)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return uuid.Nil, Error(err)
+	}
+	return file, nil
+}
+
+// walkPath follows the names of a path from a directory, one level at a time.
+const walkPath = `with recursive walk (id, depth) as (
+	select id, 1 from fs.dir_entry
+	where root is not distinct from $1 and name = ($2::string[])[1] and del is null
+	union all
+	select f.id, w.depth + 1 from fs.dir_entry f join walk w on f.root = w.id
+	where w.depth < array_length($2::string[], 1) and f.name = ($2::string[])[w.depth + 1] and f.del is null
+)
+select id from walk where depth = array_length($2::string[], 1)`
+
+// lookup returns the id of the entry at p within root.
+func lookup(ctx context.Context, q querier, root uuid.UUID, p Path) (file uuid.UUID, err error) {
+	names := make([]string, len(p))
+	for i, name := range p {
+		names[i] = name.String()
+	}
+	if err := q.QueryRow(ctx, walkPath, ptr(root), names).Scan(&file); err != nil {
+		return uuid.Nil, Error(err)
+	}
+	return file, nil
+}
+
+// pathOf returns the path of file from the top-level.
+func pathOf(ctx context.Context, q querier, file uuid.UUID) (Path, error) {
+	if file == uuid.Nil {
+		return Path{}, nil
+	}
+	const query = `with recursive ancestor (id, root, name, depth) as (
+	select id, root, name, 0 from fs.dir_entry where id = $1
+	union all
+	select f.id, f.root, f.name, a.depth + 1 from fs.dir_entry f join ancestor a on f.id = a.root
+)
+select name from ancestor order by depth desc`
+
+	rows, err := q.Query(ctx, query, file)
+	if err != nil {
+		return nil, Error(err)
+	}
+	p, err := pgx.CollectRows(rows, pgx.RowTo[Name])
+	if err != nil {
+		return nil, Error(err)
+	}
+	if len(p) == 0 {
+		return nil, fmt.Errorf("fs: no entry for file: %w", dberrors.ErrNotExist)
+	}
+	return p, nil
+}
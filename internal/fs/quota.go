@@ -0,0 +1,289 @@
+package fs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	dberrors "go.adoublef/eyeoh/internal/database/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Quota limits the space used by a top-level directory. Bytes are counted against
+// the size of every version that is kept, as in [Usage.Total]. A nil limit is unlimited.
+type Quota struct {
+	// MaxBytes and MaxFiles are hard limits, writes that would exceed them fail
+	// with [dberrors.ErrQuota].
+	MaxBytes *int64 `json:"maxBytes,omitempty"`
+	MaxFiles *int64 `json:"maxFiles,omitempty"`
+	// SoftBytes and SoftFiles are only reported once they are exceeded.
+	SoftBytes *int64 `json:"softBytes,omitempty"`
+	SoftFiles *int64 `json:"softFiles,omitempty"`
+}
+
+// QuotaInfo is the quota of a top-level directory with its current usage.
+type QuotaInfo struct {
+	ID uuid.UUID `json:"fileId"`
+	Quota
+	Usage Usage `json:"usage"`
+	// Soft is set once the usage is over a soft limit.
+	Soft bool `json:"soft"`
+}
+
+func (q Quota) valid() bool {
+	for _, n := range []*int64{q.MaxBytes, q.MaxFiles, q.SoftBytes, q.SoftFiles} {
+		if n != nil && *n < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// SetQuota sets the quota of the top-level directory dir. Usage that is already
+// over a new limit is kept, but nothing more can be written until it is below.
+func (d *DB) SetQuota(ctx context.Context, dir uuid.UUID, q Quota) error {
+	const query = `insert into fs.quota (id, max_sz, max_files, soft_sz, soft_files)
+values ($1, $2, $3, $4, $5)
+on conflict (id) do update set
+	max_sz = excluded.max_sz
+	, max_files = excluded.max_files
+	, soft_sz = excluded.soft_sz
+	, soft_files = excluded.soft_files`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("file.id", dir.String()),
+	)
+	ctx, span := tracer.Start(ctx, "DB.SetQuota", attr)
+	defer span.End()
+
+	if !q.valid() {
+		return fmt.Errorf("fs: limit must not be negative: %w", dberrors.ErrInvalid)
+	}
+	err := pgx.BeginTxFunc(ctx, d.RWC, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		if err := authorize(ctx, tx, uuid.Nil, PermAdmin); err != nil {
+			return err
+		}
+		if err := isTopLevelDir(ctx, tx, dir); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, query, dir, q.MaxBytes, q.MaxFiles, q.SoftBytes, q.SoftFiles)
+		return err
+	})
+	return Error(err)
+}
+
+// RemoveQuota removes the quota of the top-level directory dir.
+func (d *DB) RemoveQuota(ctx context.Context, dir uuid.UUID) error {
+	const query = `delete from fs.quota where id = $1`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("file.id", dir.String()),
+	)
+	ctx, span := tracer.Start(ctx, "DB.RemoveQuota", attr)
+	defer span.End()
+
+	if err := authorize(ctx, d.RWC, uuid.Nil, PermAdmin); err != nil {
+		return Error(err)
+	}
+	cmd, err := d.RWC.Exec(ctx, query, dir)
+	if err != nil {
+		return Error(err)
+	}
+	if err := mustRowsAffected(cmd); err != nil {
+		return fmt.Errorf("fs: no quota for file: %w", dberrors.ErrNotExist)
+	}
+	return nil
+}
+
+const selectQuota = `select q.id
+	, q.max_sz
+	, q.max_files
+	, q.soft_sz
+	, q.soft_files
+	, coalesce(u.files, 0)
+	, coalesce(u.latest, 0)
+	, coalesce(u.total, 0)
+from fs.quota q
+left join fs.usage u on u.id = q.id
+`
+
+// Quota returns the quota of the top-level directory dir with its current usage.
+func (d *DB) Quota(ctx context.Context, dir uuid.UUID) (QuotaInfo, error) {
+	const query = selectQuota + `where q.id = $1`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("file.id", dir.String()),
+	)
+	ctx, span := tracer.Start(ctx, "DB.Quota", attr)
+	defer span.End()
+
+	// the users of a tree can see how much of it is left
+	if err := authorize(ctx, d.RWC, dir, PermRead); err != nil {
+		return QuotaInfo{}, Error(err)
+	}
+	rows, err := d.RWC.Query(ctx, query, dir)
+	if err != nil {
+		return QuotaInfo{}, Error(err)
+	}
+	qi, err := pgx.CollectExactlyOneRow(rows, scanQuota)
+	if err != nil {
+		return QuotaInfo{}, Error(err)
+	}
+	return qi, nil
+}
+
+// Quotas returns the quota of every top-level directory that has one.
+func (d *DB) Quotas(ctx context.Context) ([]QuotaInfo, error) {
+	const query = selectQuota + `order by q.id`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+	)
+	ctx, span := tracer.Start(ctx, "DB.Quotas", attr)
+	defer span.End()
+
+	if err := authorize(ctx, d.RWC, uuid.Nil, PermAdmin); err != nil {
+		return nil, Error(err)
+	}
+	rows, err := d.RWC.Query(ctx, query)
+	if err != nil {
+		return nil, Error(err)
+	}
+	quotas, err := pgx.CollectRows(rows, scanQuota)
+	if err != nil {
+		return nil, Error(err)
+	}
+	return quotas, nil
+}
+
+func scanQuota(row pgx.CollectableRow) (QuotaInfo, error) {
+	var qi QuotaInfo
+	err := row.Scan(
+		&qi.ID,
+		&qi.MaxBytes,
+		&qi.MaxFiles,
+		&qi.SoftBytes,
+		&qi.SoftFiles,
+		&qi.Usage.Files,
+		&qi.Usage.Latest,
+		&qi.Usage.Total,
+	)
+	qi.Soft = over(qi.Usage.Total, qi.SoftBytes) || over(qi.Usage.Files, qi.SoftFiles)
+	return qi, err
+}
+
+func over(n int64, limit *int64) bool { return limit != nil && n > *limit }
+
+// Remaining returns the number of bytes that can be written to the tree that
+// contains file once files more files are added. If that would exceed the
+// quota, [dberrors.ErrQuota] is returned.
+func (d *DB) Remaining(ctx context.Context, file uuid.UUID, files int64) (int64, error) {
+	const query = `select q.max_sz - coalesce(u.total, 0), q.max_files - coalesce(u.files, 0)
+from fs.quota q
+left join fs.usage u on u.id = q.id
+where q.id = $1`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("file.id", file.String()),
+	)
+	ctx, span := tracer.Start(ctx, "DB.Remaining", attr)
+	defer span.End()
+
+	tree, err := topLevel(ctx, d.RWC, file)
+	if err != nil {
+		return 0, Error(err)
+	}
+	var sz, n *int64
+	err = d.RWC.QueryRow(ctx, query, tree).Scan(&sz, &n)
+	switch {
+	case err == pgx.ErrNoRows:
+		return math.MaxInt64, nil
+	case err != nil:
+		return 0, Error(err)
+	}
+	if (n != nil && *n < files) || (sz != nil && *sz < 0) {
+		return 0, fmt.Errorf("fs: tree is full: %w", dberrors.ErrQuota)
+	}
+	if sz == nil {
+		return math.MaxInt64, nil
+	}
+	return *sz, nil
+}
+
+// checkQuota returns [dberrors.ErrQuota] if the usage of the tree that contains
+// file is over a hard limit. It is called once the usage has grown.
+func checkQuota(ctx context.Context, q querier, file uuid.UUID) error {
+	const query = `select exists (
+	select 1 from fs.quota q join fs.usage u on u.id = q.id
+	where q.id = $1 and (u.total > q.max_sz or u.files > q.max_files))`
+
+	tree, err := topLevel(ctx, q, file)
+	if err != nil || tree == uuid.Nil {
+		return err
+	}
+	var full bool
+	if err := q.QueryRow(ctx, query, tree).Scan(&full); err != nil {
+		return err
+	}
+	if full {
+		return fmt.Errorf("fs: tree is full: %w", dberrors.ErrQuota)
+	}
+	return nil
+}
+
+// isTopLevelDir returns [dberrors.ErrInvalid] if file is not a top-level directory.
+func isTopLevelDir(ctx context.Context, q querier, file uuid.UUID) error {
+	if file == uuid.Nil {
+		return fmt.Errorf("fs: not a top-level directory: %w", dberrors.ErrInvalid)
+	}
+	if err := isDir(ctx, q, file); err != nil {
+		return err
+	}
+	var top bool
+	const query = `select root is null from fs.dir_entry where id = $1`
+	if err := q.QueryRow(ctx, query, file).Scan(&top); err != nil {
+		return err
+	}
+	if !top {
+		return fmt.Errorf("fs: not a top-level directory: %w", dberrors.ErrInvalid)
+	}
+	return nil
+}
+
+// quotaReader reads from r until more than n bytes are read, when it fails with
+// [dberrors.ErrQuota]. The error is kept, as the caller may wrap it.
+type quotaReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (qr *quotaReader) Read(p []byte) (int, error) {
+	if qr.err != nil {
+		return 0, qr.err
+	}
+	n, err := qr.r.Read(p)
+	if qr.n -= int64(n); qr.n < 0 {
+		qr.err = fmt.Errorf("fs: upload is over quota: %w", dberrors.ErrQuota)
+		return n, qr.err
+	}
+	return n, err
+}
+
+// limit wraps r to fail once the upload to the tree that contains file would
+// exceed its quota, when files more files are added.
+func (fsys *FS) limit(ctx context.Context, file uuid.UUID, files int64, r io.Reader) (*quotaReader, error) {
+	n, err := fsys.Remaining(ctx, file, files)
+	if err != nil {
+		return nil, err
+	}
+	return &quotaReader{r: r, n: n}, nil
+}
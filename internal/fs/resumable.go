@@ -0,0 +1,284 @@
+package fs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding"
+	"fmt"
+	"hash"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+	dberrors "go.adoublef/eyeoh/internal/database/errors"
+	"go.adoublef/eyeoh/internal/runtime/debug"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// lockTTL is how long an append holds the lock of an upload before another can take it.
+const lockTTL = 10 * time.Minute
+
+type PartUploader interface {
+	BeginParts(ctx context.Context, id uuid.UUID) (upload string, err error)
+	AppendParts(ctx context.Context, id uuid.UUID, upload string, off int64, r io.Reader) (n int64, err error)
+	CompleteParts(ctx context.Context, id uuid.UUID, upload string, sz int64) error
+	AbortParts(ctx context.Context, id uuid.UUID, upload string) error
+}
+
+// Resumable is the state of an upload created with [FS.CreateResumable].
+type Resumable struct {
+	ID uuid.UUID
+	// Upload is the id of the multipart upload.
+	Upload string
+	// Size is the total size of the content and Offset is the number of bytes written.
+	Size, Offset int64
+	// state is the running hash of the bytes written.
+	state []byte
+}
+
+// BeginResumable records that the upload id is written in parts by the multipart
+// upload, with sz bytes in total.
+func (d *DB) BeginResumable(ctx context.Context, id uuid.UUID, upload string, sz int64, state []byte) error {
+	const query = `update up.inflight set mp_id = $2, len = $3, off = 0, sha = $4 where id = $1`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("upload.id", id.String()),
+		attribute.Int("file.sz", int(sz)),
+	)
+	ctx, span := tracer.Start(ctx, "DB.BeginResumable", attr)
+	defer span.End()
+
+	cmd, err := d.RWC.Exec(ctx, query, id, upload, sz, state)
+	if err != nil {
+		return Error(err)
+	}
+	return mustRowsAffected(cmd)
+}
+
+// Resumable returns the state of the upload id. Only the user that created the
+// upload can access it.
+func (d *DB) Resumable(ctx context.Context, id uuid.UUID) (Resumable, error) {
+	const query = `select mp_id, len, off, sha, owner
+from up.inflight
+where id = $1 and mp_id is not null and sz is null`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("upload.id", id.String()),
+	)
+	ctx, span := tracer.Start(ctx, "DB.Resumable", attr)
+	defer span.End()
+
+	st := Resumable{ID: id}
+	var owner *uuid.UUID
+	if err := d.RWC.QueryRow(ctx, query, id).Scan(&st.Upload, &st.Size, &st.Offset, &st.state, &owner); err != nil {
+		return Resumable{}, Error(err)
+	}
+	if user, ok := UserFromContext(ctx); ok && user != value(owner) {
+		return Resumable{}, fmt.Errorf("fs: upload belongs to another user: %w", dberrors.ErrPermission)
+	}
+	return st, nil
+}
+
+// Lock takes the lock of the upload id for an append from off. It fails if off is
+// not the offset of the upload or another append holds the lock.
+func (d *DB) Lock(ctx context.Context, id uuid.UUID, off int64) error {
+	const query = `update up.inflight set lock_at = now(), mod_at = now()
+where id = $1 and off = $2 and sz is null and (lock_at is null or lock_at < $3)`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("upload.id", id.String()),
+		attribute.Int("upload.off", int(off)),
+	)
+	ctx, span := tracer.Start(ctx, "DB.Lock", attr)
+	defer span.End()
+
+	cmd, err := d.RWC.Exec(ctx, query, id, off, time.Now().Add(-lockTTL))
+	if err != nil {
+		return Error(err)
+	}
+	if cmd.RowsAffected() > 0 {
+		return nil
+	}
+	// nothing was locked, so find out why
+	var cur int64
+	const offset = `select off from up.inflight where id = $1 and sz is null`
+	if err := d.RWC.QueryRow(ctx, offset, id).Scan(&cur); err != nil {
+		return Error(err)
+	}
+	if cur != off {
+		return fmt.Errorf("fs: upload is at offset %d: %w", cur, dberrors.ErrStale)
+	}
+	return fmt.Errorf("fs: upload is locked: %w", dberrors.ErrExist)
+}
+
+// Advance moves the offset of the upload id from off to next, records the state
+// of the running hash and releases the lock.
+func (d *DB) Advance(ctx context.Context, id uuid.UUID, off, next int64, state []byte) error {
+	const query = `update up.inflight set off = $3, sha = $4, lock_at = null, mod_at = now()
+where id = $1 and off = $2 and sz is null`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("upload.id", id.String()),
+		attribute.Int("upload.off", int(off)),
+		attribute.Int("upload.next", int(next)),
+	)
+	ctx, span := tracer.Start(ctx, "DB.Advance", attr)
+	defer span.End()
+
+	cmd, err := d.RWC.Exec(ctx, query, id, off, next, state)
+	if err != nil {
+		return Error(err)
+	}
+	if err := mustRowsAffected(cmd); err != nil {
+		return fmt.Errorf("fs: upload was modified: %w", dberrors.ErrStale)
+	}
+	return nil
+}
+
+// Unlock releases the lock of the upload id without moving its offset.
+func (d *DB) Unlock(ctx context.Context, id uuid.UUID) error {
+	const query = `update up.inflight set lock_at = null where id = $1`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("upload.id", id.String()),
+	)
+	ctx, span := tracer.Start(ctx, "DB.Unlock", attr)
+	defer span.End()
+
+	_, err := d.RWC.Exec(ctx, query, id)
+	return Error(err)
+}
+
+// CreateResumable records an upload of a new file named name within root with sz
+// bytes, that is written with [FS.Append]. An empty file is created at once, in
+// which case the id of the file is returned too.
+func (fsys *FS) CreateResumable(ctx context.Context, name Name, root uuid.UUID, sz int64) (id, file uuid.UUID, err error) {
+	if sz < 0 {
+		return uuid.Nil, uuid.Nil, fmt.Errorf("fs: size must not be negative: %w", dberrors.ErrInvalid)
+	}
+	// the size is known, so an upload that would be over quota is never started
+	if n, err := fsys.Remaining(ctx, root, 1); err != nil {
+		return uuid.Nil, uuid.Nil, err
+	} else if sz > n {
+		return uuid.Nil, uuid.Nil, fmt.Errorf("fs: upload is over quota: %w", dberrors.ErrQuota)
+	}
+	id, err = fsys.BeginCreate(ctx, name, root)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+	upload, err := fsys.BeginParts(ctx, id)
+	if err != nil {
+		aerr := fsys.Abort(context.WithoutCancel(ctx), id)
+		debug.Printf(`%v := fsys.Abort(ctx, %q)`, aerr, id)
+		return uuid.Nil, uuid.Nil, err
+	}
+	state, err := marshalHash(sha256.New())
+	if err == nil {
+		err = fsys.BeginResumable(ctx, id, upload, sz, state)
+	}
+	if err != nil {
+		aerr := fsys.abortParts(context.WithoutCancel(ctx), id, upload)
+		debug.Printf(`%v := fsys.abortParts(ctx, %q, _)`, aerr, id)
+		return uuid.Nil, uuid.Nil, err
+	}
+	if sz > 0 {
+		return id, uuid.Nil, nil
+	}
+	_, file, err = fsys.Append(ctx, id, 0, eof{}, nil)
+	return id, file, err
+}
+
+// Append writes the content of r to the upload id from off, which must be its offset.
+// If verify is set, it is called once r is read and the bytes are only kept if it
+// returns nil. Otherwise, if reading r fails, the bytes read before are kept. It
+// returns the new offset and, once every byte is written, the id of the file.
+func (fsys *FS) Append(ctx context.Context, id uuid.UUID, off int64, r io.Reader, verify func() error) (next int64, file uuid.UUID, err error) {
+	st, err := fsys.Resumable(ctx, id)
+	if err != nil {
+		return 0, uuid.Nil, err
+	}
+	if off != st.Offset {
+		return st.Offset, uuid.Nil, fmt.Errorf("fs: upload is at offset %d: %w", st.Offset, dberrors.ErrStale)
+	}
+	if err := fsys.Lock(ctx, id, off); err != nil {
+		return st.Offset, uuid.Nil, err
+	}
+	unlock := func(err error) (int64, uuid.UUID, error) {
+		uerr := fsys.Unlock(context.WithoutCancel(ctx), id)
+		debug.Printf(`%v := fsys.Unlock(ctx, %q)`, uerr, id)
+		return off, uuid.Nil, err
+	}
+
+	h := sha256.New()
+	if err := h.(encoding.BinaryUnmarshaler).UnmarshalBinary(st.state); err != nil {
+		return unlock(err)
+	}
+	// bytes past the size of the upload are ignored
+	tr := io.TeeReader(io.LimitReader(r, st.Size-off), h)
+	n, rerr := fsys.AppendParts(ctx, id, st.Upload, off, tr)
+	if rerr != nil && (verify != nil || n == 0) {
+		return unlock(rerr)
+	}
+	if verify != nil {
+		if err := verify(); err != nil {
+			return unlock(err)
+		}
+	}
+	state, err := marshalHash(h)
+	if err != nil {
+		return unlock(err)
+	}
+	next = off + n
+	if err := fsys.Advance(ctx, id, off, next, state); err != nil {
+		return unlock(err)
+	}
+	if next < st.Size {
+		return next, uuid.Nil, rerr
+	}
+
+	if err := fsys.CompleteParts(ctx, id, st.Upload, st.Size); err != nil {
+		return next, uuid.Nil, err
+	}
+	if err := fsys.Written(ctx, id, st.Size, h.Sum(nil)); err != nil {
+		return next, uuid.Nil, err
+	}
+	file, err = fsys.commit(ctx, id)
+	if err != nil {
+		aerr := fsys.abort(context.WithoutCancel(ctx), id)
+		debug.Printf(`%v := fsys.abort(ctx, %q)`, aerr, id)
+		return next, uuid.Nil, err
+	}
+	return next, file, nil
+}
+
+// Terminate stops the upload id and deletes anything it wrote.
+func (fsys *FS) Terminate(ctx context.Context, id uuid.UUID) error {
+	st, err := fsys.Resumable(ctx, id)
+	if err != nil {
+		return err
+	}
+	return fsys.abortParts(ctx, id, st.Upload)
+}
+
+// abortParts stops the multipart upload before removing the record of the upload.
+func (fsys *FS) abortParts(ctx context.Context, id uuid.UUID, upload string) error {
+	if err := fsys.AbortParts(ctx, id, upload); err != nil {
+		return err
+	}
+	return fsys.abort(ctx, id)
+}
+
+func marshalHash(h hash.Hash) ([]byte, error) {
+	return h.(encoding.BinaryMarshaler).MarshalBinary()
+}
+
+// eof is an empty [io.Reader].
+type eof struct{}
+
+func (eof) Read([]byte) (int, error) { return 0, io.EOF }
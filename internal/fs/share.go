@@ -0,0 +1,270 @@
+package fs
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	dberrors "go.adoublef/eyeoh/internal/database/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Share is a link that gives anyone who has it read access to an entry and,
+// for a directory, the entries below it.
+type Share struct {
+	ID        uuid.UUID `json:"shareId"`
+	File      uuid.UUID `json:"fileId"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	// MaxDownloads is the number of times the link can be downloaded, if limited.
+	MaxDownloads *int64 `json:"maxDownloads,omitempty"`
+	Downloads    int64  `json:"downloads"`
+	// Password is set if the link needs a password.
+	Password bool `json:"password"`
+
+	owner *uuid.UUID
+	path  Path
+}
+
+// WithShare returns a copy of ctx that acts with the access of the user that
+// created the share link s, only within the shared entry. s must be returned by
+// [FS.OpenShare].
+func WithShare(ctx context.Context, s Share) context.Context {
+	if s.owner != nil {
+		ctx = WithUser(ctx, *s.owner)
+	}
+	return WithScope(ctx, s.path)
+}
+
+// ShareOptions configure a [Share].
+type ShareOptions struct {
+	// TTL is how long the link can be used for, it must be positive.
+	TTL time.Duration
+	// Password is needed to use the link, if set.
+	Password string
+	// MaxDownloads limits the downloads of the link, if positive. A link with
+	// a single download can only be used once.
+	MaxDownloads int64
+}
+
+// CreateShare creates a share link for file and returns it with its token.
+// Sharing gives access to others, so it needs [PermAdmin] on file.
+func (fsys *FS) CreateShare(ctx context.Context, file uuid.UUID, opts ShareOptions) (Share, string, error) {
+	const query = `insert into fs.share (id, dir_entry, owner, pass_hash, max_downloads, expires_at)
+select $1, id, $3, $4, $5, $6 from fs.dir_entry where id = $2 and del is null
+returning created_at`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("file.id", file.String()),
+	)
+	ctx, span := tracer.Start(ctx, "FS.CreateShare", attr)
+	defer span.End()
+
+	if len(fsys.ShareKey) == 0 {
+		return Share{}, "", fmt.Errorf("fs: share links are not configured: %w", dberrors.ErrInvalid)
+	}
+	if opts.TTL <= 0 || opts.MaxDownloads < 0 {
+		return Share{}, "", fmt.Errorf("fs: ttl must be positive and max downloads not negative: %w", dberrors.ErrInvalid)
+	}
+	if err := authorize(ctx, fsys.RWC, file, PermAdmin); err != nil {
+		return Share{}, "", Error(err)
+	}
+	s := Share{
+		File:         file,
+		ExpiresAt:    time.Now().Add(opts.TTL).UTC().Truncate(time.Second),
+		MaxDownloads: ptr(opts.MaxDownloads),
+		Password:     opts.Password != "",
+	}
+	var hash []byte
+	if s.Password {
+		var err error
+		if hash, err = bcrypt.GenerateFromPassword([]byte(opts.Password), bcrypt.DefaultCost); err != nil {
+			return Share{}, "", fmt.Errorf("fs: %v: %w", err, dberrors.ErrInvalid)
+		}
+	}
+	var err error
+	if s.ID, err = uuid.NewV7(); err != nil {
+		return Share{}, "", Error(err)
+	}
+	err = fsys.RWC.QueryRow(ctx, query, s.ID, file, owner(ctx), hash, s.MaxDownloads, s.ExpiresAt).Scan(&s.CreatedAt)
+	if err != nil {
+		return Share{}, "", Error(err)
+	}
+	return s, fsys.signLink("share", s.ID, s.ExpiresAt), nil
+}
+
+// Shares returns the share links of file that can still be used.
+func (fsys *FS) Shares(ctx context.Context, file uuid.UUID) ([]Share, error) {
+	const query = `select id, dir_entry, created_at, expires_at, max_downloads, downloads, pass_hash is not null
+from fs.share
+where dir_entry = $1 and revoked_at is null and expires_at > now()
+and (max_downloads is null or downloads < max_downloads)
+order by id`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("file.id", file.String()),
+	)
+	ctx, span := tracer.Start(ctx, "FS.Shares", attr)
+	defer span.End()
+
+	if err := authorize(ctx, fsys.RWC, file, PermAdmin); err != nil {
+		return nil, Error(err)
+	}
+	rows, err := fsys.RWC.Query(ctx, query, file)
+	if err != nil {
+		return nil, Error(err)
+	}
+	shares, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (Share, error) {
+		var s Share
+		err := row.Scan(&s.ID, &s.File, &s.CreatedAt, &s.ExpiresAt, &s.MaxDownloads, &s.Downloads, &s.Password)
+		return s, err
+	})
+	if err != nil {
+		return nil, Error(err)
+	}
+	return shares, nil
+}
+
+// RevokeShare revokes the share link id.
+func (fsys *FS) RevokeShare(ctx context.Context, id uuid.UUID) error {
+	const query = `update fs.share set revoked_at = now() where id = $1 and revoked_at is null`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("share.id", id.String()),
+	)
+	ctx, span := tracer.Start(ctx, "FS.RevokeShare", attr)
+	defer span.End()
+
+	err := pgx.BeginTxFunc(ctx, fsys.RWC, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		var file uuid.UUID
+		if err := tx.QueryRow(ctx, `select dir_entry from fs.share where id = $1`, id).Scan(&file); err == pgx.ErrNoRows {
+			return fmt.Errorf("fs: no share: %w", dberrors.ErrNotExist)
+		} else if err != nil {
+			return err
+		}
+		if err := authorize(ctx, tx, file, PermAdmin); err != nil {
+			return err
+		}
+		cmd, err := tx.Exec(ctx, query, id)
+		if err != nil {
+			return err
+		}
+		if err := mustRowsAffected(cmd); err != nil {
+			return fmt.Errorf("fs: share is revoked: %w", dberrors.ErrNotExist)
+		}
+		return nil
+	})
+	return Error(err)
+}
+
+// OpenShare returns the share link of token and the path of the entry it shares.
+// A link that is not valid, or can no longer be used, does not exist. If the link
+// needs a password and password does not match, it fails with [dberrors.ErrPermission].
+// Opening a link does not count as a download, see [FS.CountShare]. The link is
+// used with the access of the user that created it, see [WithShare].
+func (fsys *FS) OpenShare(ctx context.Context, token, password string) (Share, Path, error) {
+	const query = `select s.dir_entry, s.owner, s.created_at, s.expires_at, s.max_downloads, s.downloads, s.pass_hash
+from fs.share s
+join fs.dir_entry f on f.id = s.dir_entry
+where s.id = $1 and s.revoked_at is null and s.expires_at > now() and f.del is null
+and (s.max_downloads is null or s.downloads < s.max_downloads)`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+	)
+	ctx, span := tracer.Start(ctx, "FS.OpenShare", attr)
+	defer span.End()
+
+	notExist := fmt.Errorf("fs: no share: %w", dberrors.ErrNotExist)
+	id, ok := fsys.verifyLink("share", token)
+	if !ok {
+		return Share{}, nil, notExist
+	}
+	span.SetAttributes(attribute.String("share.id", id.String()))
+
+	s := Share{ID: id}
+	var hash []byte
+	err := fsys.RWC.QueryRow(ctx, query, id).Scan(&s.File, &s.owner, &s.CreatedAt, &s.ExpiresAt, &s.MaxDownloads, &s.Downloads, &hash)
+	if err == pgx.ErrNoRows {
+		return Share{}, nil, notExist
+	} else if err != nil {
+		return Share{}, nil, Error(err)
+	}
+	if s.Password = hash != nil; s.Password {
+		if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil {
+			return Share{}, nil, fmt.Errorf("fs: wrong share password: %w", dberrors.ErrPermission)
+		}
+	}
+	if s.path, err = pathOf(ctx, fsys.RWC, s.File); err != nil {
+		return Share{}, nil, err
+	}
+	return s, s.path, nil
+}
+
+// CountShare counts a download of the share link id. It fails with
+// [dberrors.ErrNotExist] if the link has no downloads left.
+func (fsys *FS) CountShare(ctx context.Context, id uuid.UUID) error {
+	const query = `update fs.share set downloads = downloads + 1
+where id = $1 and revoked_at is null and expires_at > now()
+and (max_downloads is null or downloads < max_downloads)`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("share.id", id.String()),
+	)
+	ctx, span := tracer.Start(ctx, "FS.CountShare", attr)
+	defer span.End()
+
+	cmd, err := fsys.RWC.Exec(ctx, query, id)
+	if err != nil {
+		return Error(err)
+	}
+	if err := mustRowsAffected(cmd); err != nil {
+		return fmt.Errorf("fs: share has no downloads left: %w", dberrors.ErrNotExist)
+	}
+	return nil
+}
+
+// signLink returns the token of a link, which is its id and expiry signed with
+// the share key. The kind of link is signed too, so that the token of one kind
+// cannot be used as another.
+func (fsys *FS) signLink(kind string, id uuid.UUID, exp time.Time) string {
+	b := make([]byte, 0, len(id)+8+sha256.Size)
+	b = append(b, id[:]...)
+	b = binary.BigEndian.AppendUint64(b, uint64(exp.Unix()))
+	h := hmac.New(sha256.New, fsys.ShareKey)
+	h.Write([]byte(kind))
+	h.Write(b)
+	return base64.RawURLEncoding.EncodeToString(h.Sum(b))
+}
+
+// verifyLink returns the id of the link token of kind if it is signed with the
+// share key and has not expired.
+func (fsys *FS) verifyLink(kind, token string) (uuid.UUID, bool) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(b) != 16+8+sha256.Size || len(fsys.ShareKey) == 0 {
+		return uuid.Nil, false
+	}
+	msg, sig := b[:16+8], b[16+8:]
+	h := hmac.New(sha256.New, fsys.ShareKey)
+	h.Write([]byte(kind))
+	h.Write(msg)
+	if !hmac.Equal(h.Sum(nil), sig) {
+		return uuid.Nil, false
+	}
+	if exp := time.Unix(int64(binary.BigEndian.Uint64(msg[16:])), 0); !time.Now().Before(exp) {
+		return uuid.Nil, false
+	}
+	return uuid.UUID(msg[:16]), true
+}
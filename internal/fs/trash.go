@@ -0,0 +1,350 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	dberrors "go.adoublef/eyeoh/internal/database/errors"
+	"go.adoublef/eyeoh/internal/runtime/debug"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RmEntry is an entry to remove with [DB.Rm].
+type RmEntry struct {
+	ID uuid.UUID
+	V  uint64
+}
+
+// TrashEntry is an entry that was removed with [DB.Rm].
+type TrashEntry struct {
+	FileInfo
+	// Root is the directory the entry was removed from.
+	Root uuid.UUID `json:"parentId"`
+	// Tree is the top-level directory the entry was removed from.
+	Tree    uuid.UUID `json:"treeId"`
+	DelTime time.Time `json:"deletedAt"`
+}
+
+// Rm moves each entry, recursively for directories, to the trash in a single transaction.
+func (d *DB) Rm(ctx context.Context, entries ...RmEntry) error {
+	// the entry is renamed to its id so the name can be reused
+	const query = `update fs.dir_entry
+set name = $2, mod_at = now(), v = v + 1
+where id = $1 and v = $3 and del is null`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.Int("file.count", len(entries)),
+	)
+	ctx, span := tracer.Start(ctx, "DB.Rm", attr)
+	defer span.End()
+
+	if len(entries) == 0 {
+		return fmt.Errorf("fs: no entries to remove: %w", dberrors.ErrInvalid)
+	}
+	err := pgx.BeginTxFunc(ctx, d.RWC, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		for _, e := range entries {
+			if err := authorize(ctx, tx, e.ID, PermWrite); err != nil {
+				return err
+			}
+			var root *uuid.UUID
+			var name Name
+			const entry = `select root, name from fs.dir_entry where id = $1 and del is null`
+			if err := tx.QueryRow(ctx, entry, e.ID).Scan(&root, &name); err != nil {
+				return err
+			}
+			// the files in the trash no longer count towards the directory
+			u, err := entryUsage(ctx, tx, e.ID)
+			if err != nil {
+				return err
+			}
+			if err := account(ctx, tx, value(root), u.neg()); err != nil {
+				return err
+			}
+			cmd, err := tx.Exec(ctx, query, e.ID, e.ID.String(), e.V)
+			if err != nil {
+				return err
+			}
+			if err := mustRowsAffected(cmd); err != nil {
+				return err
+			}
+			// the tree of a top-level entry is the top-level directory
+			tree, err := topLevel(ctx, tx, value(root))
+			if err != nil {
+				return err
+			}
+			const trash = `insert into fs.trash (id, root, name, tree) values ($1, $2, $3, $4)`
+			if _, err := tx.Exec(ctx, trash, e.ID, root, name, ptr(tree)); err != nil {
+				return err
+			}
+			// entries removed earlier keep their own marker
+			const mark = `with recursive tree (id) as (
+	select id from fs.dir_entry where id = $1
+	union all
+	select f.id from fs.dir_entry f join tree t on f.root = t.id
+	where f.del is null
+)
+update fs.dir_entry set del = $1 where id in (select id from tree)`
+			if _, err := tx.Exec(ctx, mark, e.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return Error(err)
+}
+
+// Restore returns an entry from the trash to its original directory. If the name has
+// since been taken, c decides if it is renamed or fails. The restored name is returned.
+func (d *DB) Restore(ctx context.Context, file uuid.UUID, c Conflict) (Name, error) {
+	const query = `select root, name from fs.trash where id = $1`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("file.id", file.String()),
+		attribute.String("file.conflict", c.String()),
+	)
+	ctx, span := tracer.Start(ctx, "DB.Restore", attr)
+	defer span.End()
+
+	if c == ConflictReplace {
+		return "", fmt.Errorf("fs: cannot restore by replacing an entry: %w", dberrors.ErrInvalid)
+	}
+	var name Name
+	err := pgx.BeginTxFunc(ctx, d.RWC, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		var root *uuid.UUID
+		if err := tx.QueryRow(ctx, query, file).Scan(&root, &name); err != nil {
+			return err
+		}
+		// the entry keeps its parent while in the trash, so its access is unchanged
+		if err := authorize(ctx, tx, file, PermWrite); err != nil {
+			return err
+		}
+		// the original directory may have been removed too
+		if err := isDir(ctx, tx, value(root)); errors.Is(err, dberrors.ErrNotExist) {
+			return fmt.Errorf("fs: no entry for parent: %w", dberrors.ErrNotExist)
+		} else if err != nil {
+			return err
+		}
+		var taken bool
+		const exists = `select exists (
+	select 1 from fs.dir_entry where root is not distinct from $1 and name = $2)`
+		if err := tx.QueryRow(ctx, exists, root, name).Scan(&taken); err != nil {
+			return err
+		}
+		if taken {
+			if c != ConflictRename {
+				return fmt.Errorf("file name taken: %w", dberrors.ErrExist)
+			}
+			var err error
+			if name, err = freeName(ctx, tx, name, value(root)); err != nil {
+				return err
+			}
+		}
+		const restore = `update fs.dir_entry set del = null where del = $1`
+		if _, err := tx.Exec(ctx, restore, file); err != nil {
+			return err
+		}
+		const rename = `update fs.dir_entry set name = $2, mod_at = now(), v = v + 1 where id = $1`
+		if _, err := tx.Exec(ctx, rename, file, name); err != nil {
+			return err
+		}
+		u, err := entryUsage(ctx, tx, file)
+		if err != nil {
+			return err
+		}
+		if err := account(ctx, tx, value(root), u); err != nil {
+			return err
+		}
+		if err := checkQuota(ctx, tx, file); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `delete from fs.trash where id = $1`, file)
+		return err
+	})
+	if err != nil {
+		return "", Error(err)
+	}
+	return name, nil
+}
+
+// Trash returns up to limit entries removed from the top-level directory tree,
+// most recent first. If tree is [uuid.Nil] the entries of every tree are returned.
+func (d *DB) Trash(ctx context.Context, tree uuid.UUID, limit int) ([]TrashEntry, error) {
+	const query = `select t.id
+	, t.root
+	, t.name
+	, t.tree
+	, t.del_at
+	, f.mod_at
+	, b.ref
+	, b.sz
+from fs.trash t
+join fs.dir_entry f on f.id = t.id
+left join lateral (
+	select coalesce(ref, id) as ref, sz
+	from fs.blob_data
+	where dir_entry = t.id
+	order by v desc
+	limit 1) b on true
+where ($1::uuid is null or t.tree = $1) and ($3::uuid is null or f.owner = $3)
+order by t.del_at desc, t.id
+limit $2
+`
+	if limit <= 0 {
+		limit = DefaultReadDirLimit
+	}
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("file.tree", tree.String()),
+	)
+	ctx, span := tracer.Start(ctx, "DB.Trash", attr)
+	defer span.End()
+
+	// an admin sees every entry, others only see their own
+	var user *uuid.UUID
+	if len(scopes(ctx)) > 0 {
+		// removed entries are no longer below the scope
+		return nil, fmt.Errorf("fs: trash is out of scope: %w", dberrors.ErrPermission)
+	}
+	if p, err := access(ctx, d.RWC, uuid.Nil); err != nil {
+		return nil, Error(err)
+	} else if p < PermAdmin {
+		user = owner(ctx)
+	}
+	rows, err := d.RWC.Query(ctx, query, ptr(tree), limit, user)
+	if err != nil {
+		return nil, Error(err)
+	}
+	defer rows.Close()
+
+	var entries []TrashEntry
+	for rows.Next() {
+		var de dirEntry
+		var bd blobData
+		var te TrashEntry
+		var root, tree *uuid.UUID
+		if err := rows.Scan(
+			&de.id,
+			&root,
+			&de.name,
+			&tree,
+			&te.DelTime,
+			&de.modAt,
+			&bd.id,
+			&bd.sz,
+		); err != nil {
+			return nil, Error(err)
+		}
+		te.FileInfo = de.info(bd)
+		te.Root, te.Tree = value(root), value(tree)
+		entries = append(entries, te)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, Error(err)
+	}
+	return entries, nil
+}
+
+// Purge permanently deletes entries that were moved to the trash before t.
+// It returns the blobs that are no longer referenced by any entry.
+func (d *DB) Purge(ctx context.Context, t time.Time) (refs []uuid.UUID, err error) {
+	// the whole subtree is deleted, including entries that were removed separately
+	const query = `with recursive tree (id) as (
+	select id from fs.trash where del_at < $1
+	union all
+	select f.id from fs.dir_entry f join tree t on f.root = t.id
+)
+select id from tree`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("trash.before", t.String()),
+	)
+	ctx, span := tracer.Start(ctx, "DB.Purge", attr)
+	defer span.End()
+
+	err = pgx.BeginTxFunc(ctx, d.RWC, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		if err := authorize(ctx, tx, uuid.Nil, PermAdmin); err != nil {
+			return err
+		}
+		rows, err := tx.Query(ctx, query, t)
+		if err != nil {
+			return err
+		}
+		files, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			refs = nil
+			return nil
+		}
+		if _, err := tx.Exec(ctx, `delete from fs.trash where id = any($1)`, files); err != nil {
+			return err
+		}
+		rows, err = tx.Query(ctx, `delete from fs.blob_data where dir_entry = any($1) returning coalesce(ref, id)`, files)
+		if err != nil {
+			return err
+		}
+		deleted, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `delete from fs.dir_entry where id = any($1)`, files); err != nil {
+			return err
+		}
+		// the usage was taken from the directories when the entries were removed
+		if _, err := tx.Exec(ctx, `delete from fs.usage where id = any($1)`, files); err != nil {
+			return err
+		}
+		refs, err = release(ctx, tx, deleted)
+		return err
+	})
+	if err != nil {
+		return nil, Error(err)
+	}
+	return refs, nil
+}
+
+// topLevel returns the top-level entry of the tree that contains file, which may be
+// file itself. If file is [uuid.Nil] it returns [uuid.Nil].
+func topLevel(ctx context.Context, q querier, file uuid.UUID) (uuid.UUID, error) {
+	if file == uuid.Nil {
+		return uuid.Nil, nil
+	}
+	const query = `with recursive ancestor (id, root) as (
+	select id, root from fs.dir_entry where id = $1
+	union all
+	select f.id, f.root from fs.dir_entry f join ancestor a on f.id = a.root
+)
+select id from ancestor where root is null`
+
+	var tree uuid.UUID
+	if err := q.QueryRow(ctx, query, file).Scan(&tree); err != nil {
+		return uuid.Nil, err
+	}
+	return tree, nil
+}
+
+// Purge permanently deletes entries that were moved to the trash before t,
+// along with any blobs that are no longer referenced. It returns the number of
+// blobs deleted.
+func (fsys *FS) Purge(ctx context.Context, t time.Time) (int, error) {
+	refs, err := fsys.DB.Purge(ctx, t)
+	if err != nil {
+		return 0, err
+	}
+	// if this fails the blobs are orphaned but no longer reachable
+	if err := fsys.Delete(ctx, refs...); err != nil {
+		return 0, err
+	}
+	debug.Printf(`%d := len(refs)`, len(refs))
+	return len(refs), nil
+}
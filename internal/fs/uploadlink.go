@@ -0,0 +1,276 @@
+package fs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	dberrors "go.adoublef/eyeoh/internal/database/errors"
+	"go.adoublef/eyeoh/internal/runtime/debug"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// UploadLink is a link that lets anyone who has it add files to a directory,
+// without reading it.
+type UploadLink struct {
+	ID        uuid.UUID `json:"uploadLinkId"`
+	File      uuid.UUID `json:"fileId"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	// MaxFiles is the number of files that can be added with the link, if limited.
+	MaxFiles *int64 `json:"maxFiles,omitempty"`
+	// MaxSize is the size in bytes of each file, if limited.
+	MaxSize *int64 `json:"maxSize,omitempty"`
+	// ContentTypes are the media types of the files, if limited. A type can be
+	// a wildcard such as "image/*".
+	ContentTypes []string `json:"contentTypes,omitempty"`
+	Uploads      int64    `json:"uploads"`
+
+	owner *uuid.UUID
+}
+
+// Allows reports whether a file of the media type contentType can be added
+// with the link. Parameters of the type are ignored.
+func (l UploadLink) Allows(contentType string) bool {
+	if len(l.ContentTypes) == 0 {
+		return true
+	}
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, ct := range l.ContentTypes {
+		if prefix, ok := strings.CutSuffix(ct, "/*"); ok {
+			if typ, _, _ := strings.Cut(mt, "/"); typ == prefix {
+				return true
+			}
+		} else if ct == mt {
+			return true
+		}
+	}
+	return false
+}
+
+// UploadLinkOptions configure an [UploadLink].
+type UploadLinkOptions struct {
+	// TTL is how long the link can be used for, it must be positive.
+	TTL time.Duration
+	// MaxFiles limits the files added with the link, if positive.
+	MaxFiles int64
+	// MaxSize limits the size in bytes of each file, if positive.
+	MaxSize int64
+	// ContentTypes limit the media types of the files, if set.
+	ContentTypes []string
+}
+
+// CreateUploadLink creates an upload link for the directory dir and returns it
+// with its token. The link gives access to others, so it needs [PermAdmin] on dir.
+func (fsys *FS) CreateUploadLink(ctx context.Context, dir uuid.UUID, opts UploadLinkOptions) (UploadLink, string, error) {
+	const query = `insert into fs.upload_link (id, dir_entry, owner, max_files, max_sz, content_types, expires_at)
+select $1, id, $3, $4, $5, $6, $7 from fs.dir_entry where id = $2 and del is null
+returning created_at`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("file.id", dir.String()),
+	)
+	ctx, span := tracer.Start(ctx, "FS.CreateUploadLink", attr)
+	defer span.End()
+
+	if len(fsys.ShareKey) == 0 {
+		return UploadLink{}, "", fmt.Errorf("fs: upload links are not configured: %w", dberrors.ErrInvalid)
+	}
+	if opts.TTL <= 0 || opts.MaxFiles < 0 || opts.MaxSize < 0 {
+		return UploadLink{}, "", fmt.Errorf("fs: ttl must be positive and limits not negative: %w", dberrors.ErrInvalid)
+	}
+	for _, ct := range opts.ContentTypes {
+		if _, _, err := mime.ParseMediaType(ct); err != nil {
+			return UploadLink{}, "", fmt.Errorf("fs: content type %q: %w", ct, dberrors.ErrInvalid)
+		}
+	}
+	l := UploadLink{
+		File:         dir,
+		ExpiresAt:    time.Now().Add(opts.TTL).UTC().Truncate(time.Second),
+		MaxFiles:     ptr(opts.MaxFiles),
+		MaxSize:      ptr(opts.MaxSize),
+		ContentTypes: opts.ContentTypes,
+	}
+	var err error
+	if l.ID, err = uuid.NewV7(); err != nil {
+		return UploadLink{}, "", Error(err)
+	}
+	err = pgx.BeginTxFunc(ctx, fsys.RWC, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		if err := isDir(ctx, tx, dir); err != nil {
+			return err
+		}
+		if err := authorize(ctx, tx, dir, PermAdmin); err != nil {
+			return err
+		}
+		err := tx.QueryRow(ctx, query, l.ID, dir, owner(ctx), l.MaxFiles, l.MaxSize, l.ContentTypes, l.ExpiresAt).Scan(&l.CreatedAt)
+		if err == pgx.ErrNoRows {
+			return fmt.Errorf("fs: no entry: %w", dberrors.ErrNotExist)
+		}
+		return err
+	})
+	if err != nil {
+		return UploadLink{}, "", Error(err)
+	}
+	return l, fsys.signLink("upload", l.ID, l.ExpiresAt), nil
+}
+
+// UploadLinks returns the upload links of dir that can still be used.
+func (fsys *FS) UploadLinks(ctx context.Context, dir uuid.UUID) ([]UploadLink, error) {
+	const query = `select id, dir_entry, created_at, expires_at, max_files, max_sz, content_types, uploads
+from fs.upload_link
+where dir_entry = $1 and revoked_at is null and expires_at > now()
+and (max_files is null or uploads < max_files)
+order by id`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("file.id", dir.String()),
+	)
+	ctx, span := tracer.Start(ctx, "FS.UploadLinks", attr)
+	defer span.End()
+
+	if err := authorize(ctx, fsys.RWC, dir, PermAdmin); err != nil {
+		return nil, Error(err)
+	}
+	rows, err := fsys.RWC.Query(ctx, query, dir)
+	if err != nil {
+		return nil, Error(err)
+	}
+	links, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (UploadLink, error) {
+		var l UploadLink
+		err := row.Scan(&l.ID, &l.File, &l.CreatedAt, &l.ExpiresAt, &l.MaxFiles, &l.MaxSize, &l.ContentTypes, &l.Uploads)
+		return l, err
+	})
+	if err != nil {
+		return nil, Error(err)
+	}
+	return links, nil
+}
+
+// RevokeUploadLink revokes the upload link id. Files already added are kept.
+func (fsys *FS) RevokeUploadLink(ctx context.Context, id uuid.UUID) error {
+	const query = `update fs.upload_link set revoked_at = now() where id = $1 and revoked_at is null`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("upload_link.id", id.String()),
+	)
+	ctx, span := tracer.Start(ctx, "FS.RevokeUploadLink", attr)
+	defer span.End()
+
+	err := pgx.BeginTxFunc(ctx, fsys.RWC, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		var dir uuid.UUID
+		if err := tx.QueryRow(ctx, `select dir_entry from fs.upload_link where id = $1`, id).Scan(&dir); err == pgx.ErrNoRows {
+			return fmt.Errorf("fs: no upload link: %w", dberrors.ErrNotExist)
+		} else if err != nil {
+			return err
+		}
+		if err := authorize(ctx, tx, dir, PermAdmin); err != nil {
+			return err
+		}
+		cmd, err := tx.Exec(ctx, query, id)
+		if err != nil {
+			return err
+		}
+		if err := mustRowsAffected(cmd); err != nil {
+			return fmt.Errorf("fs: upload link is revoked: %w", dberrors.ErrNotExist)
+		}
+		return nil
+	})
+	return Error(err)
+}
+
+// OpenUploadLink returns the upload link of token. A link that is not valid, or
+// can no longer be used, does not exist.
+func (fsys *FS) OpenUploadLink(ctx context.Context, token string) (UploadLink, error) {
+	const query = `select l.dir_entry, l.owner, l.created_at, l.expires_at, l.max_files, l.max_sz, l.content_types, l.uploads
+from fs.upload_link l
+join fs.dir_entry f on f.id = l.dir_entry
+where l.id = $1 and l.revoked_at is null and l.expires_at > now() and f.del is null
+and (l.max_files is null or l.uploads < l.max_files)`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+	)
+	ctx, span := tracer.Start(ctx, "FS.OpenUploadLink", attr)
+	defer span.End()
+
+	notExist := fmt.Errorf("fs: no upload link: %w", dberrors.ErrNotExist)
+	id, ok := fsys.verifyLink("upload", token)
+	if !ok {
+		return UploadLink{}, notExist
+	}
+	span.SetAttributes(attribute.String("upload_link.id", id.String()))
+
+	l := UploadLink{ID: id}
+	err := fsys.RWC.QueryRow(ctx, query, id).Scan(&l.File, &l.owner, &l.CreatedAt, &l.ExpiresAt, &l.MaxFiles, &l.MaxSize, &l.ContentTypes, &l.Uploads)
+	if err == pgx.ErrNoRows {
+		return UploadLink{}, notExist
+	} else if err != nil {
+		return UploadLink{}, Error(err)
+	}
+	return l, nil
+}
+
+// Drop adds a file named name, with the content of r, to the directory of the
+// upload link l. The file is added as the user that created the link and is
+// attributed to the link. If name is taken, the file is given a free suffixed
+// name, as with [ConflictRename]. It fails with [dberrors.ErrNotExist] if the
+// link has no files left. The size and type of the file are checked by the caller, see
+// [UploadLink.Allows].
+func (fsys *FS) Drop(ctx context.Context, l UploadLink, name Name, r io.Reader) (uuid.UUID, error) {
+	const query = `update fs.upload_link set uploads = uploads + 1
+where id = $1 and revoked_at is null and expires_at > now()
+and (max_files is null or uploads < max_files)`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("upload_link.id", l.ID.String()),
+	)
+	ctx, span := tracer.Start(ctx, "FS.Drop", attr)
+	defer span.End()
+
+	// reserve a file, which is given back if the file is not added
+	cmd, err := fsys.RWC.Exec(ctx, query, l.ID)
+	if err != nil {
+		return uuid.Nil, Error(err)
+	}
+	if err := mustRowsAffected(cmd); err != nil {
+		return uuid.Nil, fmt.Errorf("fs: upload link has no files left: %w", dberrors.ErrNotExist)
+	}
+
+	p, err := pathOf(ctx, fsys.RWC, l.File)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	ctx = context.WithValue(ctx, uploadLinkKey{}, l.ID)
+	if l.owner != nil {
+		ctx = WithUser(ctx, *l.owner)
+	}
+	file, err := fsys.Create(WithScope(ctx, p), name, r, l.File)
+	if err != nil {
+		const query = `update fs.upload_link set uploads = uploads - 1 where id = $1`
+		_, rerr := fsys.RWC.Exec(context.WithoutCancel(ctx), query, l.ID)
+		debug.Printf(`_, %v := fsys.RWC.Exec(ctx, query, %q)`, rerr, l.ID)
+		return uuid.Nil, err
+	}
+	return file, nil
+}
+
+type uploadLinkKey struct{}
+
+// uploadLink returns the upload link that ctx adds files with, or nil.
+func uploadLink(ctx context.Context) *uuid.UUID {
+	id, _ := ctx.Value(uploadLinkKey{}).(uuid.UUID)
+	return ptr(id)
+}
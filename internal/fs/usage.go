@@ -0,0 +1,176 @@
+package fs
+
+import (
+	"context"
+	"math/rand/v2"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Usage is the space used by the files within a directory, or by a single file.
+// Files that are in the trash are not counted.
+type Usage struct {
+	Files int64 `json:"files"`
+	// Latest is the size of the latest version of each file and Total is the size
+	// of every version that is kept.
+	Latest int64 `json:"latest"`
+	Total  int64 `json:"total"`
+	// Physical is the size of the objects in the blob store, once identical content
+	// is shared. Objects can be shared across directories, so it is only known for
+	// the top-level directory.
+	Physical *int64 `json:"physical,omitempty"`
+}
+
+func (u Usage) sub(v Usage) Usage {
+	return Usage{Files: u.Files - v.Files, Latest: u.Latest - v.Latest, Total: u.Total - v.Total}
+}
+
+func (u Usage) neg() Usage { return Usage{}.sub(u) }
+
+func (u Usage) isZero() bool { return u.Files == 0 && u.Latest == 0 && u.Total == 0 }
+
+// Usage returns the space used by file, recursively for directories. The counts
+// are kept up to date as files change, so no files are read. If file is
+// [uuid.Nil], the usage of the whole tree is returned.
+func (d *DB) Usage(ctx context.Context, file uuid.UUID) (Usage, error) {
+	const query = `select coalesce(sum(files), 0)
+	, coalesce(sum(latest), 0)
+	, coalesce(sum(total), 0)
+	, coalesce(sum(phys), 0)
+from fs.usage_shard`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("file.id", file.String()),
+	)
+	ctx, span := tracer.Start(ctx, "DB.Usage", attr)
+	defer span.End()
+
+	if file != uuid.Nil {
+		// the entry must exist, not be in the trash and be readable
+		if _, _, _, err := d.Stat(ctx, file); err != nil {
+			return Usage{}, err
+		}
+		u, err := entryUsage(ctx, d.RWC, file)
+		return u, Error(err)
+	}
+	// the whole tree includes entries of every user
+	if err := authorize(ctx, d.RWC, uuid.Nil, PermAdmin); err != nil {
+		return Usage{}, Error(err)
+	}
+	var u Usage
+	var phys int64
+	err := d.RWC.QueryRow(ctx, query).Scan(&u.Files, &u.Latest, &u.Total, &phys)
+	if err != nil {
+		return Usage{}, Error(err)
+	}
+	u.Physical = &phys
+	return u, nil
+}
+
+// entryUsage returns the usage of file, which is read from its own row for
+// a directory and from its versions for a file.
+func entryUsage(ctx context.Context, q querier, file uuid.UUID) (Usage, error) {
+	const query = `select files, latest, total from fs.usage where id = $1`
+
+	var u Usage
+	err := q.QueryRow(ctx, query, file).Scan(&u.Files, &u.Latest, &u.Total)
+	switch {
+	case err == nil:
+		return u, nil
+	case err != pgx.ErrNoRows:
+		return Usage{}, err
+	}
+	// files have no row, and neither do directories that never held a file
+	return fileUsage(ctx, q, file)
+}
+
+// fileUsage returns the usage of the versions of file.
+func fileUsage(ctx context.Context, q querier, file uuid.UUID) (Usage, error) {
+	const query = `select count(*)
+	, coalesce(sum(sz), 0)
+	, coalesce((select sz from fs.blob_data where dir_entry = $1 order by v desc limit 1), 0)
+from fs.blob_data
+where dir_entry = $1`
+
+	var u Usage
+	var n int64
+	if err := q.QueryRow(ctx, query, file).Scan(&n, &u.Total, &u.Latest); err != nil {
+		return Usage{}, err
+	}
+	if n > 0 {
+		u.Files = 1
+	}
+	return u, nil
+}
+
+// accountFile adds the change in the usage of file since before to the directories
+// that contain it.
+func accountFile(ctx context.Context, q querier, file uuid.UUID, before Usage) error {
+	after, err := fileUsage(ctx, q, file)
+	if err != nil {
+		return err
+	}
+	var root *uuid.UUID
+	if err := q.QueryRow(ctx, `select root from fs.dir_entry where id = $1`, file).Scan(&root); err != nil {
+		return err
+	}
+	return account(ctx, q, value(root), after.sub(before))
+}
+
+// account adds u to the usage of root, each of its ancestors and the whole tree.
+func account(ctx context.Context, q querier, root uuid.UUID, u Usage) error {
+	if u.isZero() {
+		return nil
+	}
+	if err := accountShard(ctx, q, u, 0); err != nil {
+		return err
+	}
+	if root == uuid.Nil {
+		return nil
+	}
+	const query = `with recursive ancestor (id, root) as (
+	select id, root from fs.dir_entry where id = $1
+	union all
+	select f.id, f.root from fs.dir_entry f join ancestor a on f.id = a.root
+)
+insert into fs.usage (id, files, latest, total)
+select id, $2, $3, $4 from ancestor
+on conflict (id) do update set
+	files = fs.usage.files + excluded.files
+	, latest = fs.usage.latest + excluded.latest
+	, total = fs.usage.total + excluded.total`
+
+	_, err := q.Exec(ctx, query, root, u.Files, u.Latest, u.Total)
+	return err
+}
+
+// accountObject adds sz to the size of the objects in the blob store.
+func accountObject(ctx context.Context, q querier, sz int64) error {
+	if sz == 0 {
+		return nil
+	}
+	return accountShard(ctx, q, Usage{}, sz)
+}
+
+// accountShard adds u and phys to the usage of the whole tree. It is kept in
+// [usageShards] rows, one of which is picked at random, so that writes do not
+// all contend on the same row.
+func accountShard(ctx context.Context, q querier, u Usage, phys int64) error {
+	const query = `insert into fs.usage_shard (shard, files, latest, total, phys)
+values ($1, $2, $3, $4, $5)
+on conflict (shard) do update set
+	files = fs.usage_shard.files + excluded.files
+	, latest = fs.usage_shard.latest + excluded.latest
+	, total = fs.usage_shard.total + excluded.total
+	, phys = fs.usage_shard.phys + excluded.phys`
+
+	_, err := q.Exec(ctx, query, rand.IntN(usageShards), u.Files, u.Latest, u.Total, phys)
+	return err
+}
+
+// usageShards is the number of rows the usage of the whole tree is kept in.
+const usageShards = 16
@@ -0,0 +1,289 @@
+package fs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.adoublef/eyeoh/internal/database/errors"
+	"go.adoublef/eyeoh/internal/runtime/debug"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Version is a revision of the content of a file.
+type Version struct {
+	V       uint64    `json:"version"`
+	Size    int64     `json:"size"`
+	SHA     Etag      `json:"sha256"`
+	ModTime time.Time `json:"modifiedAt"`
+}
+
+// Versions returns every retained version of file, most recent first.
+func (d *DB) Versions(ctx context.Context, file uuid.UUID) ([]Version, error) {
+	const query = `select b.v
+	, b.sz
+	, b.sha
+	, b.mod_at
+from fs.dir_entry f
+join fs.blob_data b on f.id = b.dir_entry
+where f.id = $1 and f.del is null
+order by b.v desc
+`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("file.id", file.String()),
+	)
+	ctx, span := tracer.Start(ctx, "DB.Versions", attr)
+	defer span.End()
+
+	rows, err := d.RWC.Query(ctx, query, file)
+	if err != nil {
+		return nil, Error(err)
+	}
+	versions, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (Version, error) {
+		var v Version
+		err := row.Scan(&v.V, &v.Size, &v.SHA, &v.ModTime)
+		return v, err
+	})
+	if err != nil {
+		return nil, Error(err)
+	}
+	if len(versions) > 0 {
+		if err := authorize(ctx, d.RWC, file, PermRead); err != nil {
+			return nil, Error(err)
+		}
+		return versions, nil
+	}
+	// a file always has a version, so the entry is either missing or a directory
+	if err := isDir(ctx, d.RWC, file); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("fs: is a directory: %w", errors.ErrInvalid)
+}
+
+// StatVersion returns the [FileInfo] of file as it was at version v.
+func (d *DB) StatVersion(ctx context.Context, file uuid.UUID, v uint64) (info FileInfo, etag Etag, err error) {
+	const query = `select f.name
+	, coalesce(b.ref, b.id)
+	, b.sz
+	, b.mod_at
+	, b.sha
+from fs.dir_entry f
+join fs.blob_data b on f.id = b.dir_entry
+where f.id = $1 and b.v = $2 and f.del is null
+`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("file.id", file.String()),
+		attribute.Int("file.v", int(v)),
+	)
+	ctx, span := tracer.Start(ctx, "DB.StatVersion", attr)
+	defer span.End()
+
+	var de dirEntry
+	var bd blobData
+	if err = d.RWC.QueryRow(ctx, query, file, v).Scan(
+		&de.name,
+		&bd.id,
+		&bd.sz,
+		&de.modAt,
+		&bd.sha,
+	); err != nil {
+		return FileInfo{}, nil, Error(err)
+	}
+	if err := authorize(ctx, d.RWC, file, PermRead); err != nil {
+		return FileInfo{}, nil, Error(err)
+	}
+	de.id = file
+	return de.info(bd), bd.sha, nil
+}
+
+// Revert makes version of file the latest by adding it again as a new version.
+// The version of the entry enables safe multi-user modifications. It returns the
+// new version of the entry.
+func (d *DB) Revert(ctx context.Context, file uuid.UUID, version, v uint64) (uint64, error) {
+	const query = `
+with dir_entry as (
+	update fs.dir_entry
+	set v = v + 1, mod_at = now()
+	where id = $1 and v = $2 and del is null
+	returning id, mod_at, v)
+insert into fs.blob_data (id, dir_entry, sz, sha, mod_at, v, ref)
+select $3, f.id, b.sz, b.sha, f.mod_at, f.v, coalesce(b.ref, b.id)
+from dir_entry f
+join fs.blob_data b on f.id = b.dir_entry and b.v = $4
+returning v, ref
+`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("file.id", file.String()),
+		attribute.Int("file.v", int(v)),
+		attribute.Int("file.version", int(version)),
+	)
+	ctx, span := tracer.Start(ctx, "DB.Revert", attr)
+	defer span.End()
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return 0, Error(err)
+	}
+	// the entry is updated even if the version is missing, so it must be rolled back
+	var next uint64
+	err = pgx.BeginTxFunc(ctx, d.RWC, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		if err := authorize(ctx, tx, file, PermWrite); err != nil {
+			return err
+		}
+		before, err := fileUsage(ctx, tx, file)
+		if err != nil {
+			return err
+		}
+		var obj uuid.UUID
+		if err := tx.QueryRow(ctx, query, file, v, id, version).Scan(&next, &obj); err != nil {
+			return err
+		}
+		if err := accountFile(ctx, tx, file, before); err != nil {
+			return err
+		}
+		if err := checkQuota(ctx, tx, file); err != nil {
+			return err
+		}
+		return retain(ctx, tx, obj)
+	})
+	if err != nil {
+		return 0, Error(err)
+	}
+	return next, nil
+}
+
+// SetMaxVersions sets the number of versions kept for file.
+// If n is zero, the limit of the [FS] is used.
+func (d *DB) SetMaxVersions(ctx context.Context, file uuid.UUID, n int) error {
+	const query = `update fs.dir_entry set max_v = $2 where id = $1 and del is null`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("file.id", file.String()),
+		attribute.Int("file.max_v", n),
+	)
+	ctx, span := tracer.Start(ctx, "DB.SetMaxVersions", attr)
+	defer span.End()
+
+	if n < 0 {
+		return fmt.Errorf("fs: max versions must not be negative: %w", errors.ErrInvalid)
+	}
+	if err := authorize(ctx, d.RWC, file, PermWrite); err != nil {
+		return Error(err)
+	}
+	cmd, err := d.RWC.Exec(ctx, query, file, ptr(n))
+	if err != nil {
+		return Error(err)
+	}
+	return mustRowsAffected(cmd)
+}
+
+// Prune deletes the oldest versions of file so that at most n are kept. If the
+// file has its own limit, that is used instead. If neither is set, nothing is
+// deleted. It returns the blobs that are no longer referenced.
+func (d *DB) Prune(ctx context.Context, file uuid.UUID, n int) (refs []uuid.UUID, err error) {
+	const query = `delete from fs.blob_data
+where dir_entry = $1 and v not in (
+	select v from fs.blob_data
+	where dir_entry = $1
+	order by v desc
+	limit $2)
+returning coalesce(ref, id)`
+
+	attr := trace.WithAttributes(
+		attribute.String("sql.query", query),
+		attribute.String("file.id", file.String()),
+		attribute.Int("file.max_v", n),
+	)
+	ctx, span := tracer.Start(ctx, "DB.Prune", attr)
+	defer span.End()
+
+	err = pgx.BeginTxFunc(ctx, d.RWC, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		if err := authorize(ctx, tx, file, PermWrite); err != nil {
+			return err
+		}
+		var maxV *int
+		if err := tx.QueryRow(ctx, `select max_v from fs.dir_entry where id = $1`, file).Scan(&maxV); err != nil {
+			return err
+		}
+		if maxV != nil {
+			n = *maxV
+		}
+		if n <= 0 {
+			return nil
+		}
+		before, err := fileUsage(ctx, tx, file)
+		if err != nil {
+			return err
+		}
+		rows, err := tx.Query(ctx, query, file, n)
+		if err != nil {
+			return err
+		}
+		deleted, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+		if err != nil {
+			return err
+		}
+		if err := accountFile(ctx, tx, file, before); err != nil {
+			return err
+		}
+		refs, err = release(ctx, tx, deleted)
+		return err
+	})
+	if err != nil {
+		return nil, Error(err)
+	}
+	return refs, nil
+}
+
+// OpenVersion opens file as it was at version v, see [FS.Open].
+func (fsys *FS) OpenVersion(ctx context.Context, file uuid.UUID, v uint64) (f *File, mime string, etag Etag, err error) {
+	fi, sha, err := fsys.StatVersion(ctx, file, v)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return fsys.open(ctx, fi, sha)
+}
+
+// Revert makes version of file the latest, see [DB.Revert]. Versions over the
+// limit are pruned.
+func (fsys *FS) Revert(ctx context.Context, file uuid.UUID, version, v uint64) (uint64, error) {
+	next, err := fsys.DB.Revert(ctx, file, version, v)
+	if err != nil {
+		return 0, err
+	}
+	fsys.prune(ctx, file)
+	return next, nil
+}
+
+// SetMaxVersions sets the number of versions kept for file, see [DB.SetMaxVersions].
+// Versions over the new limit are pruned.
+func (fsys *FS) SetMaxVersions(ctx context.Context, file uuid.UUID, n int) error {
+	if err := fsys.DB.SetMaxVersions(ctx, file, n); err != nil {
+		return err
+	}
+	fsys.prune(ctx, file)
+	return nil
+}
+
+// prune deletes the versions of file over the limit along with their blobs. It is
+// best effort, as the write has already succeeded, and is retried on the next write.
+func (fsys *FS) prune(ctx context.Context, file uuid.UUID) {
+	refs, err := fsys.Prune(ctx, file, fsys.MaxVersions)
+	if err != nil {
+		debug.Printf(`_, %v := fsys.Prune(ctx, %q, %d)`, err, file, fsys.MaxVersions)
+		return
+	}
+	// if this fails the blobs are orphaned but no longer reachable
+	err = fsys.Delete(ctx, refs...)
+	debug.Printf(`%v := fsys.Delete(ctx, %d refs...)`, err, len(refs))
+}
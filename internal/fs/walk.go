@@ -0,0 +1,93 @@
+package fs
+
+import (
+	"context"
+	iofs "io/fs"
+
+	"github.com/google/uuid"
+)
+
+// SkipDir and SkipAll are used as return values from a [WalkDirFunc],
+// with the same meaning as in [iofs.WalkDir].
+var (
+	SkipDir = iofs.SkipDir
+	SkipAll = iofs.SkipAll
+)
+
+// WalkDirFunc is the type of the function called by [FS.WalkDir] to visit
+// each file or directory, as with [iofs.WalkDirFunc].
+type WalkDirFunc func(path string, d DirEntry, err error) error
+
+// WalkDir walks the tree rooted at root, calling fn for each file or directory in
+// the tree, including root. If root is [uuid.Nil], the whole tree is walked.
+//
+// As with [iofs.WalkDir], entries are walked in lexical order and fn decides how
+// errors are handled. Directories are read a page at a time, so the tree is never
+// held in memory.
+func (fsys *FS) WalkDir(ctx context.Context, root uuid.UUID, fn WalkDirFunc) error {
+	de, err := fsys.entry(ctx, root)
+	if err != nil {
+		err = fn("", DirEntry{FileInfo: FileInfo{ID: root}}, err)
+	} else {
+		err = fsys.walkDir(ctx, de, fn)
+	}
+	if err == SkipDir || err == SkipAll {
+		return nil
+	}
+	return err
+}
+
+// walkDir recursively descends into directories, calling fn.
+func (fsys *FS) walkDir(ctx context.Context, de DirEntry, fn WalkDirFunc) error {
+	if err := fn(de.Path, de, nil); err != nil || !de.IsDir {
+		if err == SkipDir && de.IsDir {
+			// successfully skipped directory
+			err = nil
+		}
+		return err
+	}
+
+	c := Cursor{Sort: SortName}
+	for {
+		entries, next, err := fsys.ReadDir(ctx, de.ID, c, MaxReadDirLimit)
+		if err != nil {
+			// second call, to report the error reading the directory
+			if err := fn(de.Path, de, err); err != nil {
+				if err == SkipDir {
+					err = nil
+				}
+				return err
+			}
+			return nil
+		}
+		for _, e := range entries {
+			if err := fsys.walkDir(ctx, e, fn); err != nil {
+				// skip the rest of the directory
+				if err == SkipDir {
+					return nil
+				}
+				return err
+			}
+		}
+		if next.IsZero() {
+			return nil
+		}
+		c = next
+	}
+}
+
+// entry returns the entry of file with its path. [uuid.Nil] is the top-level directory.
+func (fsys *FS) entry(ctx context.Context, file uuid.UUID) (DirEntry, error) {
+	if file == uuid.Nil {
+		return DirEntry{Path: Path{}.String(), FileInfo: FileInfo{IsDir: true}}, nil
+	}
+	info, _, etag, err := fsys.Stat(ctx, file)
+	if err != nil {
+		return DirEntry{}, err
+	}
+	p, err := pathOf(ctx, fsys.RWC, file)
+	if err != nil {
+		return DirEntry{}, err
+	}
+	return DirEntry{Path: p.String(), FileInfo: info, ETag: etag}, nil
+}
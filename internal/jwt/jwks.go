@@ -0,0 +1,237 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JWKS is a JSON Web Key Set. Keys that are not for signatures, or of a type
+// that is not supported, are ignored.
+type JWKS struct {
+	keys []jwk
+}
+
+type jwk struct {
+	kid string
+	key crypto.PublicKey
+}
+
+// ParseJWKS parses the JSON encoding of a key set.
+func ParseJWKS(b []byte) (*JWKS, error) {
+	var raw struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			Crv string `json:"crv"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("jwt: failed to parse key set: %w", err)
+	}
+	set := &JWKS{}
+	for _, k := range raw.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		var key crypto.PublicKey
+		var err error
+		switch k.Kty {
+		case "RSA":
+			key, err = rsaKey(k.N, k.E)
+		case "EC":
+			key, err = ecKey(k.Crv, k.X, k.Y)
+		case "OKP":
+			key, err = okpKey(k.Crv, k.X)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("jwt: key %q: %w", k.Kid, err)
+		}
+		set.keys = append(set.keys, jwk{k.Kid, key})
+	}
+	return set, nil
+}
+
+// Key returns the key named kid. If kid is empty, the set must have a single key.
+func (s *JWKS) Key(_ context.Context, kid string) (crypto.PublicKey, error) {
+	if kid == "" {
+		if len(s.keys) != 1 {
+			return nil, ErrKey
+		}
+		return s.keys[0].key, nil
+	}
+	for _, k := range s.keys {
+		if k.kid == kid {
+			return k.key, nil
+		}
+	}
+	return nil, ErrKey
+}
+
+func rsaKey(n64, e64 string) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(n64)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(e64)
+	if err != nil {
+		return nil, err
+	}
+	if len(e) == 0 || len(e) > 4 {
+		return nil, errors.New("invalid exponent")
+	}
+	key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	if key.N.BitLen() < 2048 {
+		return nil, errors.New("rsa key is too small")
+	}
+	return key, nil
+}
+
+func ecKey(crv, x64, y64 string) (*ecdsa.PublicKey, error) {
+	var c elliptic.Curve
+	var ec ecdh.Curve
+	switch crv {
+	case "P-256":
+		c, ec = elliptic.P256(), ecdh.P256()
+	case "P-384":
+		c, ec = elliptic.P384(), ecdh.P384()
+	case "P-521":
+		c, ec = elliptic.P521(), ecdh.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", crv)
+	}
+	size := (c.Params().BitSize + 7) / 8
+	x, err := base64.RawURLEncoding.DecodeString(x64)
+	if err != nil {
+		return nil, err
+	}
+	y, err := base64.RawURLEncoding.DecodeString(y64)
+	if err != nil {
+		return nil, err
+	}
+	if len(x) != size || len(y) != size {
+		return nil, errors.New("invalid point")
+	}
+	// the point is checked to be on the curve
+	if _, err := ec.NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+		return nil, err
+	}
+	return &ecdsa.PublicKey{Curve: c, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+}
+
+func okpKey(crv, x64 string) (ed25519.PublicKey, error) {
+	if crv != "Ed25519" {
+		return nil, fmt.Errorf("unsupported curve %q", crv)
+	}
+	x, err := base64.RawURLEncoding.DecodeString(x64)
+	if err != nil {
+		return nil, err
+	}
+	if len(x) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid key size")
+	}
+	return ed25519.PublicKey(x), nil
+}
+
+// RemoteKeySet is a key set that is fetched from URL. It is fetched again when a
+// token names a key it does not have, at most once every MinRefresh.
+type RemoteKeySet struct {
+	URL    string
+	Client *http.Client
+
+	mu   sync.Mutex
+	set  *JWKS
+	next time.Time
+}
+
+// MinRefresh is the least time between fetches of a [RemoteKeySet].
+const MinRefresh = time.Minute
+
+func (r *RemoteKeySet) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.set != nil {
+		if key, err := r.set.Key(ctx, kid); err == nil || time.Now().Before(r.next) {
+			return key, err
+		}
+	}
+	set, err := r.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.set, r.next = set, time.Now().Add(MinRefresh)
+	return r.set.Key(ctx, kid)
+}
+
+func (r *RemoteKeySet) fetch(ctx context.Context) (*JWKS, error) {
+	b, err := get(ctx, r.Client, r.URL)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(b)
+}
+
+// Discover finds the key set of issuer with OpenID Connect discovery.
+func Discover(ctx context.Context, client *http.Client, issuer string) (*RemoteKeySet, error) {
+	u := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+	b, err := get(ctx, client, u)
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("jwt: failed to parse discovery document: %w", err)
+	}
+	// the issuer of the tokens is checked against the one that was discovered
+	if doc.Issuer != issuer {
+		return nil, fmt.Errorf("jwt: discovered issuer %q does not match %q", doc.Issuer, issuer)
+	}
+	if doc.JWKSURI == "" {
+		return nil, errors.New("jwt: discovery document has no jwks_uri")
+	}
+	return &RemoteKeySet{URL: doc.JWKSURI, Client: client}, nil
+}
+
+func get(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("jwt: failed to fetch %s: %w", url, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jwt: failed to fetch %s: %s", url, res.Status)
+	}
+	return io.ReadAll(io.LimitReader(res.Body, 1<<20))
+}
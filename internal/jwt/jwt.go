@@ -0,0 +1,266 @@
+// Package jwt verifies JSON Web Tokens signed with asymmetric keys. The keys are
+// read from a JSON Web Key Set, either a local file or one found with OpenID
+// Connect discovery.
+package jwt
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+var (
+	ErrInvalid = errors.New("jwt: invalid token")
+	ErrExpired = errors.New("jwt: token is expired")
+	ErrKey     = errors.New("jwt: no key for token")
+)
+
+// Claims are the registered claims of a token. Times are seconds since the epoch,
+// zero if not set.
+type Claims struct {
+	Issuer    string   `json:"iss,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+}
+
+// Audience is the aud claim, which is either a string or a list of strings.
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = Audience{s}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// KeySet returns the public key with the key id kid. If kid is empty, the token
+// did not name a key.
+type KeySet interface {
+	Key(ctx context.Context, kid string) (crypto.PublicKey, error)
+}
+
+// Verifier verifies the tokens of an issuer.
+type Verifier struct {
+	Keys KeySet
+	// Issuer and Audience must match the claims of a token, if set.
+	Issuer, Audience string
+	// Leeway allows for clock skew when checking the times of a token.
+	Leeway time.Duration
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+	Typ string `json:"typ,omitempty"`
+}
+
+// Verify checks the signature and claims of token and returns the claims.
+// A token must expire.
+func (v *Verifier) Verify(ctx context.Context, token string) (Claims, error) {
+	h64, rest, ok := strings.Cut(token, ".")
+	if !ok {
+		return Claims{}, ErrInvalid
+	}
+	p64, s64, ok := strings.Cut(rest, ".")
+	if !ok {
+		return Claims{}, ErrInvalid
+	}
+	var h header
+	if err := decode(h64, &h); err != nil {
+		return Claims{}, err
+	}
+	alg, ok := algs[h.Alg]
+	if !ok {
+		return Claims{}, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalid, h.Alg)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(s64)
+	if err != nil {
+		return Claims{}, ErrInvalid
+	}
+	key, err := v.Keys.Key(ctx, h.Kid)
+	if err != nil {
+		return Claims{}, err
+	}
+	if err := alg.verify(key, []byte(token[:len(h64)+1+len(p64)]), sig); err != nil {
+		return Claims{}, err
+	}
+
+	var c Claims
+	if err := decode(p64, &c); err != nil {
+		return Claims{}, err
+	}
+	now := time.Now()
+	switch {
+	case c.ExpiresAt == 0:
+		return Claims{}, fmt.Errorf("%w: no expiry", ErrInvalid)
+	case now.Add(-v.Leeway).After(time.Unix(c.ExpiresAt, 0)):
+		return Claims{}, ErrExpired
+	case c.NotBefore != 0 && now.Add(v.Leeway).Before(time.Unix(c.NotBefore, 0)):
+		return Claims{}, fmt.Errorf("%w: not valid yet", ErrInvalid)
+	case v.Issuer != "" && c.Issuer != v.Issuer:
+		return Claims{}, fmt.Errorf("%w: unexpected issuer", ErrInvalid)
+	case v.Audience != "" && !slices.Contains(c.Audience, v.Audience):
+		return Claims{}, fmt.Errorf("%w: unexpected audience", ErrInvalid)
+	}
+	return c, nil
+}
+
+// Sign returns a token with the claims c signed by key, which must be an
+// [*rsa.PrivateKey], [*ecdsa.PrivateKey] or [ed25519.PrivateKey]. The token
+// names the key kid, if set.
+func Sign(key crypto.Signer, kid string, c any) (string, error) {
+	var name string
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		name = "RS256"
+	case *ecdsa.PrivateKey:
+		name = "ES" + k.Curve.Params().Name[2:]
+		if name == "ES521" {
+			name = "ES512"
+		}
+	case ed25519.PrivateKey:
+		name = "EdDSA"
+	default:
+		return "", fmt.Errorf("jwt: unsupported key %T", key)
+	}
+	h, err := json.Marshal(header{Alg: name, Kid: kid, Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	p, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	msg := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(p)
+	sig, err := algs[name].sign(key, []byte(msg))
+	if err != nil {
+		return "", err
+	}
+	return msg + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+func decode(s string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return ErrInvalid
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	return nil
+}
+
+// alg is a signing algorithm. Symmetric algorithms and "none" are not supported,
+// so a public key can never be used as a shared secret.
+type alg struct {
+	hash crypto.Hash
+	// pss is set for RSASSA-PSS, else RSA keys use PKCS #1 v1.5.
+	pss bool
+	// size is the size of each of r and s of an ECDSA signature.
+	size int
+}
+
+var algs = map[string]alg{
+	"RS256": {hash: crypto.SHA256},
+	"RS384": {hash: crypto.SHA384},
+	"RS512": {hash: crypto.SHA512},
+	"PS256": {hash: crypto.SHA256, pss: true},
+	"PS384": {hash: crypto.SHA384, pss: true},
+	"PS512": {hash: crypto.SHA512, pss: true},
+	"ES256": {hash: crypto.SHA256, size: 32},
+	"ES384": {hash: crypto.SHA384, size: 48},
+	"ES512": {hash: crypto.SHA512, size: 66},
+	"EdDSA": {},
+}
+
+func (a alg) digest(msg []byte) []byte {
+	h := a.hash.New()
+	h.Write(msg)
+	return h.Sum(nil)
+}
+
+func (a alg) verify(key crypto.PublicKey, msg, sig []byte) error {
+	bad := fmt.Errorf("%w: bad signature", ErrInvalid)
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if a.hash == 0 || a.size != 0 {
+			break
+		}
+		var err error
+		if a.pss {
+			err = rsa.VerifyPSS(k, a.hash, a.digest(msg), sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		} else {
+			err = rsa.VerifyPKCS1v15(k, a.hash, a.digest(msg), sig)
+		}
+		if err != nil {
+			return bad
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		if a.size == 0 || (k.Curve.Params().BitSize+7)/8 != a.size {
+			break
+		}
+		if len(sig) != 2*a.size {
+			return bad
+		}
+		r, s := new(big.Int).SetBytes(sig[:a.size]), new(big.Int).SetBytes(sig[a.size:])
+		if !ecdsa.Verify(k, a.digest(msg), r, s) {
+			return bad
+		}
+		return nil
+	case ed25519.PublicKey:
+		if a.hash != 0 {
+			break
+		}
+		if !ed25519.Verify(k, msg, sig) {
+			return bad
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: algorithm does not match key", ErrInvalid)
+}
+
+func (a alg) sign(key crypto.Signer, msg []byte) ([]byte, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return rsa.SignPKCS1v15(rand.Reader, k, a.hash, a.digest(msg))
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, a.digest(msg))
+		if err != nil {
+			return nil, err
+		}
+		sig := make([]byte, 2*a.size)
+		r.FillBytes(sig[:a.size])
+		s.FillBytes(sig[a.size:])
+		return sig, nil
+	case ed25519.PrivateKey:
+		return ed25519.Sign(k, msg), nil
+	}
+	return nil, fmt.Errorf("jwt: unsupported key %T", key)
+}
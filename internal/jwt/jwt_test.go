@@ -0,0 +1,174 @@
+package jwt_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "go.adoublef/eyeoh/internal/jwt"
+	"go.adoublef/eyeoh/internal/testing/is"
+)
+
+func Test_Verifier_Verify(t *testing.T) {
+	ec, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	is.OK(t, err) // generate ecdsa key
+	_, ed, err := ed25519.GenerateKey(rand.Reader)
+	is.OK(t, err) // generate ed25519 key
+	rk, err := rsa.GenerateKey(rand.Reader, 2048)
+	is.OK(t, err) // generate rsa key
+
+	set, err := ParseJWKS([]byte(fmt.Sprintf(`{"keys":[%s,%s,%s]}`,
+		ecJWK("ec", &ec.PublicKey), edJWK("ed", ed.Public().(ed25519.PublicKey)), rsaJWK("rsa", &rk.PublicKey))))
+	is.OK(t, err) // parse key set
+
+	v := &Verifier{Keys: set, Issuer: "https://id.example.com", Audience: "eyeoh"}
+	valid := Claims{
+		Issuer:    "https://id.example.com",
+		Subject:   "alice",
+		Audience:  Audience{"eyeoh"},
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	}
+
+	type testcase struct {
+		key    crypto.Signer
+		kid    string
+		claims Claims
+		want   error
+	}
+
+	var tt = map[string]testcase{
+		"ES256": {
+			key:    ec,
+			kid:    "ec",
+			claims: valid,
+		},
+		"EdDSA": {
+			key:    ed,
+			kid:    "ed",
+			claims: valid,
+		},
+		"RS256": {
+			key:    rk,
+			kid:    "rsa",
+			claims: valid,
+		},
+		"ErrExpired": {
+			key:    ec,
+			kid:    "ec",
+			claims: Claims{Issuer: valid.Issuer, Audience: valid.Audience, ExpiresAt: time.Now().Add(-time.Hour).Unix()},
+			want:   ErrExpired,
+		},
+		"ErrAudience": {
+			key:    ec,
+			kid:    "ec",
+			claims: Claims{Issuer: valid.Issuer, Audience: Audience{"other"}, ExpiresAt: valid.ExpiresAt},
+			want:   ErrInvalid,
+		},
+		"ErrNoExpiry": {
+			key:    ec,
+			kid:    "ec",
+			claims: Claims{Issuer: valid.Issuer, Audience: valid.Audience},
+			want:   ErrInvalid,
+		},
+		"ErrWrongKey": {
+			key:    ec,
+			kid:    "ed",
+			claims: valid,
+			want:   ErrInvalid,
+		},
+		"ErrUnknownKey": {
+			key:    ec,
+			kid:    "missing",
+			claims: valid,
+			want:   ErrKey,
+		},
+	}
+	for name, tc := range tt {
+		t.Run(name, func(t *testing.T) {
+			token, err := Sign(tc.key, tc.kid, tc.claims)
+			is.OK(t, err) // sign token
+
+			c, err := v.Verify(context.Background(), token)
+			if tc.want != nil {
+				is.NotOK(t, err, tc.want) // got;want
+				return
+			}
+			is.OK(t, err) // verify token
+			is.Equal(t, c.Subject, "alice")
+		})
+	}
+
+	t.Run("ErrAlgNone", func(t *testing.T) {
+		token, err := Sign(ec, "ec", valid)
+		is.OK(t, err) // sign token
+
+		parts := strings.Split(token, ".")
+		parts[0] = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","kid":"ec"}`))
+		_, err = v.Verify(context.Background(), parts[0]+"."+parts[1]+".")
+		is.NotOK(t, err, ErrInvalid) // got;want
+	})
+
+	t.Run("ErrTampered", func(t *testing.T) {
+		token, err := Sign(ec, "ec", valid)
+		is.OK(t, err) // sign token
+
+		parts := strings.Split(token, ".")
+		parts[1] = base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"mallory","exp":9999999999}`))
+		_, err = v.Verify(context.Background(), strings.Join(parts, "."))
+		is.NotOK(t, err, ErrInvalid) // got;want
+	})
+}
+
+func Test_Discover(t *testing.T) {
+	ec, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	is.OK(t, err) // generate ecdsa key
+
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			fmt.Fprintf(w, `{"issuer":%q,"jwks_uri":%q}`, ts.URL, ts.URL+"/keys")
+		case "/keys":
+			fmt.Fprintf(w, `{"keys":[%s]}`, ecJWK("ec", &ec.PublicKey))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(ts.Close)
+
+	keys, err := Discover(context.Background(), ts.Client(), ts.URL)
+	is.OK(t, err) // discover key set
+
+	v := &Verifier{Keys: keys, Issuer: ts.URL}
+	token, err := Sign(ec, "ec", Claims{Issuer: ts.URL, Subject: "alice", ExpiresAt: time.Now().Add(time.Hour).Unix()})
+	is.OK(t, err) // sign token
+
+	c, err := v.Verify(context.Background(), token)
+	is.OK(t, err) // verify token
+	is.Equal(t, c.Subject, "alice")
+}
+
+func ecJWK(kid string, k *ecdsa.PublicKey) string {
+	return fmt.Sprintf(`{"kty":"EC","kid":%q,"crv":"P-256","x":%q,"y":%q}`, kid, b64(k.X.FillBytes(make([]byte, 32))), b64(k.Y.FillBytes(make([]byte, 32))))
+}
+
+func edJWK(kid string, k ed25519.PublicKey) string {
+	return fmt.Sprintf(`{"kty":"OKP","kid":%q,"crv":"Ed25519","x":%q}`, kid, b64(k))
+}
+
+func rsaJWK(kid string, k *rsa.PublicKey) string {
+	return fmt.Sprintf(`{"kty":"RSA","kid":%q,"n":%q,"e":"AQAB"}`, kid, b64(k.N.Bytes()))
+}
+
+func b64(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
@@ -0,0 +1,95 @@
+// Package macaroon implements bearer tokens whose holder can restrict them
+// further, without contacting the issuer, by adding caveats. Each caveat is
+// chained into the signature, so caveats cannot be removed.
+//
+// See https://research.google/pubs/macaroons-cookies-with-contextual-caveats-for-decentralized-authorization-in-the-cloud/.
+package macaroon
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+var ErrInvalid = errors.New("macaroon: invalid signature")
+
+// Macaroon is a token with an id, known to the issuer, and a list of caveats
+// that must all hold for it to be used.
+type Macaroon struct {
+	id      []byte
+	caveats []string
+	sig     []byte
+}
+
+// New returns a macaroon with the id, signed with the root key of the issuer.
+func New(key, id []byte) *Macaroon {
+	return &Macaroon{id: slices.Clone(id), sig: mac(key, id)}
+}
+
+// ID returns the id of m.
+func (m *Macaroon) ID() []byte { return slices.Clone(m.id) }
+
+// Caveats returns the caveats of m, in the order they were added.
+func (m *Macaroon) Caveats() []string { return slices.Clone(m.caveats) }
+
+// Add restricts m with the caveat. It does not need the root key.
+func (m *Macaroon) Add(caveat string) {
+	m.caveats = append(m.caveats, caveat)
+	m.sig = mac(m.sig, []byte(caveat))
+}
+
+// Verify checks that m was signed with the root key and that check accepts
+// each of its caveats. The first error returned by check is returned.
+func (m *Macaroon) Verify(key []byte, check func(caveat string) error) error {
+	sig := mac(key, m.id)
+	for _, c := range m.caveats {
+		sig = mac(sig, []byte(c))
+	}
+	if !hmac.Equal(sig, m.sig) {
+		return ErrInvalid
+	}
+	for _, c := range m.caveats {
+		if err := check(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type encoded struct {
+	ID      []byte   `json:"i"`
+	Caveats []string `json:"c,omitempty"`
+	Sig     []byte   `json:"s"`
+}
+
+// String returns the encoding of m, which is safe to use in a url.
+func (m *Macaroon) String() string {
+	b, _ := json.Marshal(encoded{m.id, m.caveats, m.sig})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Parse parses the encoding of a macaroon, as returned by [Macaroon.String].
+func Parse(s string) (*Macaroon, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("macaroon: %w", err)
+	}
+	var e encoded
+	if err := json.Unmarshal(b, &e); err != nil {
+		return nil, fmt.Errorf("macaroon: %w", err)
+	}
+	if len(e.ID) == 0 || len(e.Sig) != sha256.Size {
+		return nil, errors.New("macaroon: missing id or signature")
+	}
+	return &Macaroon{id: e.ID, caveats: e.Caveats, sig: e.Sig}, nil
+}
+
+func mac(key, msg []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(msg)
+	return h.Sum(nil)
+}
@@ -0,0 +1,93 @@
+package macaroon_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	. "go.adoublef/eyeoh/internal/macaroon"
+	"go.adoublef/eyeoh/internal/testing/is"
+)
+
+func Test_Macaroon_Verify(t *testing.T) {
+	var (
+		key   = []byte("0123456789abcdef0123456789abcdef")
+		errNo = errors.New("caveat does not hold")
+	)
+	accept := func(string) error { return nil }
+
+	type testcase struct {
+		token func() string
+		key   []byte
+		check func(string) error
+		want  error
+	}
+
+	var tt = map[string]testcase{
+		"OK": {
+			token: func() string {
+				m := New(key, []byte("id"))
+				m.Add("ops = read")
+				return m.String()
+			},
+			key:   key,
+			check: accept,
+		},
+		"OKAttenuated": {
+			token: func() string {
+				m := New(key, []byte("id"))
+				m.Add("ops = read")
+				// the holder adds a caveat without the key
+				m, err := Parse(m.String())
+				is.OK(t, err) // parse macaroon
+				m.Add("path = /ingest")
+				return m.String()
+			},
+			key:   key,
+			check: accept,
+		},
+		"ErrKey": {
+			token: func() string { return New(key, []byte("id")).String() },
+			key:   []byte("another key"),
+			check: accept,
+			want:  ErrInvalid,
+		},
+		"ErrCaveat": {
+			token: func() string {
+				m := New(key, []byte("id"))
+				m.Add("ops = read")
+				return m.String()
+			},
+			key:   key,
+			check: func(string) error { return errNo },
+			want:  errNo,
+		},
+	}
+	for name, tc := range tt {
+		t.Run(name, func(t *testing.T) {
+			m, err := Parse(tc.token())
+			is.OK(t, err)                                    // parse macaroon
+			is.NotOK(t, m.Verify(tc.key, tc.check), tc.want) // got;want
+		})
+	}
+
+	t.Run("ErrRemoved", func(t *testing.T) {
+		m := New(key, []byte("id"))
+		m.Add("ops = read")
+		m.Add("path = /ingest")
+
+		// drop the last caveat but keep the signature
+		b, err := base64.RawURLEncoding.DecodeString(m.String())
+		is.OK(t, err) // decode macaroon
+		var raw map[string]any
+		is.OK(t, json.Unmarshal(b, &raw))
+		raw["c"] = []string{"ops = read"}
+		b, err = json.Marshal(raw)
+		is.OK(t, err) // encode macaroon
+
+		forged, err := Parse(base64.RawURLEncoding.EncodeToString(b))
+		is.OK(t, err)                                       // parse macaroon
+		is.NotOK(t, forged.Verify(key, accept), ErrInvalid) // got;want
+	})
+}
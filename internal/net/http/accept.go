@@ -14,19 +14,22 @@ import (
 const (
 	ContentTypJSON = "application/json"
 	ContentTypHTML = "text/html"
+	// ContentTypNDJSON is newline-delimited JSON, for responses that are streamed.
+	ContentTypNDJSON = "application/x-ndjson"
 )
 
 var notAcceptableHandler = &statusHandler{
 	http.StatusNotAcceptable,
 	fmt.Sprintf(`
-"Only %q or %q content types supported.",
-`[1:], ContentTypHTML, ContentTypJSON),
+"Only %q, %q or %q content types supported.",
+`[1:], ContentTypHTML, ContentTypJSON, ContentTypNDJSON),
 }
 
 // AcceptHandler verifies the client can accept the response of a request.
 func AcceptHandler(h http.Handler) http.Handler {
 	var (
-		ct = []string{ContentTypJSON, ContentTypHTML}
+		// JSON is first, so that it is chosen for a wildcard
+		ct = []string{ContentTypJSON, ContentTypHTML, ContentTypNDJSON}
 		ce = []string{"identity", "gzip" /* "deflate", "zstd", "zlib" */}
 	)
 	// note: if we allow compression option
@@ -0,0 +1,123 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	dberrors "go.adoublef/eyeoh/internal/database/errors"
+	"go.adoublef/eyeoh/internal/fs"
+	"go.adoublef/eyeoh/internal/jwt"
+	"go.adoublef/eyeoh/internal/runtime/debug"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var unauthorizedHandler = &statusHandler{
+	code: http.StatusUnauthorized,
+	s:    `a valid bearer token is required`,
+}
+
+// Authenticator returns the user a bearer token was issued to.
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (uuid.UUID, error)
+}
+
+// Auth authenticates api keys and, if JWT is set, JSON Web Tokens whose
+// subject is linked to a user.
+type Auth struct {
+	FS  *fs.FS
+	JWT *jwt.Verifier
+}
+
+func (a *Auth) Authenticate(ctx context.Context, token string) (uuid.UUID, error) {
+	ctx, span := tracer.Start(ctx, "http.Auth.Authenticate")
+	defer span.End()
+
+	if strings.HasPrefix(token, fs.KeyPrefix) {
+		span.SetAttributes(attribute.String("auth.method", "api_key"))
+		return a.FS.VerifyKey(ctx, token)
+	}
+	if a.JWT == nil {
+		return uuid.Nil, jwt.ErrInvalid
+	}
+	span.SetAttributes(attribute.String("auth.method", "jwt"))
+	c, err := a.JWT.Verify(ctx, token)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return a.FS.Identity(ctx, c.Issuer, c.Subject)
+}
+
+// AuthHandler returns a [http.Handler] that requires every request, other than
+// the readiness check, share links and upload links, to carry a bearer token.
+// The user of the token is added to the request context with [fs.WithUser]. If
+// a is also a [CapabilityVerifier], capability tokens are accepted and their
+// caveats checked against the request.
+func AuthHandler(h http.Handler, a Authenticator) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if public(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		ctx := r.Context()
+
+		scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !strings.EqualFold(scheme, "Bearer") || token == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer`)
+			unauthorizedHandler.ServeHTTP(w, r)
+			return
+		}
+
+		token = strings.TrimSpace(token)
+		var user uuid.UUID
+		var err error
+		var c *capability
+		if v, ok := a.(CapabilityVerifier); ok && strings.HasPrefix(token, fs.CapabilityPrefix) {
+			c = &capability{}
+			user, err = v.VerifyCapability(ctx, token, c.check(r))
+		} else {
+			user, err = a.Authenticate(ctx, token)
+		}
+		if err != nil {
+			debug.Printf("AuthHandler: %v = a.Authenticate(ctx, token)", err)
+			switch {
+			case errors.Is(err, dberrors.ErrPermission),
+				errors.Is(err, jwt.ErrInvalid),
+				errors.Is(err, jwt.ErrExpired),
+				errors.Is(err, jwt.ErrKey):
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				unauthorizedHandler.ServeHTTP(w, r)
+			default:
+				Error(w, r, err)
+			}
+			return
+		}
+
+		span := trace.SpanFromContext(ctx)
+		span.SetAttributes(attribute.String("enduser.id", user.String()))
+		ctx = fs.WithUser(ctx, user)
+		if c != nil {
+			span.SetAttributes(attribute.StringSlice("enduser.scope", c.ops))
+			ctx = context.WithValue(ctx, capabilityKey, c)
+			for _, p := range c.paths {
+				ctx = fs.WithScope(ctx, p)
+			}
+		}
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// public reports whether r is for a route that anyone can use, as the links
+// authorize themselves.
+func public(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		return r.URL.Path == "/ready" || strings.HasPrefix(r.URL.Path, "/s/")
+	case http.MethodPost:
+		return strings.HasPrefix(r.URL.Path, "/u/")
+	}
+	return false
+}
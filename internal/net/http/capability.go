@@ -0,0 +1,305 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.adoublef/eyeoh/internal/fs"
+)
+
+// Operations a capability can be restricted to.
+const (
+	OpRead   = "read"   // read content, metadata and listings
+	OpUpload = "upload" // upload or replace the content of files
+	OpWrite  = "write"  // create directories, rename, move, copy, restore and revert
+	OpDelete = "delete" // remove entries
+	OpAdmin  = "admin"  // manage users, groups, access, quotas and tokens
+)
+
+var ops = []string{OpRead, OpUpload, OpWrite, OpDelete, OpAdmin}
+
+// opToken manages api keys, capabilities, share links and upload links. No
+// capability allows it, else it could mint a token without its caveats.
+const opToken = "token"
+
+// operation returns the operation of the route pattern, which has a method.
+func operation(pattern string) string {
+	method, path, _ := strings.Cut(pattern, " ")
+	switch {
+	case strings.HasPrefix(path, "/users"),
+		strings.HasPrefix(path, "/groups"),
+		strings.HasPrefix(path, "/acl/"),
+		strings.HasPrefix(path, "/quota"):
+		return OpAdmin
+	case strings.HasPrefix(path, "/keys"),
+		strings.HasPrefix(path, "/capabilities"),
+		strings.HasPrefix(path, "/shares"),
+		strings.HasPrefix(path, "/uploads"):
+		return opToken
+	case strings.HasPrefix(path, "/tus/"),
+		path == "/touch/files",
+		path == "/dedup/files",
+		method == http.MethodPut && path == "/files/{file}":
+		return OpUpload
+	case path == "/rm/files":
+		return OpDelete
+	case method == http.MethodGet || method == http.MethodHead:
+		return OpRead
+	}
+	return OpWrite
+}
+
+// Caveats restrict a capability token. The zero value of each field does not
+// restrict it.
+type Caveats struct {
+	// Path is the entry, and those below it, that can be accessed.
+	Path string `json:"path,omitempty"`
+	// Ops are the operations that can be done.
+	Ops []string `json:"ops,omitempty"`
+	// MaxSize is the most bytes a request can upload.
+	MaxSize int64 `json:"maxSize,omitempty"`
+	// Expires is when the token can no longer be used.
+	Expires *time.Time `json:"expires,omitempty"`
+	// IP is the address, or range of addresses, of the clients that can use the token.
+	IP string `json:"ip,omitempty"`
+}
+
+// Strings returns the caveats, in the form that is added to a token.
+func (c Caveats) Strings() ([]string, error) {
+	var cc []string
+	if c.Path != "" {
+		p, err := fs.ParsePath(c.Path)
+		if err != nil {
+			return nil, err
+		}
+		cc = append(cc, "path = "+p.String())
+	}
+	if len(c.Ops) > 0 {
+		for _, op := range c.Ops {
+			if !slices.Contains(ops, op) {
+				return nil, fmt.Errorf("invalid operation: %q", op)
+			}
+		}
+		cc = append(cc, "ops = "+strings.Join(c.Ops, ","))
+	}
+	if c.MaxSize < 0 {
+		return nil, fmt.Errorf("max size must not be negative")
+	} else if c.MaxSize > 0 {
+		cc = append(cc, "max_size = "+strconv.FormatInt(c.MaxSize, 10))
+	}
+	if c.Expires != nil {
+		cc = append(cc, "expires = "+c.Expires.UTC().Format(time.RFC3339))
+	}
+	if c.IP != "" {
+		if _, err := parsePrefix(c.IP); err != nil {
+			return nil, err
+		}
+		cc = append(cc, "ip = "+c.IP)
+	}
+	return cc, nil
+}
+
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		return netip.ParsePrefix(s)
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return addr.Prefix(addr.BitLen())
+}
+
+// capability is what a verified capability token allows.
+type capability struct {
+	paths []fs.Path
+	// ops is nil if every operation is allowed.
+	ops     []string
+	maxSize int64
+}
+
+var capabilityKey = &contextKey{"capability"}
+
+// check returns a function that accepts a caveat if it holds for r.
+func (c *capability) check(r *http.Request) func(string) error {
+	return func(caveat string) error {
+		key, v, _ := strings.Cut(caveat, "=")
+		key, v = strings.TrimSpace(key), strings.TrimSpace(v)
+		switch key {
+		case "path":
+			p, err := fs.ParsePath(v)
+			if err != nil {
+				return fmt.Errorf("invalid path caveat: %v", err)
+			}
+			c.paths = append(c.paths, p)
+		case "ops":
+			allowed := strings.Split(v, ",")
+			if c.ops == nil {
+				c.ops = allowed
+			} else {
+				c.ops = slices.DeleteFunc(c.ops, func(op string) bool { return !slices.Contains(allowed, op) })
+			}
+		case "max_size":
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid max_size caveat: %q", v)
+			}
+			if c.maxSize == 0 || n < c.maxSize {
+				c.maxSize = n
+			}
+		case "expires":
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return fmt.Errorf("invalid expires caveat: %q", v)
+			}
+			if !time.Now().Before(t) {
+				return fmt.Errorf("capability expired at %s", v)
+			}
+		case "ip":
+			prefix, err := parsePrefix(v)
+			if err != nil {
+				return fmt.Errorf("invalid ip caveat: %q", v)
+			}
+			host, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				host = r.RemoteAddr
+			}
+			addr, err := netip.ParseAddr(host)
+			if err != nil || !prefix.Contains(addr.Unmap()) {
+				return fmt.Errorf("client address is not allowed")
+			}
+		default:
+			return fmt.Errorf("unknown caveat %q", key)
+		}
+		return nil
+	}
+}
+
+// allows reports whether the operation op can be done.
+func (c *capability) allows(op string) bool {
+	return op != opToken && (c.ops == nil || slices.Contains(c.ops, op))
+}
+
+// CapabilityVerifier verifies capability tokens, see [fs.DB.VerifyCapability].
+type CapabilityVerifier interface {
+	VerifyCapability(ctx context.Context, token string, check func(caveat string) error) (uuid.UUID, error)
+}
+
+func (a *Auth) VerifyCapability(ctx context.Context, token string, check func(caveat string) error) (uuid.UUID, error) {
+	return a.FS.VerifyCapability(ctx, token, check)
+}
+
+var payloadTooLargeHandler = &statusHandler{
+	code: http.StatusRequestEntityTooLarge,
+	s:    `request exceeds the max size of the capability`,
+}
+
+// capable returns a [http.Handler] that only serves requests for op that a
+// capability in the request context allows. Uploads are limited to its max size.
+func capable(op string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, ok := value[*capability](r.Context(), capabilityKey)
+		if !ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if !c.allows(op) {
+			Error(w, r, statusHandler{http.StatusForbidden, fmt.Sprintf(`capability does not allow %q`, op)})
+			return
+		}
+		if c.maxSize > 0 && r.Body != nil {
+			if r.ContentLength > c.maxSize {
+				payloadTooLargeHandler.ServeHTTP(w, r)
+				return
+			}
+			if n, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64); err == nil && n > c.maxSize {
+				payloadTooLargeHandler.ServeHTTP(w, r)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, c.maxSize)
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func handleCreateCapability(fsys *fs.FS) http.HandlerFunc {
+	var badTTL = statusHandler{http.StatusBadRequest, `ttl has invalid format`}
+
+	type create struct {
+		Caveats
+		TTL string `json:"ttl"`
+	}
+	type created struct {
+		ID    string `json:"capabilityId"`
+		Token string `json:"token"`
+	}
+	parse := func(w http.ResponseWriter, r *http.Request) ([]string, error) {
+		c, err := Decode[create](w, r, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		if c.TTL != "" {
+			ttl, err := time.ParseDuration(c.TTL)
+			if err != nil || ttl <= 0 {
+				return nil, badTTL
+			}
+			t := time.Now().Add(ttl)
+			if c.Expires == nil || t.Before(*c.Expires) {
+				c.Expires = &t
+			}
+		}
+		cc, err := c.Caveats.Strings()
+		if err != nil {
+			return nil, statusHandler{http.StatusBadRequest, err.Error()}
+		}
+		return cc, nil
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "http.create_capability")
+		defer span.End()
+
+		caveats, err := parse(w, r)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		id, token, err := fsys.CreateCapability(ctx, caveats...)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		respond(w, r, created{ID: id.String(), Token: token})
+	}
+}
+
+func handleRevokeCapability(fsys *fs.FS) http.HandlerFunc {
+	var badPathValue = statusHandler{http.StatusBadRequest, `capability id in path has invalid format`}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "http.revoke_capability")
+		defer span.End()
+
+		id, err := uuid.Parse(r.PathValue("capability"))
+		if err != nil {
+			badPathValue.ServeHTTP(w, r)
+			return
+		}
+
+		if err := fsys.RevokeCapability(ctx, id); err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -26,6 +26,16 @@ func Error(w http.ResponseWriter, r *http.Request, err error) {
 		sh.code = http.StatusNotFound
 	case errors.Is(err, dberrors.ErrExist):
 		sh.code = http.StatusConflict
+	case errors.Is(err, dberrors.ErrInvalid):
+		sh.code = http.StatusBadRequest
+	case errors.Is(err, dberrors.ErrStale):
+		sh.code = http.StatusPreconditionFailed
+	case errors.Is(err, dberrors.ErrPermission):
+		sh.code = http.StatusForbidden
+	case errors.Is(err, dberrors.ErrQuota):
+		sh.code = http.StatusInsufficientStorage
+	case errors.As(err, new(*http.MaxBytesError)):
+		sh.code = http.StatusRequestEntityTooLarge
 	}
 	sh.ServeHTTP(w, r)
 }
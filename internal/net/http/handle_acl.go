@@ -0,0 +1,191 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"go.adoublef/eyeoh/internal/fs"
+)
+
+func handleCreateUser(fsys *fs.FS) http.HandlerFunc {
+	type create struct {
+		Name  fs.Name `json:"name"`
+		Admin bool    `json:"admin"`
+	}
+	type user struct {
+		ID string `json:"userId"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "http.create_user")
+		defer span.End()
+
+		c, err := Decode[create](w, r, 0, 0)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		id, err := fsys.CreateUser(ctx, c.Name, c.Admin)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		respond(w, r, user{ID: id.String()})
+	}
+}
+
+func handleCreateGroup(fsys *fs.FS) http.HandlerFunc {
+	type create struct {
+		Name fs.Name `json:"name"`
+	}
+	type group struct {
+		ID string `json:"groupId"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "http.create_group")
+		defer span.End()
+
+		c, err := Decode[create](w, r, 0, 0)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		id, err := fsys.CreateGroup(ctx, c.Name)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		respond(w, r, group{ID: id.String()})
+	}
+}
+
+func handleGroupMember(fsys *fs.FS, add bool) http.HandlerFunc {
+	var badPathValue = statusHandler{http.StatusBadRequest, `group or user id in path has invalid format`}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "http.group_member")
+		defer span.End()
+
+		grp, err := uuid.Parse(r.PathValue("group"))
+		if err != nil {
+			badPathValue.ServeHTTP(w, r)
+			return
+		}
+		user, err := uuid.Parse(r.PathValue("user"))
+		if err != nil {
+			badPathValue.ServeHTTP(w, r)
+			return
+		}
+
+		if add {
+			err = fsys.AddMember(ctx, grp, user)
+		} else {
+			err = fsys.RemoveMember(ctx, grp, user)
+		}
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func handleFileACL(fsys *fs.FS) http.HandlerFunc {
+	var badPathValue = statusHandler{http.StatusBadRequest, `file id in path has invalid format`}
+
+	type acl struct {
+		Entries []fs.ACLEntry `json:"entries"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "http.file_acl")
+		defer span.End()
+
+		file, err := uuid.Parse(r.PathValue("file"))
+		if err != nil {
+			badPathValue.ServeHTTP(w, r)
+			return
+		}
+
+		entries, err := fsys.ACL(ctx, file)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		a := acl{Entries: entries}
+		if a.Entries == nil {
+			a.Entries = []fs.ACLEntry{}
+		}
+		respond(w, r, a)
+	}
+}
+
+func handleSetFileACL(fsys *fs.FS) http.HandlerFunc {
+	var badPathValue = statusHandler{http.StatusBadRequest, `file id in path has invalid format`}
+	var badEntries = statusHandler{http.StatusBadRequest, `entries must not be empty`}
+
+	type acl struct {
+		Entries []fs.ACLEntry `json:"entries"`
+	}
+	parse := func(w http.ResponseWriter, r *http.Request) (uuid.UUID, []fs.ACLEntry, error) {
+		file, err := uuid.Parse(r.PathValue("file"))
+		if err != nil {
+			return uuid.Nil, nil, badPathValue
+		}
+		a, err := Decode[acl](w, r, 0, 0)
+		if err != nil {
+			return uuid.Nil, nil, err
+		}
+		if len(a.Entries) == 0 {
+			return uuid.Nil, nil, badEntries
+		}
+		return file, a.Entries, nil
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "http.set_file_acl")
+		defer span.End()
+
+		file, entries, err := parse(w, r)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		if err := fsys.SetACL(ctx, file, entries...); err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func handleRemoveFileACL(fsys *fs.FS) http.HandlerFunc {
+	var badPathValue = statusHandler{http.StatusBadRequest, `file or principal id in path has invalid format`}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "http.remove_file_acl")
+		defer span.End()
+
+		file, err := uuid.Parse(r.PathValue("file"))
+		if err != nil {
+			badPathValue.ServeHTTP(w, r)
+			return
+		}
+		principal, err := uuid.Parse(r.PathValue("principal"))
+		if err != nil {
+			badPathValue.ServeHTTP(w, r)
+			return
+		}
+
+		if err := fsys.RemoveACL(ctx, file, principal); err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
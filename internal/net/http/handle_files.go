@@ -2,10 +2,13 @@ package http
 
 import (
 	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/google/uuid"
 	"go.adoublef/eyeoh/internal/fs"
@@ -66,65 +69,221 @@ func handleFileUpload(fsys *fs.FS) http.HandlerFunc {
 	}
 }
 
+func handleFileCreateByHash(fsys *fs.FS) http.HandlerFunc {
+	var badHash = statusHandler{http.StatusBadRequest, `sha256 must be a hex encoded digest`}
+	var badSize = statusHandler{http.StatusBadRequest, `size must not be negative`}
+
+	type create struct {
+		Root uuid.UUID `json:"parentId"`
+		Name fs.Name   `json:"filename"`
+		SHA  string    `json:"sha256"`
+		Size int64     `json:"size"`
+	}
+	parse := func(w http.ResponseWriter, r *http.Request) (create, []byte, error) {
+		c, err := Decode[create](w, r, 0, 0)
+		if err != nil {
+			return c, nil, err
+		}
+		sha, err := hex.DecodeString(c.SHA)
+		if err != nil || len(sha) != sha256.Size {
+			return c, nil, badHash
+		}
+		if c.Size < 0 {
+			return c, nil, badSize
+		}
+		return c, sha, nil
+	}
+
+	type upload struct {
+		ID string `json:"fileId"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "http.file_create_by_hash")
+		defer span.End()
+
+		c, sha, err := parse(w, r)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		// a missing digest is not found, so the client knows to upload the content
+		file, err := fsys.CreateByHash(ctx, c.Name, c.Root, c.Size, sha)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		respond(w, r, upload{ID: file.String()})
+	}
+}
+
 func handleFileDownload(fsys *fs.FS) http.HandlerFunc {
 	var badPathValue = statusHandler{http.StatusBadRequest, `file id in path has invalid format`}
 	var forbiddenFile = statusHandler{http.StatusForbidden, "file is a directory"}
+	var badVersion = statusHandler{http.StatusBadRequest, `version must be a non-negative integer`}
+	var badDisposition = statusHandler{http.StatusBadRequest, `disposition must be inline or attachment`}
+
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx, span := tracer.Start(r.Context(), "http.file_download")
 		defer span.End()
 
-		// query for attachment (default) or inline
-		// "type;filename=somefile.ext"
-
 		file, err := uuid.Parse(r.PathValue("file"))
 		if err != nil {
 			badPathValue.ServeHTTP(w, r)
 			return
 		}
+		// files are downloaded unless they are asked to be shown
+		disposition := cmp.Or(r.URL.Query().Get("disposition"), "attachment")
+		if disposition != "attachment" && disposition != "inline" {
+			badDisposition.ServeHTTP(w, r)
+			return
+		}
+
+		var (
+			f    *fs.File
+			mime string
+			etag fs.Etag
+		)
+		// the latest version is downloaded if not set
+		if s := r.URL.Query().Get("version"); s != "" {
+			v, err := strconv.ParseUint(s, 10, 64)
+			if err != nil {
+				badVersion.ServeHTTP(w, r)
+				return
+			}
+			f, mime, etag, err = fsys.OpenVersion(ctx, file, v)
+			if err != nil {
+				Error(w, r, err)
+				return
+			}
+		} else {
+			f, mime, etag, err = fsys.Open(ctx, file)
+			if err != nil {
+				Error(w, r, err)
+				return
+			}
+		}
+		defer f.Close()
+		if f.Info.IsDir {
+			forbiddenFile.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("ETag", strconv.Quote(etag.String()))
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Header().Set("Content-Type", mime)
+		// the content is of users, so it is never sniffed into another type and,
+		// if it is rendered inline, it cannot run scripts or load anything
+		w.Header().Set("Content-Disposition", contentDisposition(disposition, f.Info.Name.String()))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Content-Security-Policy", "sandbox; default-src 'none'; img-src 'self'; media-src 'self'; style-src 'unsafe-inline'")
+		// only the blocks of the content that are sent are downloaded
+		http.ServeContent(w, r, f.Info.Name.String(), f.Info.ModTime, f)
+	}
+}
+
+// contentDisposition returns a Content-Disposition header of typ for a file
+// named name. Names that are not plain ASCII are also given with the UTF-8
+// encoding of RFC 5987, after a fallback for older clients.
+func contentDisposition(typ, name string) string {
+	ascii := strings.Map(func(r rune) rune {
+		if r < ' ' || r > '~' || r == '"' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, name)
+	s := typ + `; filename="` + ascii + `"`
+	if ascii != name {
+		var sb strings.Builder
+		for _, b := range []byte(name) {
+			// attr-char, see RFC 5987 section 3.2.1
+			if 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9' || strings.IndexByte("!#$&+-.^_`|~", b) >= 0 {
+				sb.WriteByte(b)
+			} else {
+				fmt.Fprintf(&sb, "%%%02X", b)
+			}
+		}
+		s += `; filename*=UTF-8''` + sb.String()
+	}
+	return s
+}
+
+func handleFileReplace(fsys *fs.FS) http.HandlerFunc {
+	var badPathValue = statusHandler{http.StatusBadRequest, `file id in path has invalid format`}
+	var badRevision = statusHandler{http.StatusBadRequest, `revision must be a non-negative integer`}
+	var preconditionRequired = statusHandler{http.StatusPreconditionRequired, `an If-Match or If-Unmodified-Since header or revision is required`}
+
+	// parse returns the version the client expects the file to be at
+	parse := func(r *http.Request) (uuid.UUID, uint64, error) {
+		file, err := uuid.Parse(r.PathValue("file"))
+		if err != nil {
+			return uuid.Nil, 0, badPathValue
+		}
+		if s := r.URL.Query().Get("revision"); s != "" {
+			v, err := strconv.ParseUint(s, 10, 64)
+			if err != nil {
+				return uuid.Nil, 0, badRevision
+			}
+			return file, v, nil
+		}
+		// the preconditions are checked against the latest version
+		v, ok, err := revisionOf(fsys, r, file)
+		if err != nil {
+			return uuid.Nil, 0, err
+		}
+		if !ok {
+			return uuid.Nil, 0, preconditionRequired
+		}
+		return file, v, nil
+	}
+
+	type replace struct {
+		ID       string `json:"fileId"`
+		Revision uint64 `json:"revision"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "http.file_replace")
+		defer span.End()
 
-		f, mime, etag, err := fsys.Open(ctx, file)
+		file, v, err := parse(r)
 		if err != nil {
 			Error(w, r, err)
 			return
 		}
-		defer f.Close() // be sure this wont panic for directories
-		if f.Info.IsDir {
-			forbiddenFile.ServeHTTP(w, r)
+
+		v, etag, err := fsys.Replace(ctx, file, r.Body, v)
+		if err != nil {
+			Error(w, r, err)
 			return
 		}
-		debug.Printf(`rc, %q, %v := fsys.Download(ctx, %q)`, err, mime, file)
-		// if len(etag) > 0 { // directory won't have an etag
+
 		w.Header().Set("ETag", strconv.Quote(etag.String()))
-		// }
-		// return this to the user as attatchment or inline?
-		// serveContent Headers
-		// 1. last-modified
-		// 1. pre-conditions
-		// 1. content-type
-		// 1. content-range (ordered?)
-		// 1. accept-ranges
-		// 1. content-encoding
-		// 1. content-length - w.Header().Set("Content-Length", strconv.FormatInt(sendSize, 10))
-		// check "HEAD"
-		// io.CopyN(w, sendContent, sendSize)
-		// if I serve a range should omit 'disposition'
-		// see: https://stackoverflow.com/a/1401619/4239443
-		// normal encoding: Content-Disposition: attachment; filename="filename.jpg"
-		// special encoding (RFC 5987): Content-Disposition: attachment; filename*="filename.jpg"
-		if r.Method != http.MethodHead {
-			io.CopyN(w, f, f.Info.Size)
+		c := replace{
+			ID:       file.String(),
+			Revision: v,
 		}
+		respond(w, r, c)
 	}
 }
 
 func handleCreateFolder(fsys *fs.FS) http.HandlerFunc {
+	var badPath = statusHandler{http.StatusBadRequest, `name must not be a path unless parents is set`}
+
 	type create struct {
 		Root uuid.UUID `json:"parentId"`
-		Name fs.Name   `json:"name"`
+		Name fs.Path   `json:"name"`
+		// Parents creates any missing directories in the path, like mkdir -p.
+		Parents bool `json:"parents"`
 	}
-	parse := func(w http.ResponseWriter, r *http.Request) (uuid.UUID, fs.Name, error) {
+	parse := func(w http.ResponseWriter, r *http.Request) (create, error) {
 		c, err := Decode[create](w, r, 0, 0)
-		return c.Root, c.Name, err
+		if err != nil {
+			return c, err
+		}
+		if len(c.Name) != 1 && !c.Parents {
+			return c, badPath
+		}
+		return c, nil
 	}
 
 	type folder struct {
@@ -134,13 +293,18 @@ func handleCreateFolder(fsys *fs.FS) http.HandlerFunc {
 		ctx, span := tracer.Start(r.Context(), "http.create_folder")
 		defer span.End()
 
-		root, name, err := parse(w, r)
+		c, err := parse(w, r)
 		if err != nil {
 			Error(w, r, err)
 			return
 		}
 
-		file, err := fsys.Mkdir(ctx, name, root)
+		var file uuid.UUID
+		if c.Parents {
+			file, err = fsys.MkdirAll(ctx, c.Name, c.Root)
+		} else {
+			file, err = fsys.Mkdir(ctx, c.Name[0], c.Root)
+		}
 		if err != nil {
 			Error(w, r, err)
 			return
@@ -153,6 +317,66 @@ func handleCreateFolder(fsys *fs.FS) http.HandlerFunc {
 	}
 }
 
+func handleFileTree(fsys *fs.FS) http.HandlerFunc {
+	var badPathValue = statusHandler{http.StatusBadRequest, `file id in path has invalid format`}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "http.file_tree")
+		defer span.End()
+
+		// [uuid.Nil] walks the whole tree
+		dir, err := uuid.Parse(r.PathValue("file"))
+		if err != nil {
+			badPathValue.ServeHTTP(w, r)
+			return
+		}
+
+		// each entry is written as it is read, so the status is sent with the first
+		enc, wrote := json.NewEncoder(w), false
+		err = fsys.WalkDir(ctx, dir, func(_ string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !wrote {
+				w.Header().Set("Content-Type", ContentTypNDJSON)
+				w.WriteHeader(http.StatusOK)
+				wrote = true
+			}
+			// only the descendants are listed
+			if d.ID == dir {
+				return nil
+			}
+			return enc.Encode(d)
+		})
+		debug.Printf(`%v := fsys.WalkDir(ctx, %q, fn)`, err, dir)
+		switch {
+		case err == nil:
+		case !wrote:
+			Error(w, r, err)
+		default:
+			// the status is sent, so the connection is reset for the client to
+			// see that the tree is incomplete
+			panic(http.ErrAbortHandler)
+		}
+	}
+}
+
+// handleByPath resolves the path of the request to the id of a file, so that h
+// serves a route addressed by path in the same way as one addressed by id.
+func handleByPath(fsys *fs.FS, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "http.lookup")
+		de, err := fsys.Lookup(ctx, r.PathValue("path"))
+		span.End()
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		r.SetPathValue("file", de.ID.String())
+		h.ServeHTTP(w, r)
+	}
+}
+
 func handleFileInfo(fsys *fs.FS) http.HandlerFunc {
 	var badPathValue = statusHandler{
 		code: http.StatusBadRequest,
@@ -163,6 +387,8 @@ func handleFileInfo(fsys *fs.FS) http.HandlerFunc {
 		fs.FileInfo        // inline
 		Version     uint64 `json:"version"`
 		ETag        string `json:"etag,omitempty"`
+		// Usage is set for directories.
+		Usage *fs.Usage `json:"usage,omitempty"`
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx, span := tracer.Start(r.Context(), "http.file_info")
@@ -178,20 +404,62 @@ func handleFileInfo(fsys *fs.FS) http.HandlerFunc {
 			Error(w, r, err)
 			return
 		}
+		// the usage of a directory changes with the entries below it, so only
+		// the metadata of a file can be cached
+		if !info.IsDir {
+			setValidators(w, revisionTag(file, v), info.ModTime)
+			if code := checkPreconditions(r, entityTags(file, v, etag), info.ModTime); code != 0 {
+				writePrecondition(w, r, code)
+				return
+			}
+		}
 
 		st := stat{
 			FileInfo: info,
 			Version:  v,
 			ETag:     etag.String(),
 		}
+		if info.IsDir {
+			u, err := fsys.Usage(ctx, file)
+			if err != nil {
+				Error(w, r, err)
+				return
+			}
+			st.Usage = &u
+		}
 		respond(w, r, st)
 	}
 }
 
+func handleDiskUsage(fsys *fs.FS) http.HandlerFunc {
+	var badPathValue = statusHandler{http.StatusBadRequest, `file id in path has invalid format`}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "http.disk_usage")
+		defer span.End()
+
+		// [uuid.Nil] is the usage of the whole tree
+		file, err := uuid.Parse(r.PathValue("file"))
+		if err != nil {
+			badPathValue.ServeHTTP(w, r)
+			return
+		}
+
+		u, err := fsys.Usage(ctx, file)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		respond(w, r, u)
+	}
+}
+
 func handleFileRename(fsys *fs.FS) http.HandlerFunc {
 	type rename struct {
-		Name    fs.Name `json:"name"`
-		Version uint64  `json:"revision"`
+		Name fs.Name `json:"name"`
+		// Version is the revision of the file, else the preconditions of the
+		// request are checked against it.
+		Version *uint64 `json:"revision"`
 	}
 	parse := func(w http.ResponseWriter, r *http.Request) (uuid.UUID, uint64, fs.Name, error) {
 		// get path name
@@ -200,7 +468,14 @@ func handleFileRename(fsys *fs.FS) http.HandlerFunc {
 			return uuid.Nil, 0, "", err
 		} // proper status error
 		c, err := Decode[rename](w, r, 0, 0)
-		return file, c.Version, c.Name, err
+		if err != nil {
+			return file, 0, c.Name, err
+		}
+		if c.Version != nil {
+			return file, *c.Version, c.Name, nil
+		}
+		v, _, err := revisionOf(fsys, r, file)
+		return file, v, c.Name, err
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -223,3 +498,531 @@ func handleFileRename(fsys *fs.FS) http.HandlerFunc {
 		w.WriteHeader(http.StatusNoContent)
 	}
 }
+
+func handleReadDir(fsys *fs.FS) http.HandlerFunc {
+	var badPathValue = statusHandler{http.StatusBadRequest, `file id in path has invalid format`}
+	var badQuery = func(format string, v ...any) statusHandler {
+		return statusHandler{http.StatusBadRequest, fmt.Sprintf(format, v...)}
+	}
+
+	type listing struct {
+		Entries []fs.DirEntry `json:"entries"`
+		Cursor  *fs.Cursor    `json:"cursor,omitempty"`
+	}
+	parse := func(r *http.Request) (c fs.Cursor, limit int, err error) {
+		q := r.URL.Query()
+		if s := q.Get("limit"); s != "" {
+			limit, err = strconv.Atoi(s)
+			if err != nil || limit < 1 || limit > fs.MaxReadDirLimit {
+				return c, 0, badQuery("limit must be between 1 and %d", fs.MaxReadDirLimit)
+			}
+		}
+		// the cursor carries the sort order of the previous page
+		if s := q.Get("cursor"); s != "" {
+			c, err = fs.ParseCursor(s)
+			if err != nil {
+				return c, 0, badQuery("%v", err)
+			}
+			return c, limit, nil
+		}
+		if s := q.Get("sort"); s != "" {
+			c.Sort, err = fs.ParseSort(s)
+			if err != nil {
+				return c, 0, badQuery("%v", err)
+			}
+		}
+		switch q.Get("order") {
+		case "", "asc":
+		case "desc":
+			c.Desc = true
+		default:
+			return c, 0, badQuery("order must be asc or desc")
+		}
+		return c, limit, nil
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "http.read_dir")
+		defer span.End()
+
+		// [uuid.Nil] lists the top-level entries
+		dir, err := uuid.Parse(r.PathValue("file"))
+		if err != nil {
+			badPathValue.ServeHTTP(w, r)
+			return
+		}
+		c, limit, err := parse(r)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		entries, next, err := fsys.ReadDir(ctx, dir, c, limit)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		l := listing{Entries: entries}
+		if l.Entries == nil {
+			l.Entries = []fs.DirEntry{}
+		}
+		if !next.IsZero() {
+			l.Cursor = &next
+		}
+		respond(w, r, l)
+	}
+}
+
+func handleFileMove(fsys *fs.FS) http.HandlerFunc {
+	var noFiles = statusHandler{http.StatusBadRequest, `at least one file is required`}
+
+	type entry struct {
+		ID      uuid.UUID `json:"fileId"`
+		Version uint64    `json:"revision"`
+		Name    fs.Name   `json:"name"` // optional
+	}
+	type move struct {
+		Root  uuid.UUID `json:"parentId"`
+		Files []entry   `json:"files"`
+	}
+	parse := func(w http.ResponseWriter, r *http.Request) (uuid.UUID, []fs.MoveEntry, error) {
+		c, err := Decode[move](w, r, 0, 0)
+		if err != nil {
+			return uuid.Nil, nil, err
+		}
+		if len(c.Files) == 0 {
+			return uuid.Nil, nil, noFiles
+		}
+		entries := make([]fs.MoveEntry, len(c.Files))
+		for i, f := range c.Files {
+			entries[i] = fs.MoveEntry{ID: f.ID, V: f.Version, Name: f.Name}
+		}
+		return c.Root, entries, nil
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "http.file_move")
+		defer span.End()
+
+		root, entries, err := parse(w, r)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		err = fsys.Move(ctx, root, entries...)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func handleFileCopy(fsys *fs.FS) http.HandlerFunc {
+	var noFiles = statusHandler{http.StatusBadRequest, `at least one file is required`}
+
+	type entry struct {
+		ID   uuid.UUID `json:"fileId"`
+		Name fs.Name   `json:"name"` // optional
+	}
+	type cp struct {
+		Root     uuid.UUID   `json:"parentId"`
+		Files    []entry     `json:"files"`
+		Conflict fs.Conflict `json:"conflict"` // defaults to fail
+	}
+	parse := func(w http.ResponseWriter, r *http.Request) (uuid.UUID, fs.Conflict, []fs.CopyEntry, error) {
+		c, err := Decode[cp](w, r, 0, 0)
+		if err != nil {
+			return uuid.Nil, 0, nil, err
+		}
+		if len(c.Files) == 0 {
+			return uuid.Nil, 0, nil, noFiles
+		}
+		entries := make([]fs.CopyEntry, len(c.Files))
+		for i, f := range c.Files {
+			entries[i] = fs.CopyEntry{ID: f.ID, Name: f.Name}
+		}
+		return c.Root, c.Conflict, entries, nil
+	}
+
+	type file struct {
+		ID string `json:"fileId"`
+	}
+	type copied struct {
+		Files []file `json:"files"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "http.file_copy")
+		defer span.End()
+
+		root, conflict, entries, err := parse(w, r)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		files, err := fsys.Copy(ctx, root, conflict, entries...)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		c := copied{Files: make([]file, len(files))}
+		for i, f := range files {
+			c.Files[i] = file{ID: f.String()}
+		}
+		respond(w, r, c)
+	}
+}
+
+func handleFileRemove(fsys *fs.FS) http.HandlerFunc {
+	var noFiles = statusHandler{http.StatusBadRequest, `at least one file is required`}
+
+	type entry struct {
+		ID      uuid.UUID `json:"fileId"`
+		Version uint64    `json:"revision"`
+	}
+	type remove struct {
+		Files []entry `json:"files"`
+	}
+	parse := func(w http.ResponseWriter, r *http.Request) ([]fs.RmEntry, error) {
+		c, err := Decode[remove](w, r, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		if len(c.Files) == 0 {
+			return nil, noFiles
+		}
+		entries := make([]fs.RmEntry, len(c.Files))
+		for i, f := range c.Files {
+			entries[i] = fs.RmEntry{ID: f.ID, V: f.Version}
+		}
+		return entries, nil
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "http.file_remove")
+		defer span.End()
+
+		entries, err := parse(w, r)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		err = fsys.Rm(ctx, entries...)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func handleTrash(fsys *fs.FS) http.HandlerFunc {
+	var badTree = statusHandler{http.StatusBadRequest, `tree id has invalid format`}
+	var badLimit = statusHandler{http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", fs.MaxReadDirLimit)}
+
+	type trash struct {
+		Entries []fs.TrashEntry `json:"entries"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "http.trash")
+		defer span.End()
+
+		// the trash of every tree is returned if not set
+		tree, err := uuid.Parse(cmp.Or(r.URL.Query().Get("tree"), uuid.Nil.String()))
+		if err != nil {
+			badTree.ServeHTTP(w, r)
+			return
+		}
+		var limit int
+		if s := r.URL.Query().Get("limit"); s != "" {
+			limit, err = strconv.Atoi(s)
+			if err != nil || limit < 1 || limit > fs.MaxReadDirLimit {
+				badLimit.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		entries, err := fsys.Trash(ctx, tree, limit)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		t := trash{Entries: entries}
+		if t.Entries == nil {
+			t.Entries = []fs.TrashEntry{}
+		}
+		respond(w, r, t)
+	}
+}
+
+func handleFileRestore(fsys *fs.FS) http.HandlerFunc {
+	var badPathValue = statusHandler{http.StatusBadRequest, `file id in path has invalid format`}
+	var badConflict = statusHandler{http.StatusBadRequest, `conflict must be fail or rename`}
+
+	type restore struct {
+		ID   string  `json:"fileId"`
+		Name fs.Name `json:"filename"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "http.file_restore")
+		defer span.End()
+
+		file, err := uuid.Parse(r.PathValue("file"))
+		if err != nil {
+			badPathValue.ServeHTTP(w, r)
+			return
+		}
+		conflict, err := fs.ParseConflict(cmp.Or(r.URL.Query().Get("conflict"), fs.ConflictFail.String()))
+		if err != nil || conflict == fs.ConflictReplace {
+			badConflict.ServeHTTP(w, r)
+			return
+		}
+
+		name, err := fsys.Restore(ctx, file, conflict)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		c := restore{
+			ID:   file.String(),
+			Name: name,
+		}
+		respond(w, r, c)
+	}
+}
+
+func handleFileVersions(fsys *fs.FS) http.HandlerFunc {
+	var badPathValue = statusHandler{http.StatusBadRequest, `file id in path has invalid format`}
+
+	type versions struct {
+		Versions []fs.Version `json:"versions"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "http.file_versions")
+		defer span.End()
+
+		file, err := uuid.Parse(r.PathValue("file"))
+		if err != nil {
+			badPathValue.ServeHTTP(w, r)
+			return
+		}
+
+		vs, err := fsys.Versions(ctx, file)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		respond(w, r, versions{Versions: vs})
+	}
+}
+
+func handleFileRevert(fsys *fs.FS) http.HandlerFunc {
+	var badPathValue = statusHandler{http.StatusBadRequest, `file id in path has invalid format`}
+
+	type revert struct {
+		Version uint64 `json:"version"`
+		// Revision is the revision of the file, else the preconditions of the
+		// request are checked against it.
+		Revision *uint64 `json:"revision"`
+	}
+	parse := func(w http.ResponseWriter, r *http.Request) (uuid.UUID, uint64, uint64, error) {
+		file, err := uuid.Parse(r.PathValue("file"))
+		if err != nil {
+			return uuid.Nil, 0, 0, badPathValue
+		}
+		c, err := Decode[revert](w, r, 0, 0)
+		if err != nil {
+			return uuid.Nil, 0, 0, err
+		}
+		if c.Revision != nil {
+			return file, c.Version, *c.Revision, nil
+		}
+		v, _, err := revisionOf(fsys, r, file)
+		return file, c.Version, v, err
+	}
+
+	type reverted struct {
+		ID       string `json:"fileId"`
+		Revision uint64 `json:"revision"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "http.file_revert")
+		defer span.End()
+
+		file, version, v, err := parse(w, r)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		v, err = fsys.Revert(ctx, file, version, v)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		respond(w, r, reverted{ID: file.String(), Revision: v})
+	}
+}
+
+func handleSetMaxVersions(fsys *fs.FS) http.HandlerFunc {
+	var badPathValue = statusHandler{http.StatusBadRequest, `file id in path has invalid format`}
+	var badMaxVersions = statusHandler{http.StatusBadRequest, `max versions must not be negative`}
+
+	type limit struct {
+		MaxVersions int `json:"maxVersions"`
+	}
+	parse := func(w http.ResponseWriter, r *http.Request) (uuid.UUID, int, error) {
+		file, err := uuid.Parse(r.PathValue("file"))
+		if err != nil {
+			return uuid.Nil, 0, badPathValue
+		}
+		c, err := Decode[limit](w, r, 0, 0)
+		if err != nil {
+			return uuid.Nil, 0, err
+		}
+		if c.MaxVersions < 0 {
+			return uuid.Nil, 0, badMaxVersions
+		}
+		return file, c.MaxVersions, nil
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "http.set_max_versions")
+		defer span.End()
+
+		file, n, err := parse(w, r)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		err = fsys.SetMaxVersions(ctx, file, n)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func handleQuotas(fsys *fs.FS) http.HandlerFunc {
+	type quotas struct {
+		Quotas []fs.QuotaInfo `json:"quotas"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "http.quotas")
+		defer span.End()
+
+		list, err := fsys.Quotas(ctx)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		q := quotas{Quotas: list}
+		if q.Quotas == nil {
+			q.Quotas = []fs.QuotaInfo{}
+		}
+		respond(w, r, q)
+	}
+}
+
+func handleQuota(fsys *fs.FS) http.HandlerFunc {
+	var badPathValue = statusHandler{http.StatusBadRequest, `file id in path has invalid format`}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "http.quota")
+		defer span.End()
+
+		file, err := uuid.Parse(r.PathValue("file"))
+		if err != nil {
+			badPathValue.ServeHTTP(w, r)
+			return
+		}
+
+		q, err := fsys.Quota(ctx, file)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		respond(w, r, q)
+	}
+}
+
+func handleSetQuota(fsys *fs.FS) http.HandlerFunc {
+	var badPathValue = statusHandler{http.StatusBadRequest, `file id in path has invalid format`}
+	var badLimit = statusHandler{http.StatusBadRequest, `limits must not be negative`}
+
+	parse := func(w http.ResponseWriter, r *http.Request) (uuid.UUID, fs.Quota, error) {
+		file, err := uuid.Parse(r.PathValue("file"))
+		if err != nil {
+			return uuid.Nil, fs.Quota{}, badPathValue
+		}
+		q, err := Decode[fs.Quota](w, r, 0, 0)
+		if err != nil {
+			return uuid.Nil, fs.Quota{}, err
+		}
+		for _, n := range []*int64{q.MaxBytes, q.MaxFiles, q.SoftBytes, q.SoftFiles} {
+			if n != nil && *n < 0 {
+				return uuid.Nil, fs.Quota{}, badLimit
+			}
+		}
+		return file, q, nil
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "http.set_quota")
+		defer span.End()
+
+		file, q, err := parse(w, r)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		if err := fsys.SetQuota(ctx, file, q); err != nil {
+			Error(w, r, err)
+			return
+		}
+		// reply with the usage, which may already be over the new limits
+		qi, err := fsys.Quota(ctx, file)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		respond(w, r, qi)
+	}
+}
+
+func handleRemoveQuota(fsys *fs.FS) http.HandlerFunc {
+	var badPathValue = statusHandler{http.StatusBadRequest, `file id in path has invalid format`}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "http.remove_quota")
+		defer span.End()
+
+		file, err := uuid.Parse(r.PathValue("file"))
+		if err != nil {
+			badPathValue.ServeHTTP(w, r)
+			return
+		}
+
+		if err := fsys.RemoveQuota(ctx, file); err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,151 @@
+package http
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"go.adoublef/eyeoh/internal/fs"
+)
+
+// userOf returns the user named by s, or the user of the request if s is empty.
+func userOf(r *http.Request, s string) (uuid.UUID, bool) {
+	if s == "" {
+		return fs.UserFromContext(r.Context())
+	}
+	user, err := uuid.Parse(s)
+	return user, err == nil
+}
+
+func handleCreateKey(fsys *fs.FS) http.HandlerFunc {
+	var badUser = statusHandler{http.StatusBadRequest, `user id is missing or has invalid format`}
+	var badTTL = statusHandler{http.StatusBadRequest, `ttl has invalid format`}
+
+	type create struct {
+		User string `json:"userId"`
+		Name string `json:"name"`
+		TTL  string `json:"ttl"`
+	}
+	type key struct {
+		Token string `json:"token"`
+		fs.Key
+	}
+	parse := func(w http.ResponseWriter, r *http.Request) (uuid.UUID, string, time.Duration, error) {
+		c, err := Decode[create](w, r, 0, 0)
+		if err != nil {
+			return uuid.Nil, "", 0, err
+		}
+		user, ok := userOf(r, c.User)
+		if !ok {
+			return uuid.Nil, "", 0, badUser
+		}
+		var ttl time.Duration
+		if c.TTL != "" {
+			if ttl, err = time.ParseDuration(c.TTL); err != nil {
+				return uuid.Nil, "", 0, badTTL
+			}
+		}
+		return user, c.Name, ttl, nil
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "http.create_key")
+		defer span.End()
+
+		user, name, ttl, err := parse(w, r)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		token, k, err := fsys.CreateKey(ctx, user, name, ttl)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		respond(w, r, key{Token: token, Key: k})
+	}
+}
+
+func handleKeys(fsys *fs.FS) http.HandlerFunc {
+	var badUser = statusHandler{http.StatusBadRequest, `user id is missing or has invalid format`}
+
+	type keys struct {
+		Keys []fs.Key `json:"keys"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "http.keys")
+		defer span.End()
+
+		user, ok := userOf(r, r.URL.Query().Get("userId"))
+		if !ok {
+			badUser.ServeHTTP(w, r)
+			return
+		}
+
+		kk, err := fsys.Keys(ctx, user)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		k := keys{Keys: kk}
+		if k.Keys == nil {
+			k.Keys = []fs.Key{}
+		}
+		respond(w, r, k)
+	}
+}
+
+func handleRevokeKey(fsys *fs.FS) http.HandlerFunc {
+	var badPathValue = statusHandler{http.StatusBadRequest, `key id in path has invalid format`}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "http.revoke_key")
+		defer span.End()
+
+		id, err := uuid.Parse(r.PathValue("key"))
+		if err != nil {
+			badPathValue.ServeHTTP(w, r)
+			return
+		}
+
+		if err := fsys.RevokeKey(ctx, id); err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func handleLinkIdentity(fsys *fs.FS) http.HandlerFunc {
+	var badPathValue = statusHandler{http.StatusBadRequest, `user id in path has invalid format`}
+
+	type link struct {
+		Issuer  string `json:"issuer"`
+		Subject string `json:"subject"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "http.link_identity")
+		defer span.End()
+
+		user, err := uuid.Parse(r.PathValue("user"))
+		if err != nil {
+			badPathValue.ServeHTTP(w, r)
+			return
+		}
+		l, err := Decode[link](w, r, 0, 0)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		if err := fsys.LinkIdentity(ctx, user, l.Issuer, l.Subject); err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,297 @@
+package http
+
+import (
+	"archive/zip"
+	"errors"
+	gofs "io/fs"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	dberrors "go.adoublef/eyeoh/internal/database/errors"
+	"go.adoublef/eyeoh/internal/fs"
+	"go.adoublef/eyeoh/internal/fs/iofs"
+	"go.adoublef/eyeoh/internal/runtime/debug"
+)
+
+func handleCreateShare(fsys *fs.FS) http.HandlerFunc {
+	var badPathValue = statusHandler{http.StatusBadRequest, `file id in path has invalid format`}
+	var badTTL = statusHandler{http.StatusBadRequest, `ttl must be a positive duration`}
+
+	type create struct {
+		TTL          string `json:"ttl"`
+		Password     string `json:"password"`
+		MaxDownloads int64  `json:"maxDownloads"`
+		// OneTime links can be downloaded once.
+		OneTime bool `json:"oneTime"`
+	}
+	type created struct {
+		fs.Share
+		Token string `json:"token"`
+		URL   string `json:"url"`
+	}
+	parse := func(w http.ResponseWriter, r *http.Request) (uuid.UUID, fs.ShareOptions, error) {
+		file, err := uuid.Parse(r.PathValue("file"))
+		if err != nil {
+			return uuid.Nil, fs.ShareOptions{}, badPathValue
+		}
+		c, err := Decode[create](w, r, 0, 0)
+		if err != nil {
+			return uuid.Nil, fs.ShareOptions{}, err
+		}
+		ttl, err := time.ParseDuration(c.TTL)
+		if err != nil || ttl <= 0 {
+			return uuid.Nil, fs.ShareOptions{}, badTTL
+		}
+		opts := fs.ShareOptions{TTL: ttl, Password: c.Password, MaxDownloads: c.MaxDownloads}
+		if c.OneTime {
+			opts.MaxDownloads = 1
+		}
+		return file, opts, nil
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "http.create_share")
+		defer span.End()
+
+		file, opts, err := parse(w, r)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		s, token, err := fsys.CreateShare(ctx, file, opts)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		respond(w, r, created{Share: s, Token: token, URL: "/s/" + token})
+	}
+}
+
+func handleShares(fsys *fs.FS) http.HandlerFunc {
+	var badPathValue = statusHandler{http.StatusBadRequest, `file id in path has invalid format`}
+
+	type shares struct {
+		Shares []fs.Share `json:"shares"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "http.shares")
+		defer span.End()
+
+		file, err := uuid.Parse(r.PathValue("file"))
+		if err != nil {
+			badPathValue.ServeHTTP(w, r)
+			return
+		}
+
+		ss, err := fsys.Shares(ctx, file)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		s := shares{Shares: ss}
+		if s.Shares == nil {
+			s.Shares = []fs.Share{}
+		}
+		respond(w, r, s)
+	}
+}
+
+func handleRevokeShare(fsys *fs.FS) http.HandlerFunc {
+	var badPathValue = statusHandler{http.StatusBadRequest, `share id in path has invalid format`}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "http.revoke_share")
+		defer span.End()
+
+		id, err := uuid.Parse(r.PathValue("share"))
+		if err != nil {
+			badPathValue.ServeHTTP(w, r)
+			return
+		}
+
+		if err := fsys.RevokeShare(ctx, id); err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleShare serves a share link to anyone who has it. A shared file is
+// downloaded. A shared folder is listed, downloaded as a zip with ?format=zip,
+// and the entries below it are served by their path from the folder. Only
+// downloads count towards the max downloads of a link.
+//
+// The password of a link is sent as the password of basic authentication.
+func handleShare(fsys *fs.FS) http.HandlerFunc {
+	var notFound = statusHandler{code: http.StatusNotFound}
+
+	var badCursor = statusHandler{http.StatusBadRequest, `cursor has invalid format`}
+
+	type listing struct {
+		Entries []fs.DirEntry `json:"entries"`
+		Cursor  *fs.Cursor    `json:"cursor,omitempty"`
+	}
+	// list lists dir with the paths of its entries from the shared entry p, so
+	// that the link does not reveal where the entry is.
+	list := func(w http.ResponseWriter, r *http.Request, dir uuid.UUID, p fs.Path) {
+		c := fs.Cursor{Sort: fs.SortName}
+		if s := r.URL.Query().Get("cursor"); s != "" {
+			var err error
+			if c, err = fs.ParseCursor(s); err != nil {
+				badCursor.ServeHTTP(w, r)
+				return
+			}
+		}
+		entries, next, err := fsys.ReadDir(r.Context(), dir, c, 0)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+		l := listing{Entries: []fs.DirEntry{}}
+		for _, de := range entries {
+			if len(p) > 0 {
+				de.Path = strings.TrimPrefix(de.Path, p.String())
+			}
+			l.Entries = append(l.Entries, de)
+		}
+		if !next.IsZero() {
+			l.Cursor = &next
+		}
+		respond(w, r, l)
+	}
+
+	download := handleFileDownload(fsys)
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "http.share")
+		defer span.End()
+
+		_, password, _ := r.BasicAuth()
+		s, p, err := fsys.OpenShare(ctx, r.PathValue("token"), password)
+		switch {
+		case errors.Is(err, dberrors.ErrPermission) && password == "":
+			w.Header().Set("WWW-Authenticate", `Basic realm="share", charset="UTF-8"`)
+			unauthorizedHandler.ServeHTTP(w, r)
+			return
+		case err != nil:
+			Error(w, r, err)
+			return
+		}
+		// the link is served as the user that created it, only within the shared entry
+		ctx = fs.WithShare(ctx, s)
+
+		de := fs.DirEntry{FileInfo: fs.FileInfo{ID: s.File}}
+		if sub := r.PathValue("path"); sub != "" {
+			if de, err = fsys.Lookup(ctx, p.String()+"/"+sub); err != nil {
+				Error(w, r, err)
+				return
+			}
+		} else {
+			info, _, _, err := fsys.Stat(ctx, s.File)
+			if err != nil {
+				Error(w, r, err)
+				return
+			}
+			de.FileInfo = info
+		}
+		r = r.WithContext(ctx)
+		r.SetPathValue("file", de.ID.String())
+
+		switch {
+		case !de.IsDir:
+			// only a full response is a download, not a HEAD request, a part of
+			// the content or a response that is not modified
+			if r.Method != http.MethodGet {
+				download.ServeHTTP(w, r)
+				return
+			}
+			// the parts of the content add up to a download that is never counted,
+			// so a link that is limited is only downloaded whole
+			if s.MaxDownloads != nil && r.Header.Get("Range") != "" {
+				r = r.Clone(ctx)
+				r.Header.Del("Range")
+			}
+			download.ServeHTTP(&countWriter{w, r, func() error { return fsys.CountShare(ctx, s.ID) }, false, false}, r)
+		case r.URL.Query().Get("format") == "zip":
+			w.Header().Set("Content-Type", "application/zip")
+			w.Header().Set("Content-Disposition", contentDisposition("attachment", de.Name.String()+".zip"))
+			if r.Method != http.MethodGet {
+				return
+			}
+			if err := fsys.CountShare(ctx, s.ID); err != nil {
+				Error(w, r, err)
+				return
+			}
+			name := strings.TrimPrefix(p.String(), "/")
+			if sub := r.PathValue("path"); sub != "" {
+				name += "/" + strings.Trim(sub, "/")
+			}
+			sfs, err := gofs.Sub(iofs.New(ctx, fsys), name)
+			if err != nil {
+				notFound.ServeHTTP(w, r)
+				return
+			}
+			zw := zip.NewWriter(w)
+			// the status is sent, so an error can only end the response early
+			err = zw.AddFS(sfs)
+			debug.Printf(`%v := zw.AddFS(sfs)`, err)
+			if err == nil {
+				zw.Close()
+			}
+		default:
+			// the parent of the shared entry is not shared
+			list(w, r, de.ID, p[:len(p)-1])
+		}
+	}
+}
+
+// countWriter counts a download before a full response, or a part of the content
+// from its start, is sent. A response with any other status, such as one that is
+// not modified, is not counted. If the download cannot be counted, the error is
+// sent instead.
+type countWriter struct {
+	http.ResponseWriter
+	r     *http.Request
+	count func() error
+
+	wroteHeader, failed bool
+}
+
+func (w *countWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	full := code == http.StatusOK ||
+		code == http.StatusPartialContent && strings.HasPrefix(w.Header().Get("Content-Range"), "bytes 0-")
+	if full {
+		if err := w.count(); err != nil {
+			w.failed = true
+			// the headers are of the content that is not sent
+			clear(w.Header())
+			Error(w.ResponseWriter, w.r, err)
+			return
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.failed {
+		return 0, errShareCount
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *countWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// errShareCount is returned when writing content whose download was not counted.
+var errShareCount = errors.New("share download was not counted")
@@ -0,0 +1,266 @@
+package http
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	dberrors "go.adoublef/eyeoh/internal/database/errors"
+	"go.adoublef/eyeoh/internal/fs"
+)
+
+// tus protocol, see https://tus.io/protocols/resumable-upload
+const (
+	tusVersion    = "1.0.0"
+	tusExtension  = "creation,termination,checksum"
+	tusChecksum   = "sha1,sha256"
+	ContentTypTus = "application/offset+octet-stream"
+)
+
+// statusChecksumMismatch is the status code of a chunk that does not match its checksum.
+const statusChecksumMismatch = 460
+
+// Tus checks the client uses the version of the tus protocol that is supported
+// and marks every response with it.
+func Tus(h http.Handler) http.Handler {
+	var preconditionFailed = statusHandler{http.StatusPreconditionFailed, `unsupported version of tus`}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Tus-Resumable", tusVersion)
+		// discovery does not need the header
+		if r.Method != http.MethodOptions && r.Header.Get("Tus-Resumable") != tusVersion {
+			w.Header().Set("Tus-Version", tusVersion)
+			preconditionFailed.ServeHTTP(w, r)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func handleTusOptions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Tus-Version", tusVersion)
+		w.Header().Set("Tus-Extension", tusExtension)
+		w.Header().Set("Tus-Checksum-Algorithm", tusChecksum)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func handleTusCreate(fsys *fs.FS) http.HandlerFunc {
+	var badLength = statusHandler{http.StatusBadRequest, `Upload-Length must be a non-negative integer`}
+	var badMetadata = statusHandler{http.StatusBadRequest, `Upload-Metadata has invalid format`}
+	var badParentID = statusHandler{http.StatusBadRequest, `parent id has invalid format`}
+
+	type create struct {
+		Root uuid.UUID
+		Name fs.Name
+		Size int64
+	}
+	parse := func(w http.ResponseWriter, r *http.Request) (create, error) {
+		var c create
+		sz, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+		if err != nil || sz < 0 {
+			return c, badLength
+		}
+		c.Size = sz
+		md, err := parseMetadata(r.Header.Get("Upload-Metadata"))
+		if err != nil {
+			return c, badMetadata
+		}
+		if c.Name, err = fs.ParseName(md["filename"]); err != nil {
+			return c, err
+		}
+		if s, ok := md["parentId"]; ok {
+			if c.Root, err = uuid.Parse(s); err != nil {
+				return c, badParentID
+			}
+		}
+		return c, nil
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "http.tus_create")
+		defer span.End()
+
+		c, err := parse(w, r)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		id, file, err := fsys.CreateResumable(ctx, c.Name, c.Root, c.Size)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		w.Header().Set("Location", "/tus/files/"+id.String())
+		// an empty upload is complete once created
+		if file != uuid.Nil {
+			w.Header().Set("File-Id", file.String())
+		}
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+func handleTusHead(fsys *fs.FS) http.HandlerFunc {
+	var badPathValue = statusHandler{http.StatusBadRequest, `upload id in path has invalid format`}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "http.tus_head")
+		defer span.End()
+
+		id, err := uuid.Parse(r.PathValue("upload"))
+		if err != nil {
+			badPathValue.ServeHTTP(w, r)
+			return
+		}
+
+		st, err := fsys.Resumable(ctx, id)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		w.Header().Set("Upload-Offset", strconv.FormatInt(st.Offset, 10))
+		w.Header().Set("Upload-Length", strconv.FormatInt(st.Size, 10))
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func handleTusPatch(fsys *fs.FS) http.HandlerFunc {
+	var badPathValue = statusHandler{http.StatusBadRequest, `upload id in path has invalid format`}
+	var unsupportedMediaType = statusHandler{http.StatusUnsupportedMediaType, `request is not ` + ContentTypTus}
+	var badOffset = statusHandler{http.StatusBadRequest, `Upload-Offset must be a non-negative integer`}
+	var badChecksum = statusHandler{http.StatusBadRequest, `Upload-Checksum has invalid format`}
+	var conflict = statusHandler{http.StatusConflict, `Upload-Offset does not match the offset of the upload`}
+	var checksumMismatch = statusHandler{statusChecksumMismatch, `checksum does not match the content`}
+
+	type patch struct {
+		ID     uuid.UUID
+		Offset int64
+		// Hash is set if the client sent a checksum of the content, which is Sum.
+		Hash hash.Hash
+		Sum  []byte
+	}
+	parse := func(w http.ResponseWriter, r *http.Request) (patch, error) {
+		var p patch
+		id, err := uuid.Parse(r.PathValue("upload"))
+		if err != nil {
+			return p, badPathValue
+		}
+		p.ID = id
+		if r.Header.Get("Content-Type") != ContentTypTus {
+			return p, unsupportedMediaType
+		}
+		off, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+		if err != nil || off < 0 {
+			return p, badOffset
+		}
+		p.Offset = off
+		if s := r.Header.Get("Upload-Checksum"); s != "" {
+			alg, enc, _ := strings.Cut(s, " ")
+			switch alg {
+			case "sha1":
+				p.Hash = sha1.New()
+			case "sha256":
+				p.Hash = sha256.New()
+			default:
+				return p, badChecksum
+			}
+			if p.Sum, err = base64.StdEncoding.DecodeString(enc); err != nil || len(p.Sum) != p.Hash.Size() {
+				return p, badChecksum
+			}
+		}
+		return p, nil
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "http.tus_patch")
+		defer span.End()
+
+		p, err := parse(w, r)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		var (
+			body   io.Reader = r.Body
+			verify func() error
+		)
+		if p.Hash != nil {
+			body = io.TeeReader(body, p.Hash)
+			verify = func() error {
+				if !bytes.Equal(p.Hash.Sum(nil), p.Sum) {
+					return checksumMismatch
+				}
+				return nil
+			}
+		}
+		off, file, err := fsys.Append(ctx, p.ID, p.Offset, body, verify)
+		if err != nil {
+			// the client resumes from the offset it gets with HEAD
+			if errors.Is(err, dberrors.ErrStale) {
+				err = conflict
+			}
+			Error(w, r, err)
+			return
+		}
+
+		w.Header().Set("Upload-Offset", strconv.FormatInt(off, 10))
+		if file != uuid.Nil {
+			w.Header().Set("File-Id", file.String())
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func handleTusTerminate(fsys *fs.FS) http.HandlerFunc {
+	var badPathValue = statusHandler{http.StatusBadRequest, `upload id in path has invalid format`}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "http.tus_terminate")
+		defer span.End()
+
+		id, err := uuid.Parse(r.PathValue("upload"))
+		if err != nil {
+			badPathValue.ServeHTTP(w, r)
+			return
+		}
+
+		if err := fsys.Terminate(ctx, id); err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// parseMetadata parses the value of an Upload-Metadata header, a comma separated
+// list of keys each followed by an optional base64 encoded value.
+func parseMetadata(s string) (map[string]string, error) {
+	md := make(map[string]string)
+	if s == "" {
+		return md, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		k, enc, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if k == "" {
+			return nil, errors.New("metadata key is empty")
+		}
+		v, err := base64.StdEncoding.DecodeString(enc)
+		if err != nil {
+			return nil, err
+		}
+		md[k] = string(v)
+	}
+	return md, nil
+}
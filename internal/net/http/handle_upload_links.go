@@ -0,0 +1,180 @@
+package http
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"go.adoublef/eyeoh/internal/fs"
+)
+
+func handleCreateUploadLink(fsys *fs.FS) http.HandlerFunc {
+	var badPathValue = statusHandler{http.StatusBadRequest, `file id in path has invalid format`}
+	var badTTL = statusHandler{http.StatusBadRequest, `ttl must be a positive duration`}
+
+	type create struct {
+		TTL          string   `json:"ttl"`
+		MaxFiles     int64    `json:"maxFiles"`
+		MaxSize      int64    `json:"maxSize"`
+		ContentTypes []string `json:"contentTypes"`
+	}
+	type created struct {
+		fs.UploadLink
+		Token string `json:"token"`
+		URL   string `json:"url"`
+	}
+	parse := func(w http.ResponseWriter, r *http.Request) (uuid.UUID, fs.UploadLinkOptions, error) {
+		dir, err := uuid.Parse(r.PathValue("file"))
+		if err != nil {
+			return uuid.Nil, fs.UploadLinkOptions{}, badPathValue
+		}
+		c, err := Decode[create](w, r, 0, 0)
+		if err != nil {
+			return uuid.Nil, fs.UploadLinkOptions{}, err
+		}
+		ttl, err := time.ParseDuration(c.TTL)
+		if err != nil || ttl <= 0 {
+			return uuid.Nil, fs.UploadLinkOptions{}, badTTL
+		}
+		opts := fs.UploadLinkOptions{TTL: ttl, MaxFiles: c.MaxFiles, MaxSize: c.MaxSize, ContentTypes: c.ContentTypes}
+		return dir, opts, nil
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "http.create_upload_link")
+		defer span.End()
+
+		dir, opts, err := parse(w, r)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		l, token, err := fsys.CreateUploadLink(ctx, dir, opts)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		respond(w, r, created{UploadLink: l, Token: token, URL: "/u/" + token})
+	}
+}
+
+func handleUploadLinks(fsys *fs.FS) http.HandlerFunc {
+	var badPathValue = statusHandler{http.StatusBadRequest, `file id in path has invalid format`}
+
+	type links struct {
+		Links []fs.UploadLink `json:"uploadLinks"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "http.upload_links")
+		defer span.End()
+
+		dir, err := uuid.Parse(r.PathValue("file"))
+		if err != nil {
+			badPathValue.ServeHTTP(w, r)
+			return
+		}
+
+		ll, err := fsys.UploadLinks(ctx, dir)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		l := links{Links: ll}
+		if l.Links == nil {
+			l.Links = []fs.UploadLink{}
+		}
+		respond(w, r, l)
+	}
+}
+
+func handleRevokeUploadLink(fsys *fs.FS) http.HandlerFunc {
+	var badPathValue = statusHandler{http.StatusBadRequest, `upload link id in path has invalid format`}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "http.revoke_upload_link")
+		defer span.End()
+
+		id, err := uuid.Parse(r.PathValue("link"))
+		if err != nil {
+			badPathValue.ServeHTTP(w, r)
+			return
+		}
+
+		if err := fsys.RevokeUploadLink(ctx, id); err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleDrop adds the file of a multipart form to the directory of an upload
+// link, for anyone who has the link. The type of the file is sniffed from its
+// content rather than trusted from the form.
+func handleDrop(fsys *fs.FS) http.HandlerFunc {
+	var unsupportedMediaType = statusHandler{http.StatusUnsupportedMediaType, `request is not a mulitpart/form`}
+	var unsupportedContentType = statusHandler{http.StatusUnsupportedMediaType, `file type is not allowed by the link`}
+	var unprocessableEntity = func(err error) statusHandler {
+		return statusHandler{http.StatusUnprocessableEntity, "failed to decode part: " + err.Error()}
+	}
+
+	type upload struct {
+		ID string `json:"fileId"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "http.drop")
+		defer span.End()
+
+		l, err := fsys.OpenUploadLink(ctx, r.PathValue("token"))
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		mr, err := r.MultipartReader()
+		if err != nil {
+			unsupportedMediaType.ServeHTTP(w, r)
+			return
+		}
+		part, err := mr.NextPart()
+		if err != nil {
+			unprocessableEntity(err).ServeHTTP(w, r)
+			return
+		}
+		defer part.Close()
+		filename, err := fs.ParseName(part.FileName())
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		br := bufio.NewReaderSize(part, 512)
+		head, err := br.Peek(512)
+		if err != nil && !errors.Is(err, io.EOF) {
+			unprocessableEntity(err).ServeHTTP(w, r)
+			return
+		}
+		if !l.Allows(http.DetectContentType(head)) {
+			unsupportedContentType.ServeHTTP(w, r)
+			return
+		}
+		var body io.Reader = br
+		if l.MaxSize != nil {
+			body = http.MaxBytesReader(w, io.NopCloser(br), *l.MaxSize)
+		}
+
+		file, err := fsys.Drop(ctx, l, filename, body)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+
+		respond(w, r, upload{ID: file.String()})
+	}
+}
@@ -30,9 +30,12 @@ type Server = http.Server
 
 var ErrServerClosed = http.ErrServerClosed
 
-func Handler(burst int, ttl time.Duration, fsys *fs.FS) http.Handler {
+// Handler returns the [http.Handler] of the api. If a is nil requests are not
+// authenticated and act with the access of the system.
+func Handler(burst int, ttl time.Duration, fsys *fs.FS, a Authenticator) http.Handler {
 	mux := http.NewServeMux()
 	handleFunc := func(pattern string, h http.Handler) {
+		h = capable(operation(pattern), h)
 		h = otelhttp.WithRouteTag(pattern, h)
 		mux.Handle(pattern, h)
 	}
@@ -54,15 +57,65 @@ func Handler(burst int, ttl time.Duration, fsys *fs.FS) http.Handler {
 	handleFunc("GET /ready", statusHandler{code: http.StatusOK})
 
 	handleFunc("POST /touch/files", handleFileUpload(fsys))
+	handleFunc("POST /dedup/files", JSON(handleFileCreateByHash(fsys)))
 	handleFunc("POST /mkdir/files", JSON(handleCreateFolder(fsys)))
 	handleFunc("GET /info/files/{file}", handleFileInfo(fsys))
 	handleFunc("PATCH /rename/files/{file}", handleFileRename(fsys))
 	handleFunc("GET /files/{file}", handleFileDownload(fsys))
-	// todo: MOVE
-	// todo: COPY
-	// todo: REMOVE
+	handleFunc("PUT /files/{file}", handleFileReplace(fsys))
+	handleFunc("GET /ls/files/{file}", handleReadDir(fsys))
+	handleFunc("GET /tree/files/{file}", handleFileTree(fsys))
+	handleFunc("GET /du/files/{file}", JSON(handleDiskUsage(fsys)))
+	handleFunc("GET /paths/{path...}", handleByPath(fsys, handleFileDownload(fsys)))
+	handleFunc("GET /info/paths/{path...}", handleByPath(fsys, handleFileInfo(fsys)))
+	handleFunc("GET /ls/paths/{path...}", handleByPath(fsys, handleReadDir(fsys)))
+	handleFunc("POST /mv/files", JSON(handleFileMove(fsys)))
+	handleFunc("POST /cp/files", JSON(handleFileCopy(fsys)))
+	handleFunc("POST /rm/files", JSON(handleFileRemove(fsys)))
+	handleFunc("GET /trash", JSON(handleTrash(fsys)))
+	handleFunc("POST /restore/files/{file}", JSON(handleFileRestore(fsys)))
+	handleFunc("GET /versions/files/{file}", JSON(handleFileVersions(fsys)))
+	handleFunc("PATCH /versions/files/{file}", handleSetMaxVersions(fsys))
+	handleFunc("POST /revert/files/{file}", JSON(handleFileRevert(fsys)))
+	handleFunc("GET /quotas", JSON(handleQuotas(fsys)))
+	handleFunc("GET /quota/files/{file}", JSON(handleQuota(fsys)))
+	handleFunc("PUT /quota/files/{file}", JSON(handleSetQuota(fsys)))
+	handleFunc("DELETE /quota/files/{file}", handleRemoveQuota(fsys))
 
-	h := AcceptHandler(mux)
+	handleFunc("POST /users", JSON(handleCreateUser(fsys)))
+	handleFunc("POST /groups", JSON(handleCreateGroup(fsys)))
+	handleFunc("PUT /groups/{group}/members/{user}", handleGroupMember(fsys, true))
+	handleFunc("DELETE /groups/{group}/members/{user}", handleGroupMember(fsys, false))
+	handleFunc("POST /users/{user}/identities", handleLinkIdentity(fsys))
+	handleFunc("POST /keys", JSON(handleCreateKey(fsys)))
+	handleFunc("GET /keys", JSON(handleKeys(fsys)))
+	handleFunc("DELETE /keys/{key}", handleRevokeKey(fsys))
+	handleFunc("POST /capabilities", JSON(handleCreateCapability(fsys)))
+	handleFunc("DELETE /capabilities/{capability}", handleRevokeCapability(fsys))
+	handleFunc("POST /shares/files/{file}", JSON(handleCreateShare(fsys)))
+	handleFunc("GET /shares/files/{file}", JSON(handleShares(fsys)))
+	handleFunc("DELETE /shares/{share}", handleRevokeShare(fsys))
+	handleFunc("GET /s/{token}", handleShare(fsys))
+	handleFunc("GET /s/{token}/{path...}", handleShare(fsys))
+	handleFunc("POST /uploads/files/{file}", JSON(handleCreateUploadLink(fsys)))
+	handleFunc("GET /uploads/files/{file}", JSON(handleUploadLinks(fsys)))
+	handleFunc("DELETE /uploads/{link}", handleRevokeUploadLink(fsys))
+	handleFunc("POST /u/{token}", handleDrop(fsys))
+	handleFunc("GET /acl/files/{file}", JSON(handleFileACL(fsys)))
+	handleFunc("PATCH /acl/files/{file}", handleSetFileACL(fsys))
+	handleFunc("DELETE /acl/files/{file}/{principal}", handleRemoveFileACL(fsys))
+
+	handleFunc("OPTIONS /tus/files", Tus(handleTusOptions()))
+	handleFunc("POST /tus/files", Tus(handleTusCreate(fsys)))
+	handleFunc("HEAD /tus/files/{upload}", Tus(handleTusHead(fsys)))
+	handleFunc("PATCH /tus/files/{upload}", Tus(handleTusPatch(fsys)))
+	handleFunc("DELETE /tus/files/{upload}", Tus(handleTusTerminate(fsys)))
+
+	var h http.Handler = mux
+	if a != nil {
+		h = AuthHandler(h, a)
+	}
+	h = AcceptHandler(h)
 	h = LimitHandler(h, burst, ttl)
 	h = otelhttp.NewHandler(h, "Http")
 	return h
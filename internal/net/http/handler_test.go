@@ -1,10 +1,24 @@
 package http_test
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -13,6 +27,9 @@ import (
 
 	"github.com/Shopify/toxiproxy/v2/toxics"
 	"github.com/google/uuid"
+	"go.adoublef/eyeoh/internal/fs"
+	"go.adoublef/eyeoh/internal/jwt"
+	"go.adoublef/eyeoh/internal/macaroon"
 	. "go.adoublef/eyeoh/internal/net/http"
 	"go.adoublef/eyeoh/internal/testing/is"
 )
@@ -144,6 +161,35 @@ func Test_handleCreateFolder(t *testing.T) {
 		is.Equal(t, res.StatusCode, http.StatusOK)
 	})
 
+	t.Run("Parents", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		body := `{"name":"reports/2024","parents":true}`
+
+		var ids [2]string
+		for i := range ids {
+			res, err := c.Do(ctx, "POST /mkdir/files", strings.NewReader(body), ctJSON, acceptAll)
+			is.OK(t, err) // return create folder response
+			is.Equal(t, res.StatusCode, http.StatusOK)
+
+			var file struct {
+				ID string `json:"folderId"`
+			}
+			err = json.NewDecoder(res.Body).Decode(&file)
+			is.OK(t, err) // decode json payload
+			is.OK(t, res.Body.Close())
+			ids[i] = file.ID
+		}
+		// existing directories are left as they are
+		is.Equal(t, ids[0], ids[1])
+
+		// without parents the name must be a single element
+		body = `{"name":"reports/2025"}`
+		res, err := c.Do(ctx, "POST /mkdir/files", strings.NewReader(body), ctJSON, acceptAll)
+		is.OK(t, err) // return create folder response
+		is.Equal(t, res.StatusCode, http.StatusBadRequest)
+	})
+
 	t.Run("ErrBadName", func(t *testing.T) {
 		c, ctx := newClient(t), context.Background()
 
@@ -192,6 +238,16 @@ func Test_handleFileUpload(t *testing.T) {
 		is.Equal(t, ok.Load(), 1)
 		is.Equal(t, conflict.Load(), 1)
 	})
+
+	t.Run("ErrNotDir", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		file := touch(t, c, uuid.Nil.String(), "testdata/hello.txt")
+
+		res, err := c.PostFormFile(ctx, "POST /touch/files?parent="+file, "testdata/hello.txt")
+		is.OK(t, err) // return file upload response
+		is.Equal(t, res.StatusCode, http.StatusBadRequest)
+	})
 }
 
 func Test_handleFileDownload(t *testing.T) {
@@ -245,6 +301,1947 @@ func Test_handleFileDownload(t *testing.T) {
 		is.OK(t, err)                                     // return download response
 		is.Equal(t, res.StatusCode, http.StatusForbidden) // cannot use endpoint to download a directory
 	})
+
+	t.Run("Headers", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		file := touch(t, c, uuid.Nil.String(), "testdata/hello.txt")
+
+		for _, method := range []string{http.MethodGet, http.MethodHead} {
+			res, err := c.Do(ctx, method+" /files/"+file, nil, acceptAll)
+			is.OK(t, err) // return download response
+			is.Equal(t, res.StatusCode, http.StatusOK)
+			is.Equal(t, res.ContentLength, 14)
+			is.Equal(t, res.Header.Get("Content-Type"), "text/plain; charset=utf-8")
+			is.Equal(t, res.Header.Get("Content-Disposition"), `attachment; filename="hello.txt"`)
+			is.Equal(t, res.Header.Get("X-Content-Type-Options"), "nosniff")
+			is.True(t, res.Header.Get("Last-Modified") != "")
+			is.OK(t, res.Body.Close())
+		}
+
+		body := `{"name":"héllo wörld.txt","revision":1}`
+		res, err := c.Do(ctx, "PATCH /rename/files/"+file, strings.NewReader(body), ctJSON, acceptAll)
+		is.OK(t, err) // return file rename response
+		is.Equal(t, res.StatusCode, http.StatusNoContent)
+
+		res, err = c.Do(ctx, "HEAD /files/"+file+"?disposition=inline", nil, acceptAll)
+		is.OK(t, err) // return download response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+		is.Equal(t, res.Header.Get("Content-Disposition"), `inline; filename="h_llo w_rld.txt"; filename*=UTF-8''h%C3%A9llo%20w%C3%B6rld.txt`)
+		is.True(t, strings.Contains(res.Header.Get("Content-Security-Policy"), "sandbox"))
+
+		res, err = c.Do(ctx, "HEAD /files/"+file+"?disposition=open", nil, acceptAll)
+		is.OK(t, err) // return download response
+		is.Equal(t, res.StatusCode, http.StatusBadRequest)
+	})
+
+	t.Run("Range", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		file := touch(t, c, uuid.Nil.String(), "testdata/hello.txt")
+		rangeOf := func(s string) func(*http.Request) {
+			return func(r *http.Request) { r.Header.Set("Range", s) }
+		}
+
+		type testcase struct {
+			rangeHeader  string
+			code         int
+			contentRange string
+			body         string
+		}
+		var tt = map[string]testcase{
+			"OK": {
+				rangeHeader:  "bytes=0-4",
+				code:         http.StatusPartialContent,
+				contentRange: "bytes 0-4/14",
+				body:         "hello",
+			},
+			"Open": {
+				rangeHeader:  "bytes=7-",
+				code:         http.StatusPartialContent,
+				contentRange: "bytes 7-13/14",
+				body:         "world!\n",
+			},
+			"Suffix": {
+				rangeHeader:  "bytes=-2",
+				code:         http.StatusPartialContent,
+				contentRange: "bytes 12-13/14",
+				body:         "!\n",
+			},
+			"ErrInvalid": {
+				rangeHeader: "lines=1-2",
+				code:        http.StatusRequestedRangeNotSatisfiable,
+			},
+			"ErrNotSatisfiable": {
+				rangeHeader:  "bytes=14-20",
+				code:         http.StatusRequestedRangeNotSatisfiable,
+				contentRange: "bytes */14",
+			},
+		}
+		for name, tc := range tt {
+			t.Run(name, func(t *testing.T) {
+				res, err := c.Do(ctx, "GET /files/"+file, nil, acceptAll, rangeOf(tc.rangeHeader))
+				is.OK(t, err) // return download response
+				is.Equal(t, res.StatusCode, tc.code)
+				is.Equal(t, res.Header.Get("Accept-Ranges"), "bytes")
+				is.Equal(t, res.Header.Get("Content-Range"), tc.contentRange)
+				if tc.body != "" {
+					b, err := io.ReadAll(res.Body)
+					is.OK(t, err) // read content
+					is.Equal(t, string(b), tc.body)
+				}
+				is.OK(t, res.Body.Close())
+			})
+		}
+
+		t.Run("Multipart", func(t *testing.T) {
+			res, err := c.Do(ctx, "GET /files/"+file, nil, acceptAll, rangeOf("bytes=0-4, 7-11"))
+			is.OK(t, err) // return download response
+			is.Equal(t, res.StatusCode, http.StatusPartialContent)
+
+			mt, params, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+			is.OK(t, err) // parse content type
+			is.Equal(t, mt, "multipart/byteranges")
+
+			b, err := io.ReadAll(res.Body)
+			is.OK(t, err) // read content
+			is.OK(t, res.Body.Close())
+			is.Equal(t, res.ContentLength, int64(len(b)))
+
+			var got []string
+			mr := multipart.NewReader(bytes.NewReader(b), params["boundary"])
+			for {
+				part, err := mr.NextPart()
+				if err == io.EOF {
+					break
+				}
+				is.OK(t, err) // read part
+				p, err := io.ReadAll(part)
+				is.OK(t, err) // read part content
+				got = append(got, part.Header.Get("Content-Range")+" "+string(p))
+			}
+			is.Equal(t, strings.Join(got, ";"), "bytes 0-4/14 hello;bytes 7-11/14 world")
+		})
+
+		t.Run("IfRange", func(t *testing.T) {
+			ifRange := func(r *http.Request) { r.Header.Set("If-Range", `"stale"`) }
+			res, err := c.Do(ctx, "GET /files/"+file, nil, acceptAll, rangeOf("bytes=0-4"), ifRange)
+			is.OK(t, err) // return download response
+			is.Equal(t, res.StatusCode, http.StatusOK)
+			is.OK(t, res.Body.Close())
+		})
+	})
+}
+
+func Test_handleConditional(t *testing.T) {
+	header := func(key, value string) func(*http.Request) {
+		return func(r *http.Request) { r.Header.Set(key, value) }
+	}
+
+	t.Run("NotModified", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		file := touch(t, c, uuid.Nil.String(), "testdata/hello.txt")
+
+		res, err := c.Do(ctx, "GET /files/"+file, nil, acceptAll)
+		is.OK(t, err) // return download response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+		is.OK(t, res.Body.Close())
+		etag, lastModified := res.Header.Get("ETag"), res.Header.Get("Last-Modified")
+		is.True(t, lastModified != "")
+
+		res, err = c.Do(ctx, "GET /files/"+file, nil, acceptAll, header("If-None-Match", etag))
+		is.OK(t, err) // return download response
+		is.Equal(t, res.StatusCode, http.StatusNotModified)
+		is.Equal(t, res.Header.Get("ETag"), etag)
+
+		res, err = c.Do(ctx, "GET /files/"+file, nil, acceptAll, header("If-Modified-Since", lastModified))
+		is.OK(t, err) // return download response
+		is.Equal(t, res.StatusCode, http.StatusNotModified)
+
+		res, err = c.Do(ctx, "GET /files/"+file, nil, acceptAll, header("If-None-Match", `"stale"`))
+		is.OK(t, err) // return download response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+		is.OK(t, res.Body.Close())
+	})
+
+	t.Run("ErrModified", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		file := touch(t, c, uuid.Nil.String(), "testdata/hello.txt")
+
+		res, err := c.Do(ctx, "GET /files/"+file, nil, acceptAll, header("If-Match", `"stale"`))
+		is.OK(t, err) // return download response
+		is.Equal(t, res.StatusCode, http.StatusPreconditionFailed)
+
+		since := header("If-Unmodified-Since", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat))
+		res, err = c.Do(ctx, "GET /files/"+file, nil, acceptAll, since)
+		is.OK(t, err) // return download response
+		is.Equal(t, res.StatusCode, http.StatusPreconditionFailed)
+	})
+
+	t.Run("Rename", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		file := touch(t, c, uuid.Nil.String(), "testdata/hello.txt")
+
+		res, err := c.Do(ctx, "GET /info/files/"+file, nil, acceptAll)
+		is.OK(t, err) // return file info response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+		is.OK(t, res.Body.Close())
+		etag := res.Header.Get("ETag")
+
+		res, err = c.Do(ctx, "GET /info/files/"+file, nil, acceptAll, header("If-None-Match", etag))
+		is.OK(t, err) // return file info response
+		is.Equal(t, res.StatusCode, http.StatusNotModified)
+
+		// the revision is not needed with a precondition
+		res, err = c.Do(ctx, "PATCH /rename/files/"+file, strings.NewReader(`{"name":"world.txt"}`), ctJSON, acceptAll, header("If-Match", etag))
+		is.OK(t, err) // return file rename response
+		is.Equal(t, res.StatusCode, http.StatusNoContent)
+
+		res, err = c.Do(ctx, "PATCH /rename/files/"+file, strings.NewReader(`{"name":"again.txt"}`), ctJSON, acceptAll, header("If-Match", etag))
+		is.OK(t, err) // return file rename response
+		is.Equal(t, res.StatusCode, http.StatusPreconditionFailed)
+
+		res, err = c.Do(ctx, "GET /info/files/"+file, nil, acceptAll, header("If-None-Match", etag))
+		is.OK(t, err) // return file info response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+
+		var info struct {
+			Name string `json:"filename"`
+		}
+		is.OK(t, json.NewDecoder(res.Body).Decode(&info))
+		is.OK(t, res.Body.Close())
+		is.Equal(t, info.Name, "world.txt")
+		is.True(t, res.Header.Get("ETag") != etag)
+	})
+}
+
+func Test_handleLookup(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		dir := mkdir(t, c, uuid.Nil.String(), "reports")
+		file := touch(t, c, dir, "testdata/hello.txt")
+
+		res, err := c.Do(ctx, "GET /info/paths/reports/hello.txt", nil, acceptAll)
+		is.OK(t, err) // return file info response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+
+		var info struct {
+			ID string `json:"fileId"`
+		}
+		err = json.NewDecoder(res.Body).Decode(&info)
+		is.OK(t, err) // decode json payload
+		is.OK(t, res.Body.Close())
+		is.Equal(t, info.ID, file)
+
+		res, err = c.Do(ctx, "GET /paths/reports/hello.txt", nil, acceptAll)
+		is.OK(t, err) // return download response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+		is.OK(t, res.Body.Close())
+
+		res, err = c.Do(ctx, "GET /ls/paths/reports", nil, acceptAll)
+		is.OK(t, err) // return read dir response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+
+		var ls struct {
+			Entries []struct {
+				Path string `json:"path"`
+			} `json:"entries"`
+		}
+		err = json.NewDecoder(res.Body).Decode(&ls)
+		is.OK(t, err) // decode json payload
+		is.OK(t, res.Body.Close())
+		is.Equal(t, len(ls.Entries), 1)
+		is.Equal(t, ls.Entries[0].Path, "/reports/hello.txt")
+	})
+
+	t.Run("ErrNotExist", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		_ = mkdir(t, c, uuid.Nil.String(), "reports")
+
+		for _, pattern := range []string{
+			"GET /info/paths/reports/hello.txt",
+			"GET /paths/hello.txt",
+		} {
+			res, err := c.Do(ctx, pattern, nil, acceptAll)
+			is.OK(t, err) // return lookup response
+			is.Equal(t, res.StatusCode, http.StatusNotFound)
+		}
+	})
+}
+
+func Test_handleReadDir(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		dir := mkdir(t, c, uuid.Nil.String(), "src")
+		_ = mkdir(t, c, dir, "lib")
+		_ = touch(t, c, dir, "testdata/hello.txt")
+		_ = touch(t, c, dir, "testdata/nyantocat.gif")
+
+		type listing struct {
+			Entries []struct {
+				ID   string `json:"fileId"`
+				Name string `json:"filename"`
+			} `json:"entries"`
+			Cursor string `json:"cursor"`
+		}
+
+		var names []string
+		var next = "?limit=2"
+		for range 2 {
+			res, err := c.Do(ctx, "GET /ls/files/"+dir+next, nil, acceptAll)
+			is.OK(t, err) // return listing response
+			is.Equal(t, res.StatusCode, http.StatusOK)
+
+			var l listing
+			err = json.NewDecoder(res.Body).Decode(&l)
+			is.OK(t, err) // decode json payload
+			is.OK(t, res.Body.Close())
+
+			for _, e := range l.Entries {
+				names = append(names, e.Name)
+			}
+			next = "?limit=2&cursor=" + l.Cursor
+		}
+		is.Equal(t, names, []string{"hello.txt", "lib", "nyantocat.gif"}) // sorted by name
+	})
+
+	t.Run("SortSize", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		dir := mkdir(t, c, uuid.Nil.String(), "src")
+		_ = touch(t, c, dir, "testdata/hello.txt")
+		_ = touch(t, c, dir, "testdata/nyantocat.gif")
+
+		res, err := c.Do(ctx, "GET /ls/files/"+dir+"?sort=size&order=desc", nil, acceptAll)
+		is.OK(t, err) // return listing response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+
+		var l struct {
+			Entries []struct {
+				Name string `json:"filename"`
+			} `json:"entries"`
+			Cursor string `json:"cursor"`
+		}
+		err = json.NewDecoder(res.Body).Decode(&l)
+		is.OK(t, err) // decode json payload
+		is.OK(t, res.Body.Close())
+
+		is.Equal(t, len(l.Entries), 2)
+		is.Equal(t, l.Entries[0].Name, "nyantocat.gif") // largest first
+		is.Equal(t, l.Cursor, "")                       // last page
+	})
+
+	t.Run("ErrBadRequest", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		file := touch(t, c, uuid.Nil.String(), "testdata/hello.txt")
+
+		for _, path := range []string{
+			"GET /ls/files/" + file, // not a directory
+			"GET /ls/files/" + uuid.Nil.String() + "?cursor=invalid",
+			"GET /ls/files/" + uuid.Nil.String() + "?sort=owner",
+		} {
+			res, err := c.Do(ctx, path, nil, acceptAll)
+			is.OK(t, err) // return listing response
+			is.Equal(t, res.StatusCode, http.StatusBadRequest)
+		}
+	})
+}
+
+func Test_handleFileTree(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		src := mkdir(t, c, uuid.Nil.String(), "src")
+		_ = touch(t, c, src, "testdata/hello.txt")
+		lib := mkdir(t, c, src, "lib")
+		_ = touch(t, c, lib, "testdata/hello.txt")
+
+		res, err := c.Do(ctx, "GET /tree/files/"+uuid.Nil.String(), nil, acceptAll)
+		is.OK(t, err) // return file tree response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+		is.Equal(t, res.Header.Get("Content-Type"), "application/x-ndjson")
+
+		var paths []string
+		dec := json.NewDecoder(res.Body)
+		for dec.More() {
+			var entry struct {
+				Path string `json:"path"`
+				ETag string `json:"etag"`
+			}
+			err := dec.Decode(&entry)
+			is.OK(t, err) // decode json record
+			paths = append(paths, entry.Path)
+		}
+		is.OK(t, res.Body.Close())
+		is.Equal(t, strings.Join(paths, ","), "/src,/src/hello.txt,/src/lib,/src/lib/hello.txt")
+
+		res, err = c.Do(ctx, "GET /tree/files/"+lib, nil, acceptAll)
+		is.OK(t, err) // return file tree response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+
+		p, err := io.ReadAll(res.Body)
+		is.OK(t, err) // read records
+		is.OK(t, res.Body.Close())
+		is.Equal(t, strings.Count(string(p), "\n"), 1)
+	})
+
+	t.Run("AcceptNDJSON", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		_ = touch(t, c, uuid.Nil.String(), "testdata/hello.txt")
+
+		ndjson := func(r *http.Request) { r.Header.Set("Accept", "application/x-ndjson") }
+		res, err := c.Do(ctx, "GET /tree/files/"+uuid.Nil.String(), nil, ndjson)
+		is.OK(t, err) // return file tree response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+		is.Equal(t, res.Header.Get("Content-Type"), "application/x-ndjson")
+		is.OK(t, res.Body.Close())
+
+		// other routes only respond with json
+		res, err = c.Do(ctx, "GET /du/files/"+uuid.Nil.String(), nil, ndjson)
+		is.OK(t, err) // return disk usage response
+		is.Equal(t, res.StatusCode, http.StatusNotAcceptable)
+		is.OK(t, res.Body.Close())
+	})
+
+	t.Run("ErrNotExist", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		res, err := c.Do(ctx, "GET /tree/files/"+uuid.Must(uuid.NewV7()).String(), nil, acceptAll)
+		is.OK(t, err) // return file tree response
+		is.Equal(t, res.StatusCode, http.StatusNotFound)
+	})
+}
+
+func Test_handleDiskUsage(t *testing.T) {
+	type usage struct {
+		Files    int64  `json:"files"`
+		Latest   int64  `json:"latest"`
+		Total    int64  `json:"total"`
+		Physical *int64 `json:"physical"`
+	}
+	du := func(tb testing.TB, c *TestClient, file string) usage {
+		tb.Helper()
+
+		res, err := c.Do(context.Background(), "GET /du/files/"+file, nil, acceptAll)
+		is.OK(tb, err) // return disk usage response
+		is.Equal(tb, res.StatusCode, http.StatusOK)
+
+		var u usage
+		err = json.NewDecoder(res.Body).Decode(&u)
+		is.OK(tb, err) // decode json payload
+		is.OK(tb, res.Body.Close())
+		return u
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		src := mkdir(t, c, uuid.Nil.String(), "src")
+		file := touch(t, c, src, "testdata/hello.txt")
+		lib := mkdir(t, c, src, "lib")
+		_ = touch(t, c, lib, "testdata/hello.txt")
+		_ = touch(t, c, uuid.Nil.String(), "testdata/hello.txt")
+
+		u := du(t, c, src)
+		is.Equal(t, u, usage{Files: 2, Latest: 28, Total: 28})
+
+		// identical content is only stored once
+		u = du(t, c, uuid.Nil.String())
+		is.Equal(t, u.Files, 3)
+		is.Equal(t, u.Total, 42)
+		is.Equal(t, *u.Physical, 14)
+
+		res, err := c.Do(ctx, "PUT /files/"+file+"?revision=1", strings.NewReader("Hello, World!"), acceptAll)
+		is.OK(t, err) // return file replace response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+		is.OK(t, res.Body.Close())
+
+		u = du(t, c, src)
+		is.Equal(t, u, usage{Files: 2, Latest: 27, Total: 41})
+
+		body := fmt.Sprintf(`{"files":[{"fileId":%q,"revision":0}]}`, lib)
+		res, err = c.Do(ctx, "POST /rm/files", strings.NewReader(body), ctJSON, acceptAll)
+		is.OK(t, err) // return file remove response
+		is.Equal(t, res.StatusCode, http.StatusNoContent)
+
+		u = du(t, c, src)
+		is.Equal(t, u, usage{Files: 1, Latest: 13, Total: 27})
+
+		// versions in the trash are still stored
+		top := du(t, c, uuid.Nil.String())
+		is.Equal(t, top.Files, 2)
+		is.Equal(t, top.Total, 41)
+		is.Equal(t, *top.Physical, 27)
+
+		res, err = c.Do(ctx, "GET /info/files/"+src, nil, acceptAll)
+		is.OK(t, err) // return file info response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+
+		var info struct {
+			Usage *usage `json:"usage"`
+		}
+		err = json.NewDecoder(res.Body).Decode(&info)
+		is.OK(t, err) // decode json payload
+		is.OK(t, res.Body.Close())
+		is.Equal(t, *info.Usage, u)
+	})
+}
+
+func Test_handleQuota(t *testing.T) {
+	type quota struct {
+		MaxBytes  *int64 `json:"maxBytes"`
+		SoftFiles *int64 `json:"softFiles"`
+		Usage     struct {
+			Files int64 `json:"files"`
+			Total int64 `json:"total"`
+		} `json:"usage"`
+		Soft bool `json:"soft"`
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		src := mkdir(t, c, uuid.Nil.String(), "src")
+
+		res, err := c.Do(ctx, "PUT /quota/files/"+src, strings.NewReader(`{"maxBytes":20,"softFiles":0}`), ctJSON, acceptAll)
+		is.OK(t, err) // return set quota response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+		is.OK(t, res.Body.Close())
+
+		_ = touch(t, c, src, "testdata/hello.txt")
+
+		res, err = c.Do(ctx, "GET /quota/files/"+src, nil, acceptAll)
+		is.OK(t, err) // return quota response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+
+		var q quota
+		err = json.NewDecoder(res.Body).Decode(&q)
+		is.OK(t, err) // decode json payload
+		is.OK(t, res.Body.Close())
+		is.Equal(t, *q.MaxBytes, 20)
+		is.Equal(t, q.Usage.Files, 1)
+		is.Equal(t, q.Usage.Total, 14)
+		is.True(t, q.Soft)
+
+		res, err = c.Do(ctx, "DELETE /quota/files/"+src, nil, acceptAll)
+		is.OK(t, err) // return remove quota response
+		is.Equal(t, res.StatusCode, http.StatusNoContent)
+
+		res, err = c.Do(ctx, "GET /quota/files/"+src, nil, acceptAll)
+		is.OK(t, err) // return quota response
+		is.Equal(t, res.StatusCode, http.StatusNotFound)
+	})
+
+	t.Run("ErrInsufficientStorage", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		src := mkdir(t, c, uuid.Nil.String(), "src")
+
+		res, err := c.Do(ctx, "PUT /quota/files/"+src, strings.NewReader(`{"maxBytes":20}`), ctJSON, acceptAll)
+		is.OK(t, err) // return set quota response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+
+		_ = touch(t, c, src, "testdata/hello.txt")
+
+		// the second copy goes over the limit part way through the upload
+		res, err = c.PostFormFile(ctx, "POST /touch/files?parent="+src, "testdata/hello.txt")
+		is.OK(t, err) // return file upload response
+		is.Equal(t, res.StatusCode, http.StatusInsufficientStorage)
+	})
+
+	t.Run("ErrNotTopLevel", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		src := mkdir(t, c, uuid.Nil.String(), "src")
+		lib := mkdir(t, c, src, "lib")
+
+		res, err := c.Do(ctx, "PUT /quota/files/"+lib, strings.NewReader(`{"maxBytes":20}`), ctJSON, acceptAll)
+		is.OK(t, err) // return set quota response
+		is.Equal(t, res.StatusCode, http.StatusBadRequest)
+	})
+}
+
+func Test_handleFileACL(t *testing.T) {
+	type acl struct {
+		Entries []struct {
+			Principal string `json:"principalId"`
+			Perm      string `json:"perm"`
+		} `json:"entries"`
+	}
+	t.Run("OK", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		src := mkdir(t, c, uuid.Nil.String(), "src")
+
+		res, err := c.Do(ctx, "POST /users", strings.NewReader(`{"name":"alice"}`), ctJSON, acceptAll)
+		is.OK(t, err) // return create user response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+
+		var user struct {
+			ID string `json:"userId"`
+		}
+		err = json.NewDecoder(res.Body).Decode(&user)
+		is.OK(t, err) // decode json payload
+		is.OK(t, res.Body.Close())
+
+		res, err = c.Do(ctx, "POST /groups", strings.NewReader(`{"name":"staff"}`), ctJSON, acceptAll)
+		is.OK(t, err) // return create group response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+
+		var group struct {
+			ID string `json:"groupId"`
+		}
+		err = json.NewDecoder(res.Body).Decode(&group)
+		is.OK(t, err) // decode json payload
+		is.OK(t, res.Body.Close())
+
+		res, err = c.Do(ctx, "PUT /groups/"+group.ID+"/members/"+user.ID, nil, acceptAll)
+		is.OK(t, err) // return add member response
+		is.Equal(t, res.StatusCode, http.StatusNoContent)
+
+		body := fmt.Sprintf(`{"entries":[{"principalId":%q,"perm":"write"},{"principalId":%q,"perm":"none"}]}`, group.ID, user.ID)
+		res, err = c.Do(ctx, "PATCH /acl/files/"+src, strings.NewReader(body), ctJSON, acceptAll)
+		is.OK(t, err) // return set acl response
+		is.Equal(t, res.StatusCode, http.StatusNoContent)
+
+		res, err = c.Do(ctx, "DELETE /acl/files/"+src+"/"+user.ID, nil, acceptAll)
+		is.OK(t, err) // return remove acl response
+		is.Equal(t, res.StatusCode, http.StatusNoContent)
+
+		res, err = c.Do(ctx, "GET /acl/files/"+src, nil, acceptAll)
+		is.OK(t, err) // return acl response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+
+		var a acl
+		err = json.NewDecoder(res.Body).Decode(&a)
+		is.OK(t, err) // decode json payload
+		is.OK(t, res.Body.Close())
+		is.Equal(t, len(a.Entries), 1)
+		is.Equal(t, a.Entries[0].Principal, group.ID)
+		is.Equal(t, a.Entries[0].Perm, "write")
+	})
+
+	t.Run("ErrPerm", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		src := mkdir(t, c, uuid.Nil.String(), "src")
+
+		body := fmt.Sprintf(`{"entries":[{"principalId":%q,"perm":"owner"}]}`, uuid.New())
+		res, err := c.Do(ctx, "PATCH /acl/files/"+src, strings.NewReader(body), ctJSON, acceptAll)
+		is.OK(t, err) // return set acl response
+		is.Equal(t, res.StatusCode, http.StatusBadRequest)
+	})
+}
+
+func Test_handleAuth(t *testing.T) {
+	bearer := func(token string) func(*http.Request) {
+		return func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) }
+	}
+	newAuthClient := func(tb testing.TB, v *jwt.Verifier) (*TestClient, *fs.FS) {
+		fsys := newTestFS(tb)
+		return newTestClient(tb, Handler(10, 200*time.Millisecond, fsys, &Auth{FS: fsys, JWT: v})), fsys
+	}
+	newKey := func(tb testing.TB, fsys *fs.FS, name fs.Name) string {
+		user, err := fsys.CreateUser(context.Background(), name, false)
+		is.OK(tb, err) // create user
+		token, _, err := fsys.CreateKey(context.Background(), user, "", 0)
+		is.OK(tb, err) // create api key
+		return token
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		c, fsys := newAuthClient(t, nil)
+		ctx := context.Background()
+
+		token := newKey(t, fsys, "alice")
+		body := fmt.Sprintf(`{"parentId":%q,"name":"src"}`, uuid.Nil)
+		res, err := c.Do(ctx, "POST /mkdir/files", strings.NewReader(body), ctJSON, acceptAll, bearer(token))
+		is.OK(t, err) // return create folder response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+	})
+
+	t.Run("OKJWT", func(t *testing.T) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		is.OK(t, err) // generate signing key
+		jwks := fmt.Sprintf(`{"keys":[{"kty":"EC","kid":"k1","crv":"P-256","x":%q,"y":%q}]}`,
+			base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+			base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))))
+		keys, err := jwt.ParseJWKS([]byte(jwks))
+		is.OK(t, err) // parse key set
+
+		const iss = "https://id.example.com"
+		c, fsys := newAuthClient(t, &jwt.Verifier{Keys: keys, Issuer: iss})
+		ctx := context.Background()
+
+		user, err := fsys.CreateUser(ctx, "alice", false)
+		is.OK(t, err) // create user
+		is.OK(t, fsys.LinkIdentity(ctx, user, iss, "alice@example.com"))
+
+		token, err := jwt.Sign(key, "k1", jwt.Claims{Issuer: iss, Subject: "alice@example.com", ExpiresAt: time.Now().Add(time.Hour).Unix()})
+		is.OK(t, err) // sign token
+
+		res, err := c.Do(ctx, "GET /keys", nil, acceptAll, bearer(token))
+		is.OK(t, err) // return keys response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+
+		token, err = jwt.Sign(key, "k1", jwt.Claims{Issuer: iss, Subject: "mallory@example.com", ExpiresAt: time.Now().Add(time.Hour).Unix()})
+		is.OK(t, err) // sign token
+
+		res, err = c.Do(ctx, "GET /keys", nil, acceptAll, bearer(token))
+		is.OK(t, err) // return keys response
+		is.Equal(t, res.StatusCode, http.StatusUnauthorized)
+	})
+
+	t.Run("ErrUnauthorized", func(t *testing.T) {
+		c, fsys := newAuthClient(t, nil)
+		ctx := context.Background()
+
+		res, err := c.Do(ctx, "GET /ls/files/"+uuid.Nil.String(), nil, acceptAll)
+		is.OK(t, err) // return read dir response
+		is.Equal(t, res.StatusCode, http.StatusUnauthorized)
+		is.Equal(t, res.Header.Get("WWW-Authenticate"), "Bearer")
+
+		token := newKey(t, fsys, "alice")
+		res, err = c.Do(ctx, "GET /ls/files/"+uuid.Nil.String(), nil, acceptAll, bearer(token+"x"))
+		is.OK(t, err) // return read dir response
+		is.Equal(t, res.StatusCode, http.StatusUnauthorized)
+
+		res, err = c.Do(ctx, "GET /ready", nil, acceptAll)
+		is.OK(t, err) // return ready response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+	})
+
+	t.Run("Public", func(t *testing.T) {
+		c, fsys := newAuthClient(t, nil)
+		ctx := context.Background()
+
+		user, err := fsys.CreateUser(ctx, "alice", false)
+		is.OK(t, err) // create user
+		file, err := fsys.Create(fs.WithUser(ctx, user), "hello.txt", strings.NewReader("Hello, World!"), uuid.Nil)
+		is.OK(t, err) // create file
+		_, token, err := fsys.CreateShare(fs.WithUser(ctx, user), file, fs.ShareOptions{TTL: time.Hour})
+		is.OK(t, err) // create share
+
+		for _, method := range []string{http.MethodGet, http.MethodHead} {
+			res, err := c.Do(ctx, method+" /s/"+token, nil, acceptAll)
+			is.OK(t, err) // return share response
+			is.Equal(t, res.StatusCode, http.StatusOK)
+			is.OK(t, res.Body.Close())
+
+			res, err = c.Do(ctx, method+" /ready", nil, acceptAll)
+			is.OK(t, err) // return ready response
+			is.Equal(t, res.StatusCode, http.StatusOK)
+			is.OK(t, res.Body.Close())
+		}
+	})
+
+	t.Run("ErrRevoked", func(t *testing.T) {
+		c, fsys := newAuthClient(t, nil)
+		ctx := context.Background()
+
+		user, err := fsys.CreateUser(ctx, "alice", false)
+		is.OK(t, err) // create user
+		token, k, err := fsys.CreateKey(ctx, user, "", 0)
+		is.OK(t, err) // create api key
+
+		res, err := c.Do(ctx, "DELETE /keys/"+k.ID.String(), nil, acceptAll, bearer(token))
+		is.OK(t, err) // return revoke key response
+		is.Equal(t, res.StatusCode, http.StatusNoContent)
+
+		res, err = c.Do(ctx, "GET /keys", nil, acceptAll, bearer(token))
+		is.OK(t, err) // return keys response
+		is.Equal(t, res.StatusCode, http.StatusUnauthorized)
+	})
+
+	t.Run("ErrPerm", func(t *testing.T) {
+		c, fsys := newAuthClient(t, nil)
+		ctx := context.Background()
+
+		alice, bob := newKey(t, fsys, "alice"), newKey(t, fsys, "bob")
+		body := fmt.Sprintf(`{"parentId":%q,"name":"src"}`, uuid.Nil)
+		res, err := c.Do(ctx, "POST /mkdir/files", strings.NewReader(body), ctJSON, acceptAll, bearer(alice))
+		is.OK(t, err) // return create folder response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+
+		var dir struct {
+			ID string `json:"folderId"`
+		}
+		err = json.NewDecoder(res.Body).Decode(&dir)
+		is.OK(t, err) // decode json payload
+		is.OK(t, res.Body.Close())
+
+		res, err = c.Do(ctx, "GET /ls/files/"+dir.ID, nil, acceptAll, bearer(bob))
+		is.OK(t, err) // return read dir response
+		is.Equal(t, res.StatusCode, http.StatusForbidden)
+	})
+}
+
+func Test_handleCapability(t *testing.T) {
+	bearer := func(token string) func(*http.Request) {
+		return func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) }
+	}
+	// setup returns a client, the directories "ingest" and "other" of a user and
+	// a capability of the user that can only upload into "ingest"
+	setup := func(tb testing.TB) (c *TestClient, user, ingest, other string, id, token string) {
+		fsys := newTestFS(tb)
+		c = newTestClient(tb, Handler(10, 200*time.Millisecond, fsys, &Auth{FS: fsys}))
+		ctx := context.Background()
+
+		alice, err := fsys.CreateUser(ctx, "alice", false)
+		is.OK(tb, err) // create user
+		user, _, err = fsys.CreateKey(ctx, alice, "", 0)
+		is.OK(tb, err) // create api key
+
+		for _, name := range []string{"ingest", "other"} {
+			body := fmt.Sprintf(`{"parentId":%q,"name":%q}`, uuid.Nil, name)
+			res, err := c.Do(ctx, "POST /mkdir/files", strings.NewReader(body), ctJSON, acceptAll, bearer(user))
+			is.OK(tb, err) // return create folder response
+			is.Equal(tb, res.StatusCode, http.StatusOK)
+
+			var dir struct {
+				ID string `json:"folderId"`
+			}
+			is.OK(tb, json.NewDecoder(res.Body).Decode(&dir))
+			is.OK(tb, res.Body.Close())
+			if name == "ingest" {
+				ingest = dir.ID
+			} else {
+				other = dir.ID
+			}
+		}
+
+		body := `{"path":"/ingest","ops":["upload"],"ttl":"1h"}`
+		res, err := c.Do(ctx, "POST /capabilities", strings.NewReader(body), ctJSON, acceptAll, bearer(user))
+		is.OK(tb, err) // return create capability response
+		is.Equal(tb, res.StatusCode, http.StatusOK)
+
+		var created struct {
+			ID    string `json:"capabilityId"`
+			Token string `json:"token"`
+		}
+		is.OK(tb, json.NewDecoder(res.Body).Decode(&created))
+		is.OK(tb, res.Body.Close())
+		return c, user, ingest, other, created.ID, created.Token
+	}
+	attenuate := func(tb testing.TB, token, caveat string) string {
+		m, err := macaroon.Parse(strings.TrimPrefix(token, fs.CapabilityPrefix))
+		is.OK(tb, err) // parse capability
+		m.Add(caveat)
+		return fs.CapabilityPrefix + m.String()
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		c, _, ingest, _, _, token := setup(t)
+
+		res, err := c.PostFormFile(context.Background(), "POST /touch/files?parent="+ingest, "testdata/hello.txt", bearer(token))
+		is.OK(t, err) // return file upload response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+	})
+
+	t.Run("ErrScope", func(t *testing.T) {
+		c, _, _, other, _, token := setup(t)
+
+		res, err := c.PostFormFile(context.Background(), "POST /touch/files?parent="+other, "testdata/hello.txt", bearer(token))
+		is.OK(t, err) // return file upload response
+		is.Equal(t, res.StatusCode, http.StatusForbidden)
+	})
+
+	t.Run("ErrOperation", func(t *testing.T) {
+		c, _, ingest, _, _, token := setup(t)
+		ctx := context.Background()
+
+		body := fmt.Sprintf(`{"parentId":%q,"name":"sub"}`, ingest)
+		res, err := c.Do(ctx, "POST /mkdir/files", strings.NewReader(body), ctJSON, acceptAll, bearer(token))
+		is.OK(t, err) // return create folder response
+		is.Equal(t, res.StatusCode, http.StatusForbidden)
+
+		res, err = c.Do(ctx, "POST /keys", strings.NewReader(`{}`), ctJSON, acceptAll, bearer(token))
+		is.OK(t, err) // return create key response
+		is.Equal(t, res.StatusCode, http.StatusForbidden)
+	})
+
+	t.Run("ErrAttenuated", func(t *testing.T) {
+		c, _, ingest, _, _, token := setup(t)
+		ctx := context.Background()
+
+		res, err := c.PostFormFile(ctx, "POST /touch/files?parent="+ingest, "testdata/hello.txt", bearer(attenuate(t, token, "ops = read")))
+		is.OK(t, err) // return file upload response
+		is.Equal(t, res.StatusCode, http.StatusForbidden)
+
+		res, err = c.PostFormFile(ctx, "POST /touch/files?parent="+ingest, "testdata/hello.txt", bearer(attenuate(t, token, "ip = 203.0.113.7")))
+		is.OK(t, err) // return file upload response
+		is.Equal(t, res.StatusCode, http.StatusUnauthorized)
+
+		res, err = c.PostFormFile(ctx, "POST /touch/files?parent="+ingest, "testdata/hello.txt", bearer(token))
+		is.OK(t, err) // return file upload response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+
+		var file struct {
+			ID string `json:"fileId"`
+		}
+		is.OK(t, json.NewDecoder(res.Body).Decode(&file))
+		is.OK(t, res.Body.Close())
+
+		res, err = c.Do(ctx, "PUT /files/"+file.ID, strings.NewReader("more than eight bytes"), acceptAll, bearer(attenuate(t, token, "max_size = 8")))
+		is.OK(t, err) // return file replace response
+		is.Equal(t, res.StatusCode, http.StatusRequestEntityTooLarge)
+	})
+
+	t.Run("ErrRevoked", func(t *testing.T) {
+		c, user, ingest, _, id, token := setup(t)
+		ctx := context.Background()
+
+		res, err := c.Do(ctx, "DELETE /capabilities/"+id, nil, acceptAll, bearer(user))
+		is.OK(t, err) // return revoke capability response
+		is.Equal(t, res.StatusCode, http.StatusNoContent)
+
+		res, err = c.PostFormFile(ctx, "POST /touch/files?parent="+ingest, "testdata/hello.txt", bearer(token))
+		is.OK(t, err) // return file upload response
+		is.Equal(t, res.StatusCode, http.StatusUnauthorized)
+	})
+}
+
+func Test_handleShare(t *testing.T) {
+	// share creates a share link of file with the options in body and returns
+	// its id and url
+	share := func(tb testing.TB, c *TestClient, file, body string) (id, url string) {
+		tb.Helper()
+
+		res, err := c.Do(context.Background(), "POST /shares/files/"+file, strings.NewReader(body), ctJSON, acceptAll)
+		is.OK(tb, err) // return create share response
+		is.Equal(tb, res.StatusCode, http.StatusOK)
+
+		var created struct {
+			ID  string `json:"shareId"`
+			URL string `json:"url"`
+		}
+		is.OK(tb, json.NewDecoder(res.Body).Decode(&created))
+		is.OK(tb, res.Body.Close())
+		return created.ID, created.URL
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		file := touch(t, c, uuid.Nil.String(), "testdata/hello.txt")
+		_, url := share(t, c, file, `{"ttl":"1h"}`)
+
+		res, err := c.Do(ctx, "GET "+url, nil, acceptAll)
+		is.OK(t, err) // return share response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+
+		b, err := io.ReadAll(res.Body)
+		is.OK(t, err) // read shared file
+		is.OK(t, res.Body.Close())
+		want, err := embedFS.ReadFile("testdata/hello.txt")
+		is.OK(t, err) // read test file
+		is.Equal(t, string(b), string(want))
+	})
+
+	t.Run("OneTime", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		file := touch(t, c, uuid.Nil.String(), "testdata/hello.txt")
+		_, url := share(t, c, file, `{"ttl":"1h","oneTime":true}`)
+
+		res, err := c.Do(ctx, "GET "+url, nil, acceptAll)
+		is.OK(t, err) // return share response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+		is.OK(t, res.Body.Close())
+
+		res, err = c.Do(ctx, "GET "+url, nil, acceptAll)
+		is.OK(t, err) // return share response
+		is.Equal(t, res.StatusCode, http.StatusNotFound)
+	})
+
+	t.Run("OneTimeRange", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		file := touch(t, c, uuid.Nil.String(), "testdata/hello.txt")
+		_, url := share(t, c, file, `{"ttl":"1h","oneTime":true}`)
+
+		// revalidations and HEAD requests are not downloads
+		res, err := c.Do(ctx, "HEAD "+url, nil, acceptAll)
+		is.OK(t, err) // return share response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+		etag := res.Header.Get("ETag")
+
+		res, err = c.Do(ctx, "GET "+url, nil, acceptAll, func(r *http.Request) { r.Header.Set("If-None-Match", etag) })
+		is.OK(t, err) // return share response
+		is.Equal(t, res.StatusCode, http.StatusNotModified)
+
+		// a part of the content of a limited link is a whole download
+		rangeOf := func(r *http.Request) { r.Header.Set("Range", "bytes=0-") }
+		res, err = c.Do(ctx, "GET "+url, nil, acceptAll, rangeOf)
+		is.OK(t, err) // return share response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+		b, err := io.ReadAll(res.Body)
+		is.OK(t, err) // read content
+		is.OK(t, res.Body.Close())
+		is.Equal(t, string(b), "hello, world!\n")
+
+		res, err = c.Do(ctx, "GET "+url, nil, acceptAll, rangeOf)
+		is.OK(t, err) // return share response
+		is.Equal(t, res.StatusCode, http.StatusNotFound)
+	})
+
+	t.Run("ACL", func(t *testing.T) {
+		fsys, ctx := newTestFS(t), context.Background()
+		c := newTestClient(t, Handler(10, 200*time.Millisecond, fsys, &Auth{FS: fsys}))
+
+		alice, err := fsys.CreateUser(ctx, "alice", false)
+		is.OK(t, err) // create user
+		bob, err := fsys.CreateUser(ctx, "bob", false)
+		is.OK(t, err) // create user
+
+		team, err := fsys.Mkdir(fs.WithUser(ctx, alice), "team", uuid.Nil)
+		is.OK(t, err) // create directory
+		is.OK(t, fsys.SetACL(fs.WithUser(ctx, alice), team, fs.ACLEntry{Principal: bob, Perm: fs.PermWrite}))
+		_, err = fsys.Create(fs.WithUser(ctx, bob), "secret.txt", strings.NewReader("Hello, World!"), team)
+		is.OK(t, err) // create file
+		de, err := fsys.Lookup(ctx, "/team/secret.txt")
+		is.OK(t, err) // lookup file
+		is.OK(t, fsys.SetACL(fs.WithUser(ctx, bob), de.ID, fs.ACLEntry{Principal: alice, Perm: fs.PermNone}))
+
+		// alice cannot share what she cannot read
+		_, token, err := fsys.CreateShare(fs.WithUser(ctx, alice), team, fs.ShareOptions{TTL: time.Hour})
+		is.OK(t, err) // create share
+		res, err := c.Do(ctx, "GET /s/"+token+"/secret.txt", nil, acceptAll)
+		is.OK(t, err) // return share response
+		is.Equal(t, res.StatusCode, http.StatusForbidden)
+
+		res, err = c.Do(ctx, "GET /s/"+token+"?format=zip", nil, acceptAll)
+		is.OK(t, err) // return share zip response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+		b, err := io.ReadAll(res.Body)
+		is.OK(t, err) // read zip
+		is.OK(t, res.Body.Close())
+		zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+		is.True(t, err != nil || len(zr.File) == 0) // the file is not archived
+	})
+
+	t.Run("Password", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		file := touch(t, c, uuid.Nil.String(), "testdata/hello.txt")
+		_, url := share(t, c, file, `{"ttl":"1h","password":"open sesame"}`)
+
+		res, err := c.Do(ctx, "GET "+url, nil, acceptAll)
+		is.OK(t, err) // return share response
+		is.Equal(t, res.StatusCode, http.StatusUnauthorized)
+
+		res, err = c.Do(ctx, "GET "+url, nil, acceptAll, func(r *http.Request) { r.SetBasicAuth("", "wrong") })
+		is.OK(t, err) // return share response
+		is.Equal(t, res.StatusCode, http.StatusForbidden)
+
+		res, err = c.Do(ctx, "GET "+url, nil, acceptAll, func(r *http.Request) { r.SetBasicAuth("", "open sesame") })
+		is.OK(t, err) // return share response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+	})
+
+	t.Run("Folder", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		parent := mkdir(t, c, uuid.Nil.String(), "private")
+		dir := mkdir(t, c, parent, "public")
+		_ = touch(t, c, dir, "testdata/hello.txt")
+		_, url := share(t, c, dir, `{"ttl":"1h"}`)
+
+		res, err := c.Do(ctx, "GET "+url, nil, acceptAll)
+		is.OK(t, err) // return share listing response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+
+		var l struct {
+			Entries []struct {
+				Path string `json:"path"`
+			} `json:"entries"`
+		}
+		is.OK(t, json.NewDecoder(res.Body).Decode(&l))
+		is.OK(t, res.Body.Close())
+		is.Equal(t, len(l.Entries), 1)
+		is.Equal(t, l.Entries[0].Path, "/public/hello.txt")
+
+		res, err = c.Do(ctx, "GET "+url+"/hello.txt", nil, acceptAll)
+		is.OK(t, err) // return share download response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+		is.OK(t, res.Body.Close())
+
+		res, err = c.Do(ctx, "GET "+url+"?format=zip", nil, acceptAll)
+		is.OK(t, err) // return share zip response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+
+		b, err := io.ReadAll(res.Body)
+		is.OK(t, err) // read zip
+		is.OK(t, res.Body.Close())
+		zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+		is.OK(t, err) // open zip
+		is.Equal(t, len(zr.File), 1)
+		is.Equal(t, zr.File[0].Name, "hello.txt")
+	})
+
+	t.Run("Revoked", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		file := touch(t, c, uuid.Nil.String(), "testdata/hello.txt")
+		id, url := share(t, c, file, `{"ttl":"1h"}`)
+
+		res, err := c.Do(ctx, "DELETE /shares/"+id, nil, acceptAll)
+		is.OK(t, err) // return revoke share response
+		is.Equal(t, res.StatusCode, http.StatusNoContent)
+
+		res, err = c.Do(ctx, "GET /shares/files/"+file, nil, acceptAll)
+		is.OK(t, err) // return shares response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+
+		var l struct {
+			Shares []struct{} `json:"shares"`
+		}
+		is.OK(t, json.NewDecoder(res.Body).Decode(&l))
+		is.OK(t, res.Body.Close())
+		is.Equal(t, len(l.Shares), 0)
+
+		res, err = c.Do(ctx, "GET "+url, nil, acceptAll)
+		is.OK(t, err) // return share response
+		is.Equal(t, res.StatusCode, http.StatusNotFound)
+	})
+
+	t.Run("ErrToken", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		res, err := c.Do(ctx, "GET /s/"+base64.RawURLEncoding.EncodeToString(make([]byte, 56)), nil, acceptAll)
+		is.OK(t, err) // return share response
+		is.Equal(t, res.StatusCode, http.StatusNotFound)
+	})
+}
+
+func Test_handleDrop(t *testing.T) {
+	// link creates an upload link of dir with the options in body and returns
+	// its id and url
+	link := func(tb testing.TB, c *TestClient, dir, body string) (id, url string) {
+		tb.Helper()
+
+		res, err := c.Do(context.Background(), "POST /uploads/files/"+dir, strings.NewReader(body), ctJSON, acceptAll)
+		is.OK(tb, err) // return create upload link response
+		is.Equal(tb, res.StatusCode, http.StatusOK)
+
+		var created struct {
+			ID  string `json:"uploadLinkId"`
+			URL string `json:"url"`
+		}
+		is.OK(tb, json.NewDecoder(res.Body).Decode(&created))
+		is.OK(tb, res.Body.Close())
+		return created.ID, created.URL
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		dir := mkdir(t, c, uuid.Nil.String(), "inbox")
+		id, url := link(t, c, dir, `{"ttl":"1h","contentTypes":["text/plain"]}`)
+
+		res, err := c.PostFormFile(ctx, "POST "+url, "testdata/hello.txt")
+		is.OK(t, err) // return drop response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+
+		var file struct {
+			ID string `json:"fileId"`
+		}
+		is.OK(t, json.NewDecoder(res.Body).Decode(&file))
+		is.OK(t, res.Body.Close())
+
+		res, err = c.Do(ctx, "GET /info/files/"+file.ID, nil, acceptAll)
+		is.OK(t, err) // return file info response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+
+		var info struct {
+			UploadLink string `json:"uploadLinkId"`
+		}
+		is.OK(t, json.NewDecoder(res.Body).Decode(&info))
+		is.OK(t, res.Body.Close())
+		is.Equal(t, info.UploadLink, id)
+	})
+
+	t.Run("NameTaken", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		dir := mkdir(t, c, uuid.Nil.String(), "inbox")
+		_, url := link(t, c, dir, `{"ttl":"1h"}`)
+
+		for range 2 {
+			res, err := c.PostFormFile(ctx, "POST "+url, "testdata/hello.txt")
+			is.OK(t, err) // return drop response
+			is.Equal(t, res.StatusCode, http.StatusOK)
+			is.OK(t, res.Body.Close())
+		}
+
+		res, err := c.Do(ctx, "GET /ls/files/"+dir, nil, acceptAll)
+		is.OK(t, err) // return listing response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+
+		var l struct {
+			Entries []struct {
+				Name string `json:"filename"`
+			} `json:"entries"`
+		}
+		is.OK(t, json.NewDecoder(res.Body).Decode(&l))
+		is.OK(t, res.Body.Close())
+		is.Equal(t, len(l.Entries), 2)
+		is.Equal(t, l.Entries[0].Name, "hello-1.txt")
+		is.Equal(t, l.Entries[1].Name, "hello.txt")
+	})
+
+	t.Run("ErrMaxFiles", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		dir := mkdir(t, c, uuid.Nil.String(), "inbox")
+		_, url := link(t, c, dir, `{"ttl":"1h","maxFiles":1}`)
+
+		res, err := c.PostFormFile(ctx, "POST "+url, "testdata/hello.txt")
+		is.OK(t, err) // return drop response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+
+		res, err = c.PostFormFile(ctx, "POST "+url, "testdata/nyantocat.gif")
+		is.OK(t, err) // return drop response
+		is.Equal(t, res.StatusCode, http.StatusNotFound)
+	})
+
+	t.Run("ErrContentType", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		dir := mkdir(t, c, uuid.Nil.String(), "inbox")
+		_, url := link(t, c, dir, `{"ttl":"1h","contentTypes":["image/*"]}`)
+
+		res, err := c.PostFormFile(ctx, "POST "+url, "testdata/hello.txt")
+		is.OK(t, err) // return drop response
+		is.Equal(t, res.StatusCode, http.StatusUnsupportedMediaType)
+
+		res, err = c.PostFormFile(ctx, "POST "+url, "testdata/nyantocat.gif")
+		is.OK(t, err) // return drop response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+	})
+
+	t.Run("ErrMaxSize", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		dir := mkdir(t, c, uuid.Nil.String(), "inbox")
+		_, url := link(t, c, dir, `{"ttl":"1h","maxSize":1024}`)
+
+		res, err := c.PostFormFile(ctx, "POST "+url, "testdata/nyantocat.gif")
+		is.OK(t, err) // return drop response
+		is.Equal(t, res.StatusCode, http.StatusRequestEntityTooLarge)
+
+		res, err = c.Do(ctx, "GET /ls/files/"+dir, nil, acceptAll)
+		is.OK(t, err) // return listing response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+
+		var l struct {
+			Entries []struct{} `json:"entries"`
+		}
+		is.OK(t, json.NewDecoder(res.Body).Decode(&l))
+		is.OK(t, res.Body.Close())
+		is.Equal(t, len(l.Entries), 0)
+	})
+
+	t.Run("ErrRevoked", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		dir := mkdir(t, c, uuid.Nil.String(), "inbox")
+		id, url := link(t, c, dir, `{"ttl":"1h"}`)
+
+		res, err := c.Do(ctx, "DELETE /uploads/"+id, nil, acceptAll)
+		is.OK(t, err) // return revoke upload link response
+		is.Equal(t, res.StatusCode, http.StatusNoContent)
+
+		res, err = c.PostFormFile(ctx, "POST "+url, "testdata/hello.txt")
+		is.OK(t, err) // return drop response
+		is.Equal(t, res.StatusCode, http.StatusNotFound)
+	})
+}
+
+func Test_handleFileMove(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		dir := mkdir(t, c, uuid.Nil.String(), "src")
+		file := touch(t, c, uuid.Nil.String(), "testdata/hello.txt")
+
+		body := fmt.Sprintf(`{"parentId":%q,"files":[{"fileId":%q,"revision":1,"name":"world.txt"}]}`, dir, file)
+		res, err := c.Do(ctx, "POST /mv/files", strings.NewReader(body), ctJSON, acceptAll)
+		is.OK(t, err) // return file move response
+		is.Equal(t, res.StatusCode, http.StatusNoContent)
+
+		res, err = c.Do(ctx, "GET /ls/files/"+dir, nil, acceptAll)
+		is.OK(t, err) // return listing response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+
+		var l struct {
+			Entries []struct {
+				ID   string `json:"fileId"`
+				Name string `json:"filename"`
+			} `json:"entries"`
+		}
+		err = json.NewDecoder(res.Body).Decode(&l)
+		is.OK(t, err) // decode json payload
+		is.OK(t, res.Body.Close())
+
+		is.Equal(t, len(l.Entries), 1)
+		is.Equal(t, l.Entries[0].ID, file)
+		is.Equal(t, l.Entries[0].Name, "world.txt")
+	})
+
+	t.Run("Many", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		dir := mkdir(t, c, uuid.Nil.String(), "src")
+		a := touch(t, c, uuid.Nil.String(), "testdata/hello.txt")
+		b := touch(t, c, uuid.Nil.String(), "testdata/nyantocat.gif")
+
+		body := fmt.Sprintf(`{"parentId":%q,"files":[{"fileId":%q,"revision":1},{"fileId":%q,"revision":1}]}`, dir, a, b)
+		res, err := c.Do(ctx, "POST /mv/files", strings.NewReader(body), ctJSON, acceptAll)
+		is.OK(t, err) // return file move response
+		is.Equal(t, res.StatusCode, http.StatusNoContent)
+	})
+
+	t.Run("ErrCycle", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		dir := mkdir(t, c, uuid.Nil.String(), "src")
+		sub := mkdir(t, c, dir, "lib")
+
+		body := fmt.Sprintf(`{"parentId":%q,"files":[{"fileId":%q,"revision":0}]}`, sub, dir)
+		res, err := c.Do(ctx, "POST /mv/files", strings.NewReader(body), ctJSON, acceptAll)
+		is.OK(t, err) // return file move response
+		is.Equal(t, res.StatusCode, http.StatusBadRequest)
+	})
+
+	t.Run("ErrAtomic", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		dir := mkdir(t, c, uuid.Nil.String(), "src")
+		a := touch(t, c, uuid.Nil.String(), "testdata/hello.txt")
+		_ = touch(t, c, dir, "testdata/hello.txt")
+		b := touch(t, c, uuid.Nil.String(), "testdata/nyantocat.gif")
+
+		// the second entry clashes so the first must not move either
+		body := fmt.Sprintf(`{"parentId":%q,"files":[{"fileId":%q,"revision":1},{"fileId":%q,"revision":1}]}`, dir, b, a)
+		res, err := c.Do(ctx, "POST /mv/files", strings.NewReader(body), ctJSON, acceptAll)
+		is.OK(t, err) // return file move response
+		is.Equal(t, res.StatusCode, http.StatusConflict)
+
+		res, err = c.Do(ctx, "GET /ls/files/"+uuid.Nil.String(), nil, acceptAll)
+		is.OK(t, err) // return listing response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+
+		var l struct {
+			Entries []struct{} `json:"entries"`
+		}
+		err = json.NewDecoder(res.Body).Decode(&l)
+		is.OK(t, err) // decode json payload
+		is.OK(t, res.Body.Close())
+		is.Equal(t, len(l.Entries), 3) // src, hello.txt & nyantocat.gif
+	})
+}
+
+func Test_handleFileCopy(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		dir := mkdir(t, c, uuid.Nil.String(), "src")
+		_ = mkdir(t, c, dir, "lib")
+		_ = touch(t, c, dir, "testdata/hello.txt")
+		dst := mkdir(t, c, uuid.Nil.String(), "dst")
+
+		body := fmt.Sprintf(`{"parentId":%q,"files":[{"fileId":%q}]}`, dst, dir)
+		res, err := c.Do(ctx, "POST /cp/files", strings.NewReader(body), ctJSON, acceptAll)
+		is.OK(t, err) // return file copy response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+
+		var copied struct {
+			Files []struct {
+				ID string `json:"fileId"`
+			} `json:"files"`
+		}
+		err = json.NewDecoder(res.Body).Decode(&copied)
+		is.OK(t, err) // decode json payload
+		is.OK(t, res.Body.Close())
+		is.Equal(t, len(copied.Files), 1)
+
+		res, err = c.Do(ctx, "GET /ls/files/"+copied.Files[0].ID, nil, acceptAll)
+		is.OK(t, err) // return listing response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+
+		var l struct {
+			Entries []struct {
+				ID   string `json:"fileId"`
+				Name string `json:"filename"`
+				Size int64  `json:"size"`
+			} `json:"entries"`
+		}
+		err = json.NewDecoder(res.Body).Decode(&l)
+		is.OK(t, err) // decode json payload
+		is.OK(t, res.Body.Close())
+		is.Equal(t, len(l.Entries), 2) // hello.txt & lib
+		is.Equal(t, l.Entries[0].Size, 14)
+
+		// the copy shares the content of the original
+		res, err = c.Do(ctx, "GET /files/"+l.Entries[0].ID, nil, acceptAll)
+		is.OK(t, err) // return download response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+
+		n, err := io.Copy(io.Discard, res.Body)
+		is.OK(t, err) // read content into discard
+		is.OK(t, res.Body.Close())
+		is.Equal(t, n, 14) // got;want
+	})
+
+	t.Run("Conflict", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		file := touch(t, c, uuid.Nil.String(), "testdata/hello.txt")
+
+		type testcase struct {
+			conflict   string
+			statusCode int
+		}
+
+		for _, tc := range []testcase{
+			{conflict: "fail", statusCode: http.StatusConflict},
+			{conflict: "rename", statusCode: http.StatusOK},
+			{conflict: "replace", statusCode: http.StatusOK},
+		} {
+			body := fmt.Sprintf(`{"files":[{"fileId":%q}],"conflict":%q}`, file, tc.conflict)
+			res, err := c.Do(ctx, "POST /cp/files", strings.NewReader(body), ctJSON, acceptAll)
+			is.OK(t, err) // return file copy response
+			is.Equal(t, res.StatusCode, tc.statusCode)
+		}
+
+		res, err := c.Do(ctx, "GET /ls/files/"+uuid.Nil.String(), nil, acceptAll)
+		is.OK(t, err) // return listing response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+
+		var l struct {
+			Entries []struct {
+				Name string `json:"filename"`
+			} `json:"entries"`
+		}
+		err = json.NewDecoder(res.Body).Decode(&l)
+		is.OK(t, err) // decode json payload
+		is.OK(t, res.Body.Close())
+		is.Equal(t, len(l.Entries), 2)
+		is.Equal(t, l.Entries[0].Name, "hello-1.txt")
+	})
+}
+
+func Test_handleFileRemove(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		dir := mkdir(t, c, uuid.Nil.String(), "src")
+		_ = touch(t, c, dir, "testdata/hello.txt")
+
+		body := fmt.Sprintf(`{"files":[{"fileId":%q,"revision":0}]}`, dir)
+		res, err := c.Do(ctx, "POST /rm/files", strings.NewReader(body), ctJSON, acceptAll)
+		is.OK(t, err) // return file remove response
+		is.Equal(t, res.StatusCode, http.StatusNoContent)
+
+		res, err = c.Do(ctx, "GET /ls/files/"+uuid.Nil.String(), nil, acceptAll)
+		is.OK(t, err) // return listing response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+
+		var l struct {
+			Entries []struct {
+				ID string `json:"fileId"`
+			} `json:"entries"`
+		}
+		err = json.NewDecoder(res.Body).Decode(&l)
+		is.OK(t, err) // decode json payload
+		is.OK(t, res.Body.Close())
+		is.Equal(t, len(l.Entries), 0)
+
+		// the contents of a removed folder cannot be listed
+		res, err = c.Do(ctx, "GET /ls/files/"+dir, nil, acceptAll)
+		is.OK(t, err) // return listing response
+		is.Equal(t, res.StatusCode, http.StatusNotFound)
+
+		res, err = c.Do(ctx, "GET /trash", nil, acceptAll)
+		is.OK(t, err) // return trash response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+
+		var trash struct {
+			Entries []struct {
+				ID   string `json:"fileId"`
+				Name string `json:"filename"`
+			} `json:"entries"`
+		}
+		err = json.NewDecoder(res.Body).Decode(&trash)
+		is.OK(t, err) // decode json payload
+		is.OK(t, res.Body.Close())
+		is.Equal(t, len(trash.Entries), 1)
+		is.Equal(t, trash.Entries[0].ID, dir)
+		is.Equal(t, trash.Entries[0].Name, "src")
+	})
+
+	t.Run("ErrRevision", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		file := touch(t, c, uuid.Nil.String(), "testdata/hello.txt")
+
+		body := fmt.Sprintf(`{"files":[{"fileId":%q,"revision":2}]}`, file)
+		res, err := c.Do(ctx, "POST /rm/files", strings.NewReader(body), ctJSON, acceptAll)
+		is.OK(t, err) // return file remove response
+		is.Equal(t, res.StatusCode, http.StatusNotFound)
+	})
+}
+
+func Test_handleFileRestore(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		file := touch(t, c, uuid.Nil.String(), "testdata/hello.txt")
+
+		body := fmt.Sprintf(`{"files":[{"fileId":%q,"revision":1}]}`, file)
+		res, err := c.Do(ctx, "POST /rm/files", strings.NewReader(body), ctJSON, acceptAll)
+		is.OK(t, err) // return file remove response
+		is.Equal(t, res.StatusCode, http.StatusNoContent)
+
+		res, err = c.Do(ctx, "POST /restore/files/"+file, nil, acceptAll)
+		is.OK(t, err) // return file restore response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+		is.OK(t, res.Body.Close())
+
+		res, err = c.Do(ctx, "GET /files/"+file, nil, acceptAll)
+		is.OK(t, err) // return download response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+
+		n, err := io.Copy(io.Discard, res.Body)
+		is.OK(t, err) // read content into discard
+		is.OK(t, res.Body.Close())
+		is.Equal(t, n, 14) // got;want
+	})
+
+	t.Run("Conflict", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		file := touch(t, c, uuid.Nil.String(), "testdata/hello.txt")
+
+		body := fmt.Sprintf(`{"files":[{"fileId":%q,"revision":1}]}`, file)
+		res, err := c.Do(ctx, "POST /rm/files", strings.NewReader(body), ctJSON, acceptAll)
+		is.OK(t, err) // return file remove response
+		is.Equal(t, res.StatusCode, http.StatusNoContent)
+
+		// the name is free to reuse once removed
+		_ = touch(t, c, uuid.Nil.String(), "testdata/hello.txt")
+
+		res, err = c.Do(ctx, "POST /restore/files/"+file, nil, acceptAll)
+		is.OK(t, err) // return file restore response
+		is.Equal(t, res.StatusCode, http.StatusConflict)
+
+		res, err = c.Do(ctx, "POST /restore/files/"+file+"?conflict=rename", nil, acceptAll)
+		is.OK(t, err) // return file restore response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+
+		var restored struct {
+			Name string `json:"filename"`
+		}
+		err = json.NewDecoder(res.Body).Decode(&restored)
+		is.OK(t, err) // decode json payload
+		is.OK(t, res.Body.Close())
+		is.Equal(t, restored.Name, "hello-1.txt")
+	})
+}
+
+func Test_handleFileVersions(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		file := touch(t, c, uuid.Nil.String(), "testdata/hello.txt")
+
+		// reverting to the first version adds it again as the latest
+		body := `{"version":1,"revision":1}`
+		res, err := c.Do(ctx, "POST /revert/files/"+file, strings.NewReader(body), ctJSON, acceptAll)
+		is.OK(t, err) // return file revert response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+
+		var reverted struct {
+			Revision uint64 `json:"revision"`
+		}
+		err = json.NewDecoder(res.Body).Decode(&reverted)
+		is.OK(t, err) // decode json payload
+		is.OK(t, res.Body.Close())
+		is.Equal(t, reverted.Revision, 2)
+
+		vs := versions(t, c, file)
+		is.Equal(t, len(vs), 2)
+		is.Equal(t, vs[0].Version, 2) // most recent first
+		is.Equal(t, vs[0].SHA, vs[1].SHA)
+
+		res, err = c.Do(ctx, "GET /files/"+file+"?version=1", nil, acceptAll)
+		is.OK(t, err) // return download response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+
+		n, err := io.Copy(io.Discard, res.Body)
+		is.OK(t, err) // read content into discard
+		is.OK(t, res.Body.Close())
+		is.Equal(t, n, 14) // got;want
+	})
+
+	t.Run("MaxVersions", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		file := touch(t, c, uuid.Nil.String(), "testdata/hello.txt")
+
+		body := `{"version":1,"revision":1}`
+		res, err := c.Do(ctx, "POST /revert/files/"+file, strings.NewReader(body), ctJSON, acceptAll)
+		is.OK(t, err) // return file revert response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+
+		res, err = c.Do(ctx, "PATCH /versions/files/"+file, strings.NewReader(`{"maxVersions":1}`), ctJSON, acceptAll)
+		is.OK(t, err) // return set max versions response
+		is.Equal(t, res.StatusCode, http.StatusNoContent)
+
+		vs := versions(t, c, file)
+		is.Equal(t, len(vs), 1)
+		is.Equal(t, vs[0].Version, 2)
+
+		// the pruned version cannot be downloaded
+		res, err = c.Do(ctx, "GET /files/"+file+"?version=1", nil, acceptAll)
+		is.OK(t, err) // return download response
+		is.Equal(t, res.StatusCode, http.StatusNotFound)
+
+		// the latest version shares the object of the pruned version
+		res, err = c.Do(ctx, "GET /files/"+file, nil, acceptAll)
+		is.OK(t, err) // return download response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+
+		n, err := io.Copy(io.Discard, res.Body)
+		is.OK(t, err) // read content into discard
+		is.OK(t, res.Body.Close())
+		is.Equal(t, n, 14) // got;want
+	})
+
+	t.Run("ErrRevision", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		file := touch(t, c, uuid.Nil.String(), "testdata/hello.txt")
+
+		for _, body := range []string{
+			`{"version":1,"revision":2}`, // stale revision
+			`{"version":2,"revision":1}`, // missing version
+		} {
+			res, err := c.Do(ctx, "POST /revert/files/"+file, strings.NewReader(body), ctJSON, acceptAll)
+			is.OK(t, err) // return file revert response
+			is.Equal(t, res.StatusCode, http.StatusNotFound)
+		}
+		is.Equal(t, len(versions(t, c, file)), 1)
+	})
+}
+
+func Test_handleFileReplace(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		file := touch(t, c, uuid.Nil.String(), "testdata/hello.txt")
+
+		res, err := c.Do(ctx, "PUT /files/"+file+"?revision=1", strings.NewReader("Hello, World!"), acceptAll)
+		is.OK(t, err) // return file replace response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+
+		var replaced struct {
+			Revision uint64 `json:"revision"`
+		}
+		err = json.NewDecoder(res.Body).Decode(&replaced)
+		is.OK(t, err) // decode json payload
+		is.OK(t, res.Body.Close())
+		is.Equal(t, replaced.Revision, 2)
+
+		res, err = c.Do(ctx, "GET /files/"+file, nil, acceptAll)
+		is.OK(t, err) // return download response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+
+		n, err := io.Copy(io.Discard, res.Body)
+		is.OK(t, err) // read content into discard
+		is.OK(t, res.Body.Close())
+		is.Equal(t, n, 13) // got;want
+		is.Equal(t, len(versions(t, c, file)), 2)
+	})
+
+	t.Run("IfMatch", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		file := touch(t, c, uuid.Nil.String(), "testdata/hello.txt")
+
+		res, err := c.Do(ctx, "GET /files/"+file, nil, acceptAll)
+		is.OK(t, err) // return download response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+		is.OK(t, res.Body.Close())
+		etag := res.Header.Get("ETag")
+
+		ifMatch := func(r *http.Request) { r.Header.Set("If-Match", etag) }
+		res, err = c.Do(ctx, "PUT /files/"+file, strings.NewReader("Hello, World!"), acceptAll, ifMatch)
+		is.OK(t, err) // return file replace response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+		is.OK(t, res.Body.Close())
+
+		// the etag is of the content that was replaced
+		res, err = c.Do(ctx, "PUT /files/"+file, strings.NewReader("Hello, World!"), acceptAll, ifMatch)
+		is.OK(t, err) // return file replace response
+		is.Equal(t, res.StatusCode, http.StatusPreconditionFailed)
+	})
+
+	t.Run("ErrPrecondition", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		file := touch(t, c, uuid.Nil.String(), "testdata/hello.txt")
+
+		type testcase struct {
+			query      string
+			statusCode int
+		}
+
+		for _, tc := range []testcase{
+			{query: "", statusCode: http.StatusPreconditionRequired},
+			{query: "?revision=0", statusCode: http.StatusPreconditionFailed},
+			{query: "?revision=2", statusCode: http.StatusPreconditionFailed},
+		} {
+			res, err := c.Do(ctx, "PUT /files/"+file+tc.query, strings.NewReader("Hello, World!"), acceptAll)
+			is.OK(t, err) // return file replace response
+			is.Equal(t, res.StatusCode, tc.statusCode)
+		}
+		is.Equal(t, len(versions(t, c, file)), 1)
+	})
+}
+
+func Test_handleFileCreateByHash(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		_ = touch(t, c, uuid.Nil.String(), "testdata/hello.txt")
+
+		p, err := os.ReadFile("testdata/hello.txt")
+		is.OK(t, err) // read test file
+		sum := sha256.Sum256(p)
+
+		body := fmt.Sprintf(`{"filename":"world.txt","sha256":%q,"size":%d}`, hex.EncodeToString(sum[:]), len(p))
+		res, err := c.Do(ctx, "POST /dedup/files", strings.NewReader(body), ctJSON, acceptAll)
+		is.OK(t, err) // return file create response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+
+		var file struct {
+			ID string `json:"fileId"`
+		}
+		err = json.NewDecoder(res.Body).Decode(&file)
+		is.OK(t, err) // decode json payload
+		is.OK(t, res.Body.Close())
+
+		res, err = c.Do(ctx, "GET /files/"+file.ID, nil, acceptAll)
+		is.OK(t, err) // return download response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+
+		n, err := io.Copy(io.Discard, res.Body)
+		is.OK(t, err) // read content into discard
+		is.OK(t, res.Body.Close())
+		is.Equal(t, n, int64(len(p))) // got;want
+	})
+
+	t.Run("ErrNotFound", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		sum := sha256.Sum256([]byte("Hello, World!"))
+		body := fmt.Sprintf(`{"filename":"world.txt","sha256":%q,"size":13}`, hex.EncodeToString(sum[:]))
+		res, err := c.Do(ctx, "POST /dedup/files", strings.NewReader(body), ctJSON, acceptAll)
+		is.OK(t, err) // return file create response
+		is.Equal(t, res.StatusCode, http.StatusNotFound)
+	})
+
+	t.Run("Upload", func(t *testing.T) {
+		fsys, ctx := newTestFS(t), context.Background()
+		c := newTestClient(t, Handler(10, 200*time.Millisecond, fsys, nil))
+
+		// identical content is stored once
+		_ = touch(t, c, uuid.Nil.String(), "testdata/hello.txt")
+		dir := mkdir(t, c, uuid.Nil.String(), "src")
+		_ = touch(t, c, dir, "testdata/hello.txt")
+
+		stats, err := fsys.GC(ctx, fs.GCOptions{Before: time.Now().Add(time.Minute), DryRun: true})
+		is.OK(t, err) // report unreferenced blobs
+		is.Equal(t, stats.Scanned, 1)
+		is.Equal(t, stats.Orphaned, 0)
+	})
+}
+
+func Test_handleTus(t *testing.T) {
+	tus := func(r *http.Request) { r.Header.Set("Tus-Resumable", "1.0.0") }
+	create := func(tb testing.TB, c *TestClient, length int) string {
+		tb.Helper()
+
+		metadata := func(r *http.Request) {
+			r.Header.Set("Upload-Length", strconv.Itoa(length))
+			r.Header.Set("Upload-Metadata", "filename "+base64.StdEncoding.EncodeToString([]byte("hello.txt")))
+		}
+		res, err := c.Do(context.Background(), "POST /tus/files", nil, tus, metadata)
+		is.OK(tb, err) // return tus create response
+		is.Equal(tb, res.StatusCode, http.StatusCreated)
+		is.OK(tb, res.Body.Close())
+		return res.Header.Get("Location")
+	}
+	patch := func(off int, checksum string) func(r *http.Request) {
+		return func(r *http.Request) {
+			r.Header.Set("Content-Type", "application/offset+octet-stream")
+			r.Header.Set("Upload-Offset", strconv.Itoa(off))
+			if checksum != "" {
+				r.Header.Set("Upload-Checksum", checksum)
+			}
+		}
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		loc := create(t, c, 13)
+
+		res, err := c.Do(ctx, "PATCH "+loc, strings.NewReader("Hello, "), tus, patch(0, ""))
+		is.OK(t, err) // return tus patch response
+		is.Equal(t, res.StatusCode, http.StatusNoContent)
+		is.Equal(t, res.Header.Get("Upload-Offset"), "7")
+
+		res, err = c.Do(ctx, "HEAD "+loc, nil, tus)
+		is.OK(t, err) // return tus head response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+		is.Equal(t, res.Header.Get("Upload-Offset"), "7")
+		is.Equal(t, res.Header.Get("Upload-Length"), "13")
+
+		sum := sha256.Sum256([]byte("World!"))
+		checksum := "sha256 " + base64.StdEncoding.EncodeToString(sum[:])
+		res, err = c.Do(ctx, "PATCH "+loc, strings.NewReader("World!"), tus, patch(7, checksum))
+		is.OK(t, err) // return tus patch response
+		is.Equal(t, res.StatusCode, http.StatusNoContent)
+		is.Equal(t, res.Header.Get("Upload-Offset"), "13")
+		file := res.Header.Get("File-Id")
+
+		res, err = c.Do(ctx, "GET /files/"+file, nil, acceptAll)
+		is.OK(t, err) // return download response
+		is.Equal(t, res.StatusCode, http.StatusOK)
+
+		p, err := io.ReadAll(res.Body)
+		is.OK(t, err) // read content
+		is.OK(t, res.Body.Close())
+		is.Equal(t, string(p), "Hello, World!")
+	})
+
+	t.Run("ErrChecksum", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		loc := create(t, c, 13)
+
+		sum := sha1.Sum([]byte("Hello, World?"))
+		checksum := "sha1 " + base64.StdEncoding.EncodeToString(sum[:])
+		res, err := c.Do(ctx, "PATCH "+loc, strings.NewReader("Hello, World!"), tus, patch(0, checksum))
+		is.OK(t, err) // return tus patch response
+		is.Equal(t, res.StatusCode, 460)
+
+		// the chunk was discarded
+		res, err = c.Do(ctx, "HEAD "+loc, nil, tus)
+		is.OK(t, err) // return tus head response
+		is.Equal(t, res.Header.Get("Upload-Offset"), "0")
+	})
+
+	t.Run("ErrConflict", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		loc := create(t, c, 13)
+
+		res, err := c.Do(ctx, "PATCH "+loc, strings.NewReader("World!"), tus, patch(7, ""))
+		is.OK(t, err) // return tus patch response
+		is.Equal(t, res.StatusCode, http.StatusConflict)
+	})
+
+	t.Run("Terminate", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		loc := create(t, c, 13)
+
+		res, err := c.Do(ctx, "DELETE "+loc, nil, tus)
+		is.OK(t, err) // return tus terminate response
+		is.Equal(t, res.StatusCode, http.StatusNoContent)
+
+		res, err = c.Do(ctx, "HEAD "+loc, nil, tus)
+		is.OK(t, err) // return tus head response
+		is.Equal(t, res.StatusCode, http.StatusNotFound)
+	})
+
+	t.Run("ErrVersion", func(t *testing.T) {
+		c, ctx := newClient(t), context.Background()
+
+		res, err := c.Do(ctx, "POST /tus/files", nil)
+		is.OK(t, err) // return tus create response
+		is.Equal(t, res.StatusCode, http.StatusPreconditionFailed)
+		is.Equal(t, res.Header.Get("Tus-Version"), "1.0.0")
+	})
+}
+
+type version struct {
+	Version uint64 `json:"version"`
+	SHA     string `json:"sha256"`
+}
+
+// versions returns the versions of file, most recent first.
+func versions(tb testing.TB, c *TestClient, file string) []version {
+	tb.Helper()
+
+	res, err := c.Do(context.Background(), "GET /versions/files/"+file, nil, acceptAll)
+	is.OK(tb, err) // return file versions response
+	is.Equal(tb, res.StatusCode, http.StatusOK)
+
+	var l struct {
+		Versions []version `json:"versions"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&l)
+	is.OK(tb, err) // decode json payload
+	is.OK(tb, res.Body.Close())
+	return l.Versions
+}
+
+// mkdir creates a folder within parent and returns its id.
+func mkdir(tb testing.TB, c *TestClient, parent, name string) string {
+	tb.Helper()
+
+	body := fmt.Sprintf(`{"parentId":%q,"name":%q}`, parent, name)
+	res, err := c.Do(context.Background(), "POST /mkdir/files", strings.NewReader(body), ctJSON, acceptAll)
+	is.OK(tb, err) // return create folder response
+	is.Equal(tb, res.StatusCode, http.StatusOK)
+
+	var file struct {
+		ID string `json:"folderId"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&file)
+	is.OK(tb, err) // decode json payload
+	is.OK(tb, res.Body.Close())
+	return file.ID
+}
+
+// touch uploads the file within parent and returns its id.
+func touch(tb testing.TB, c *TestClient, parent, filename string) string {
+	tb.Helper()
+
+	res, err := c.PostFormFile(context.Background(), "POST /touch/files?parent="+parent, filename)
+	is.OK(tb, err) // return file upload response
+	is.Equal(tb, res.StatusCode, http.StatusOK)
+
+	var file struct {
+		ID string `json:"fileId"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&file)
+	is.OK(tb, err) // decode json payload
+	is.OK(tb, res.Body.Close())
+	return file.ID
 }
 
 var acceptAll = func(r *http.Request) { r.Header.Set("Accept", "*/*") }
@@ -266,7 +2263,7 @@ func newClient(tb testing.TB) *TestClient {
 		fsys = newTestFS(tb)
 	)
 	// high burst, short ttl
-	tc := newTestClient(tb, Handler(10, 200*time.Millisecond, fsys))
+	tc := newTestClient(tb, Handler(10, 200*time.Millisecond, fsys, nil))
 	// https://speed.cloudflare.com/
 	bu, err := tc.AddToxic("bandwidth", true, &toxics.BandwidthToxic{Rate: 72.8 * 1000})
 	is.OK(tb, err) // return bandwidth upstream toxic
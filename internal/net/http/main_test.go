@@ -3,33 +3,21 @@ package http_test
 import (
 	"context"
 	"embed"
-	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
-	"os"
 	"strings"
 	"testing"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/testcontainers/testcontainers-go"
-	"github.com/testcontainers/testcontainers-go/modules/cockroachdb"
-	"github.com/testcontainers/testcontainers-go/modules/minio"
-	"go.adoublef/eyeoh/internal/blob"
-	"go.adoublef/eyeoh/internal/database/crdb"
 	"go.adoublef/eyeoh/internal/fs"
 	. "go.adoublef/eyeoh/internal/net/http"
 	"go.adoublef/eyeoh/internal/net/http/httputil"
 	"go.adoublef/eyeoh/internal/net/nettest"
 	"go.adoublef/eyeoh/internal/testing/is"
-	"go.adoublef/eyeoh/internal/testing/texttest"
+	"go.adoublef/eyeoh/internal/testing/storetest"
 )
 
 //go:embed all:testdata/*
@@ -43,7 +31,7 @@ type TestClient struct {
 }
 
 // PostFormFile issues a multipart POST to the specified URL, with a file as the request body.
-func (tc *TestClient) PostFormFile(ctx context.Context, pattern string, filename string) (*http.Response, error) {
+func (tc *TestClient) PostFormFile(ctx context.Context, pattern string, filename string, opts ...func(*http.Request)) (*http.Response, error) {
 	f, err := embedFS.Open(filename)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file: %v", err)
@@ -84,7 +72,7 @@ func (tc *TestClient) PostFormFile(ctx context.Context, pattern string, filename
 		r.Header.Set("Accept", "*/*")
 		// set encoding?
 	}
-	return tc.Do(ctx, pattern, pr, o)
+	return tc.Do(ctx, pattern, pr, append([]func(*http.Request){o}, opts...)...)
 }
 
 // Do sends an HTTP request and returns an HTTP response. The pattern follows similar rules to [http.ServeMux] in Go1.23.
@@ -130,50 +118,12 @@ func newTestClient(tb testing.TB, h http.Handler) *TestClient {
 }
 
 // newTestFS returns a [fs.FS] for use within tests.
-// Each dependency sits behind a proxy that can simulate network failures.
+// The database sits behind a proxy that can simulate network failures.
 func newTestFS(tb testing.TB) *fs.FS {
 	tb.Helper()
-	ctx := context.Background()
-
-	minioURL, err := compose.minio.ConnectionString(ctx)
-	is.OK(tb, err) // return minio connetion string
-
-	var (
-		bucket = texttest.Bucket(61) // random
-		region = "auto"
-
-		user = compose.minio.Username
-		pass = compose.minio.Password
-		cred = credentials.NewStaticCredentialsProvider(user, pass, "")
-	)
-
-	conf, err := config.LoadDefaultConfig(context.TODO(),
-		config.WithRegion(region), config.WithCredentialsProvider(cred))
-	is.OK(tb, err) // return minio configuration
-
-	// Create S3 service c
-	// add toxiproxy (MINIO_ + tb.Name)
-	c := s3.NewFromConfig(conf, func(o *s3.Options) {
-		o.BaseEndpoint = aws.String("http://" + minioURL)
-		o.UsePathStyle = true
-	})
-
-	// Create a new bucket using the CreateBucket call.
-	// note: StatusCode: 409, BucketAlreadyOwnedByYou
-	// note: StatusCode: 507, XMinioStorageFull
-	p := &s3.CreateBucketInput{
-		Bucket: &bucket,
-	}
-	_, err = c.CreateBucket(ctx, p)
-	is.OK(tb, err) // create bucket
-
-	crdbDSN, err := compose.crdb.ConnectionString(ctx)
-	is.OK(tb, err) // return cockroachdb connection string
-
-	is.OK(tb, crdb.Up(ctx, crdbDSN)) // run migration scripts
-	tb.Cleanup(func() { is.OK(tb, crdb.Down(ctx, crdbDSN)) })
 
-	crdbURL, err := url.Parse(crdbDSN)
+	store := storetest.New(tb)
+	crdbURL, err := url.Parse(store.DatabaseURL)
 	is.OK(tb, err) // parse cockroachdb url
 
 	proxyCRDB := nettest.NewProxy("CRDB_"+tb.Name(), crdbURL.Host)
@@ -181,59 +131,11 @@ func newTestFS(tb testing.TB) *fs.FS {
 	// postgres://<username>:<password>@<host>:<port>/<database>?<parameters>
 	_, port, _ := strings.Cut(proxyCRDB.Listen(), ":")
 	crdbURL.Host = "localhost:" + port
-	/* create db connection */
-	pool, err := pgxpool.New(ctx, crdbURL.String())
-	is.OK(tb, err)
-	tb.Cleanup(func() { pool.Close() })
-
-	return &fs.FS{
-		DB:         &fs.DB{RWC: pool},
-		Uploader:   blob.NewUploader(bucket, c),
-		Downloader: blob.NewDownloader(bucket, c),
-	}
-}
-
-// compose is a global handler for containers required.
-var compose struct {
-	minio *minio.MinioContainer
-	crdb  *cockroachdb.CockroachDBContainer
-}
-
-func TestMain(m *testing.M) {
-	err := setup(context.Background())
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "%v\n", err)
-		os.Exit(1)
-	}
-	code := m.Run()
-	err = cleanup(context.Background())
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "%v\n", err)
-		os.Exit(1)
-	}
-	os.Exit(code)
-}
+	store.DatabaseURL = crdbURL.String()
 
-// setup initialises containers within the pacakge.
-func setup(ctx context.Context) (err error) {
-	compose.minio, err = minio.Run(ctx, "minio/minio:RELEASE.2024-01-16T16-07-38Z")
-	if err != nil {
-		return err
-	}
-	compose.crdb, err = cockroachdb.Run(ctx, "cockroachdb/cockroach:v22.2.3")
-	if err != nil {
-		return
-	}
-	return
+	fsys := store.FS(tb)
+	fsys.ShareKey = []byte("test share key")
+	return fsys
 }
 
-// cleanup stops all running containers for the pacakge.
-func cleanup(ctx context.Context) (err error) {
-	var cc = []testcontainers.Container{compose.minio, compose.crdb}
-	for _, c := range cc {
-		if c != nil {
-			err = errors.Join(c.Terminate(ctx))
-		}
-	}
-	return err
-}
+func TestMain(m *testing.M) { storetest.Main(m) }
@@ -0,0 +1,117 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.adoublef/eyeoh/internal/fs"
+)
+
+var preconditionFailedHandler = statusHandler{http.StatusPreconditionFailed, `file was modified`}
+
+// revisionTag returns the entity tag of the metadata of file at revision v. It
+// changes whenever the file is renamed, moved or written.
+func revisionTag(file uuid.UUID, v uint64) string {
+	return fmt.Sprintf(`"%s.%d"`, file, v)
+}
+
+// entityTags returns the entity tags a client may hold for file at revision v,
+// of its metadata and, if it has any, of its content.
+func entityTags(file uuid.UUID, v uint64, etag fs.Etag) []string {
+	tags := []string{revisionTag(file, v)}
+	if len(etag) > 0 {
+		tags = append(tags, `"`+etag.String()+`"`)
+	}
+	return tags
+}
+
+// setValidators sets the ETag and Last-Modified headers of a response.
+func setValidators(w http.ResponseWriter, etag string, modTime time.Time) {
+	w.Header().Set("ETag", etag)
+	if !modTime.IsZero() {
+		w.Header().Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	}
+}
+
+// checkPreconditions evaluates the conditional headers of r against the current
+// entity tags and modification time of the resource, in the order of RFC 9110
+// section 13.2.2. It returns the status to reply with, or 0 if the request
+// should be served. Downloads are evaluated by [http.ServeContent] instead.
+func checkPreconditions(r *http.Request, etags []string, modTime time.Time) int {
+	modTime = modTime.Truncate(time.Second)
+	safe := r.Method == http.MethodGet || r.Method == http.MethodHead
+
+	if im := r.Header.Get("If-Match"); im != "" {
+		if !matchAny(im, etags, false) {
+			return http.StatusPreconditionFailed
+		}
+	} else if t, err := http.ParseTime(r.Header.Get("If-Unmodified-Since")); err == nil && modTime.After(t) {
+		return http.StatusPreconditionFailed
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if matchAny(inm, etags, true) {
+			if safe {
+				return http.StatusNotModified
+			}
+			return http.StatusPreconditionFailed
+		}
+	} else if t, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && safe && !modTime.After(t) {
+		return http.StatusNotModified
+	}
+	return 0
+}
+
+// matchAny reports whether the header value h of a list of entity tags matches
+// any of etags. A weak comparison ignores the weak indicator, otherwise weak
+// tags never match. See RFC 9110 section 8.8.3.2.
+func matchAny(h string, etags []string, weak bool) bool {
+	for _, s := range strings.Split(h, ",") {
+		s = strings.TrimSpace(s)
+		if s == "*" {
+			return true
+		}
+		if weak {
+			s = strings.TrimPrefix(s, "W/")
+		}
+		for _, etag := range etags {
+			if s == etag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writePrecondition replies with the status of a failed precondition.
+func writePrecondition(w http.ResponseWriter, r *http.Request, code int) {
+	if code == http.StatusNotModified {
+		// the validators are kept, but there is no content
+		h := w.Header()
+		delete(h, "Content-Type")
+		delete(h, "Content-Length")
+		w.WriteHeader(code)
+		return
+	}
+	preconditionFailedHandler.ServeHTTP(w, r)
+}
+
+// revisionOf returns the revision of file if the If-Match and If-Unmodified-Since
+// headers of r hold for it, so that a change can be made only to the file the
+// client has seen. ok is false if r has neither header.
+func revisionOf(fsys *fs.FS, r *http.Request, file uuid.UUID) (v uint64, ok bool, err error) {
+	if r.Header.Get("If-Match") == "" && r.Header.Get("If-Unmodified-Since") == "" {
+		return 0, false, nil
+	}
+	fi, v, etag, err := fsys.Stat(r.Context(), file)
+	if err != nil {
+		return 0, true, err
+	}
+	if checkPreconditions(r, entityTags(file, v, etag), fi.ModTime) != 0 {
+		return 0, true, preconditionFailedHandler
+	}
+	return v, true, nil
+}
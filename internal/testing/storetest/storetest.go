@@ -0,0 +1,152 @@
+// Package storetest runs the cockroachdb and minio containers that back a
+// [fs.FS], for the tests of the packages that use one. The containers are
+// started by the first call to [New].
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/cockroachdb"
+	"github.com/testcontainers/testcontainers-go/modules/minio"
+	"go.adoublef/eyeoh/internal/blob"
+	"go.adoublef/eyeoh/internal/database/crdb"
+	"go.adoublef/eyeoh/internal/fs"
+	"go.adoublef/eyeoh/internal/testing/is"
+	"go.adoublef/eyeoh/internal/testing/texttest"
+)
+
+// compose is a global handler for containers required.
+var compose struct {
+	once  sync.Once
+	err   error
+	minio *minio.MinioContainer
+	crdb  *cockroachdb.CockroachDBContainer
+}
+
+// Main runs the tests of m and stops the containers if any test started them.
+// It is called from TestMain.
+func Main(m *testing.M) {
+	code := m.Run()
+	err := cleanup(context.Background())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(code)
+}
+
+// setup initialises containers within the pacakge.
+func setup(ctx context.Context) (err error) {
+	compose.minio, err = minio.Run(ctx, "minio/minio:RELEASE.2024-01-16T16-07-38Z")
+	if err != nil {
+		return err
+	}
+	compose.crdb, err = cockroachdb.Run(ctx, "cockroachdb/cockroach:v22.2.3")
+	if err != nil {
+		return
+	}
+	return
+}
+
+// cleanup stops all running containers for the pacakge.
+func cleanup(ctx context.Context) (err error) {
+	var cc []testcontainers.Container
+	// a container that was not started is a typed nil
+	if compose.minio != nil {
+		cc = append(cc, compose.minio)
+	}
+	if compose.crdb != nil {
+		cc = append(cc, compose.crdb)
+	}
+	for _, c := range cc {
+		err = errors.Join(err, c.Terminate(ctx))
+	}
+	return err
+}
+
+// Store is the connection to the containers, with a bucket of its own.
+type Store struct {
+	// DatabaseURL is the cockroachdb connection string. It can be replaced
+	// before [Store.FS] is called, such as with the address of a proxy.
+	DatabaseURL string
+	// S3Endpoint is the url of minio.
+	S3Endpoint               string
+	S3AccessKey, S3SecretKey string
+	Bucket                   string
+	// S3 is a client of minio.
+	S3 *s3.Client
+}
+
+// New returns a [Store] for use within tests. A new bucket is created for each call.
+func New(tb testing.TB) *Store {
+	tb.Helper()
+	ctx := context.Background()
+
+	// the containers are started by the first test that needs them
+	compose.once.Do(func() { compose.err = setup(ctx) })
+	if compose.err != nil {
+		tb.Fatalf("failed to start containers: %v", compose.err)
+	}
+
+	minioURL, err := compose.minio.ConnectionString(ctx)
+	is.OK(tb, err) // return minio connetion string
+
+	s := &Store{
+		S3Endpoint:  "http://" + minioURL,
+		S3AccessKey: compose.minio.Username,
+		S3SecretKey: compose.minio.Password,
+		Bucket:      texttest.Bucket(61), // random
+	}
+
+	conf, err := config.LoadDefaultConfig(ctx,
+		config.WithRegion("auto"),
+		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(s.S3AccessKey, s.S3SecretKey, "")))
+	is.OK(tb, err) // return minio configuration
+
+	s.S3 = s3.NewFromConfig(conf, func(o *s3.Options) {
+		o.BaseEndpoint = aws.String(s.S3Endpoint)
+		o.UsePathStyle = true
+	})
+	// note: StatusCode: 409, BucketAlreadyOwnedByYou
+	// note: StatusCode: 507, XMinioStorageFull
+	_, err = s.S3.CreateBucket(ctx, &s3.CreateBucketInput{Bucket: &s.Bucket})
+	is.OK(tb, err) // create bucket
+
+	s.DatabaseURL, err = compose.crdb.ConnectionString(ctx)
+	is.OK(tb, err) // return cockroachdb connection string
+	return s
+}
+
+// FS runs the migrations and returns a [fs.FS] of the store. The migrations
+// are rolled back when the test ends.
+func (s *Store) FS(tb testing.TB) *fs.FS {
+	tb.Helper()
+	ctx := context.Background()
+
+	is.OK(tb, crdb.Up(ctx, s.DatabaseURL)) // run migration scripts
+	tb.Cleanup(func() { is.OK(tb, crdb.Down(ctx, s.DatabaseURL)) })
+
+	pool, err := pgxpool.New(ctx, s.DatabaseURL)
+	is.OK(tb, err) // create db connection
+	tb.Cleanup(func() { pool.Close() })
+
+	return &fs.FS{
+		DB:           &fs.DB{RWC: pool},
+		Uploader:     blob.NewUploader(s.Bucket, s.S3),
+		Downloader:   blob.NewDownloader(s.Bucket, s.S3),
+		Deleter:      blob.NewDeleter(s.Bucket, s.S3),
+		Lister:       blob.NewLister(s.Bucket, s.S3),
+		PartUploader: blob.NewMultipart(s.Bucket, s.S3),
+	}
+}